@@ -0,0 +1,336 @@
+package aof
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rsampaio/kvstore/store"
+)
+
+// FsyncPolicy defines when the log is flushed to disk.
+type FsyncPolicy int
+
+const (
+	// FsyncAlways syncs the file after every record.
+	FsyncAlways FsyncPolicy = iota
+	// FsyncEverySec syncs the file once per second in the background.
+	FsyncEverySec
+	// FsyncNever leaves syncing to the operating system.
+	FsyncNever
+)
+
+// DefaultRewriteMinSize is the minimum log size before it is rewritten.
+const DefaultRewriteMinSize = 64 << 20
+
+// ParseFsyncPolicy returns the policy by its name: always, everysec or never.
+func ParseFsyncPolicy(name string) (FsyncPolicy, error) {
+	switch name {
+	case "always":
+		return FsyncAlways, nil
+	case "everysec":
+		return FsyncEverySec, nil
+	case "never":
+		return FsyncNever, nil
+	}
+	return 0, fmt.Errorf("unknown fsync policy %q", name)
+}
+
+// Log is an append-only file of write records.
+type Log struct {
+	// RewriteMinSize is the minimum size of the log before Store triggers a
+	// rewrite, the log is also only rewritten after doubling its size since
+	// the last rewrite.
+	RewriteMinSize int64
+
+	path   string
+	policy FsyncPolicy
+
+	mu   sync.Mutex
+	f    *os.File
+	rec  bytes.Buffer
+	size int64
+	// base is the size of the log after the last rewrite.
+	base int64
+
+	// While a rewrite is running new records are also kept in pending
+	// so they can be appended to the rewritten log.
+	rewriting bool
+	pending   bytes.Buffer
+
+	done chan struct{}
+}
+
+// Open opens or creates the log at path for appending.
+func Open(path string, policy FsyncPolicy) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	l := &Log{
+		RewriteMinSize: DefaultRewriteMinSize,
+		path:           path,
+		policy:         policy,
+		f:              f,
+		size:           fi.Size(),
+		base:           fi.Size(),
+		done:           make(chan struct{}),
+	}
+
+	if policy == FsyncEverySec {
+		go l.syncEverySecond()
+	}
+	return l, nil
+}
+
+// Set appends a SET record.
+func (l *Log) Set(key string, value []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rec.Reset()
+	writeSet(&l.rec, key, value)
+	return l.append()
+}
+
+// SetExpireAt appends a SETEXAT record with the deadline in unix milliseconds.
+func (l *Log) SetExpireAt(key string, value []byte, deadline time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rec.Reset()
+	writeValue(&l.rec, "SETEXAT "+key+" "+strconv.FormatInt(unixMilli(deadline), 10), value)
+	return l.append()
+}
+
+// Delete appends a DELETE record.
+func (l *Log) Delete(key string) error {
+	return l.appendLine("DELETE " + key)
+}
+
+// ExpireAt appends an EXPIREAT record with the deadline in unix milliseconds.
+func (l *Log) ExpireAt(key string, deadline time.Time) error {
+	return l.appendLine("EXPIREAT " + key + " " + strconv.FormatInt(unixMilli(deadline), 10))
+}
+
+// Persist appends a PERSIST record.
+func (l *Log) Persist(key string) error {
+	return l.appendLine("PERSIST " + key)
+}
+
+// Size returns the size of the log in bytes.
+func (l *Log) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
+
+// Close syncs and closes the log.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return nil
+	default:
+		close(l.done)
+	}
+
+	if err := l.f.Sync(); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+func (l *Log) appendLine(line string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rec.Reset()
+	l.rec.WriteString(line)
+	l.rec.WriteString("\r\n")
+	return l.append()
+}
+
+// append writes the record in l.rec, l.mu must be held.
+func (l *Log) append() error {
+	if l.rewriting {
+		l.pending.Write(l.rec.Bytes())
+	}
+
+	n, err := l.f.Write(l.rec.Bytes())
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	if l.policy == FsyncAlways {
+		return l.f.Sync()
+	}
+	return nil
+}
+
+// needsRewrite reports whether the log doubled in size since the last rewrite.
+func (l *Log) needsRewrite() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !l.rewriting && l.size >= l.RewriteMinSize && l.size >= 2*l.base
+}
+
+// Rewrite replaces the log with the shortest sequence of records that
+// rebuilds the current contents of s, records appended while the rewrite
+// runs are preserved so the log can be written concurrently.
+func (l *Log) Rewrite(s store.Store) error {
+	if !l.startRewrite() {
+		return fmt.Errorf("rewrite already in progress")
+	}
+	view := store.ViewOf(s)
+	defer store.CloseView(view)
+	return l.finishRewrite(view)
+}
+
+// startRewrite starts keeping the appended records for a rewrite, it
+// returns false if a rewrite is in progress.
+func (l *Log) startRewrite() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rewriting {
+		return false
+	}
+	l.rewriting = true
+	l.pending.Reset()
+	return true
+}
+
+// finishRewrite writes the records that rebuild s and the records appended
+// since startRewrite and replaces the log with them.
+func (l *Log) finishRewrite(s store.Store) error {
+	tmp := l.path + ".rewrite"
+	err := l.rewrite(tmp, s)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rewriting = false
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(l.pending.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := os.Rename(tmp, l.path); err != nil {
+		f.Close()
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.f.Close()
+	l.f = f
+	l.size = fi.Size()
+	l.base = fi.Size()
+	l.pending.Reset()
+	return nil
+}
+
+// rewrite writes the records that rebuild s to path, keys are written from
+// the least to the most recently modified so replaying keeps their order.
+func (l *Log) rewrite(path string, s store.Store) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	e, _ := s.(store.Expirer)
+	c, _ := s.(store.Collections)
+	keys := s.GetLastModifiedKeys()
+
+	var rec bytes.Buffer
+	for i := len(keys) - 1; i >= 0; i-- {
+		rec.Reset()
+		if v, ok := s.Get(keys[i]); ok {
+			writeSet(&rec, keys[i], v)
+		} else if c != nil {
+			writeCollection(&rec, c, keys[i])
+		}
+
+		if rec.Len() == 0 {
+			continue
+		}
+
+		if e != nil {
+			if ttl, ok := e.TTL(keys[i]); ok && ttl != store.NoExpiry {
+				fmt.Fprintf(&rec, "EXPIREAT %s %d\r\n", keys[i], unixMilli(time.Now().Add(ttl)))
+			}
+		}
+
+		if _, err := f.Write(rec.Bytes()); err != nil {
+			return err
+		}
+	}
+	return f.Sync()
+}
+
+func (l *Log) syncEverySecond() {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-t.C:
+			l.mu.Lock()
+			l.f.Sync()
+			l.mu.Unlock()
+		}
+	}
+}
+
+func writeSet(buf *bytes.Buffer, key string, value []byte) {
+	writeValue(buf, "SET "+key, value)
+}
+
+// writeValue writes a record made of the header line with the size of
+// value appended followed by value and CRLF.
+func writeValue(buf *bytes.Buffer, header string, value []byte) {
+	fmt.Fprintf(buf, "%s %d\r\n", header, len(value))
+	buf.Write(value)
+	buf.WriteString("\r\n")
+}
+
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
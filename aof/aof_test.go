@@ -0,0 +1,210 @@
+package aof
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rsampaio/kvstore/store"
+)
+
+func tempLog(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "aof")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "kvstore.aof")
+}
+
+func TestReplay(t *testing.T) {
+	path := tempLog(t)
+	l, err := Open(path, FsyncAlways)
+	if err != nil {
+		t.Fatalf("unexpected open error: %v", err)
+	}
+
+	s := NewStore(store.NewMemoryStore(100), l)
+	s.Set("foo", []byte("a\r\nb"))
+	s.Set("bar", []byte("1"))
+	s.Set("baz", []byte("2"))
+	s.Delete("bar")
+	s.Expire("baz", time.Hour)
+	s.Set("qux", []byte("3"))
+	s.Expire("qux", time.Hour)
+	s.Persist("qux")
+	s.Close()
+
+	r := store.NewMemoryStore(100)
+	defer r.Close()
+	if err := Replay(path, r); err != nil {
+		t.Fatalf("unexpected replay error: %v", err)
+	}
+
+	want := []string{"qux", "baz", "foo"}
+	if got := r.GetLastModifiedKeys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wants: %v", got, want)
+	}
+
+	if v, _ := r.Get("foo"); string(v) != "a\r\nb" {
+		t.Errorf("got %q, wants: %q", v, "a\r\nb")
+	}
+
+	if ttl, _ := r.TTL("baz"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("unexpected ttl %v", ttl)
+	}
+
+	if ttl, _ := r.TTL("qux"); ttl != store.NoExpiry {
+		t.Errorf("got ttl %v, wants: %v", ttl, store.NoExpiry)
+	}
+}
+
+func TestReplaySetExpire(t *testing.T) {
+	path := tempLog(t)
+	l, err := Open(path, FsyncAlways)
+	if err != nil {
+		t.Fatalf("unexpected open error: %v", err)
+	}
+
+	s := NewStore(store.NewMemoryStore(100), l)
+	s.SetExpire("foo", []byte("1"), time.Hour)
+	s.Close()
+
+	// The value and the deadline are a single record.
+	data, _ := ioutil.ReadFile(path)
+	if got := strings.Count(string(data), "\r\n"); got != 2 {
+		t.Errorf("got %d lines %q, wants a single record", got, data)
+	}
+
+	r := store.NewMemoryStore(100)
+	defer r.Close()
+	if err := Replay(path, r); err != nil {
+		t.Fatalf("unexpected replay error: %v", err)
+	}
+	if v, _ := r.Get("foo"); string(v) != "1" {
+		t.Errorf("got %q, wants: %q", v, "1")
+	}
+	if ttl, _ := r.TTL("foo"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("unexpected ttl %v", ttl)
+	}
+}
+
+func TestReplayCollections(t *testing.T) {
+	for _, rewrite := range []bool{false, true} {
+		path := tempLog(t)
+		l, err := Open(path, FsyncAlways)
+		if err != nil {
+			t.Fatalf("unexpected open error: %v", err)
+		}
+
+		s := NewStore(store.NewMemoryStore(100), l)
+		s.LPush("list", []byte("a"), []byte("b\r\n"))
+		s.LPush("list", []byte("c"))
+		s.RPop("list")
+		s.HSet("hash", "f", []byte("v"))
+		s.SAdd("set", "x", "y")
+		s.ZAdd("zset", 1.5, "m")
+		s.ZAdd("zset", -2, "n")
+		if rewrite {
+			if err := l.Rewrite(s); err != nil {
+				t.Fatalf("unexpected rewrite error: %v", err)
+			}
+		}
+		s.Close()
+
+		r := store.NewMemoryStore(100)
+		if err := Replay(path, r); err != nil {
+			t.Fatalf("unexpected replay error: %v", err)
+		}
+
+		list, _ := r.LRange("list", 0, -1)
+		if want := [][]byte{[]byte("c"), []byte("b\r\n")}; !reflect.DeepEqual(list, want) {
+			t.Errorf("rewrite %v: got list %q, wants: %q", rewrite, list, want)
+		}
+
+		if v, _, _ := r.HGet("hash", "f"); string(v) != "v" {
+			t.Errorf("rewrite %v: got field %q, wants: %q", rewrite, v, "v")
+		}
+
+		if members, _ := r.SMembers("set"); !reflect.DeepEqual(members, []string{"x", "y"}) {
+			t.Errorf("rewrite %v: got members %v", rewrite, members)
+		}
+
+		zset, _ := r.ZRange("zset", 0, -1)
+		if want := []store.ScoredMember{{Member: "n", Score: -2}, {Member: "m", Score: 1.5}}; !reflect.DeepEqual(zset, want) {
+			t.Errorf("rewrite %v: got %v, wants: %v", rewrite, zset, want)
+		}
+		r.Close()
+	}
+}
+
+func TestReplayTruncated(t *testing.T) {
+	path := tempLog(t)
+	ioutil.WriteFile(path, []byte("SET foo 3\r\nbar\r\nSET baz 10\r\nqu"), 0644)
+
+	r := store.NewMemoryStore(100)
+	if err := Replay(path, r); err != nil {
+		t.Fatalf("unexpected replay error: %v", err)
+	}
+
+	if got := r.GetLastModifiedKeys(); !reflect.DeepEqual(got, []string{"foo"}) {
+		t.Errorf("got %v, wants: %v", got, []string{"foo"})
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	path := tempLog(t)
+	l, err := Open(path, FsyncNever)
+	if err != nil {
+		t.Fatalf("unexpected open error: %v", err)
+	}
+	l.RewriteMinSize = 1 << 20
+
+	s := NewStore(store.NewMemoryStore(100), l)
+	for i := 0; i < 100; i++ {
+		s.Set("foo", []byte("value"))
+	}
+	s.Set("bar", []byte("value"))
+
+	before := l.Size()
+	if err := l.Rewrite(s.Store); err != nil {
+		t.Fatalf("unexpected rewrite error: %v", err)
+	}
+
+	if l.Size() >= before {
+		t.Errorf("expected log to shrink from %d, got %d", before, l.Size())
+	}
+
+	// Records appended after the rewrite go to the new log.
+	s.Delete("foo")
+	s.Close()
+
+	r := store.NewMemoryStore(100)
+	if err := Replay(path, r); err != nil {
+		t.Fatalf("unexpected replay error: %v", err)
+	}
+
+	if got := r.GetLastModifiedKeys(); !reflect.DeepEqual(got, []string{"bar"}) {
+		t.Errorf("got %v, wants: %v", got, []string{"bar"})
+	}
+}
+
+func TestParseFsyncPolicy(t *testing.T) {
+	for name, want := range map[string]FsyncPolicy{
+		"always":   FsyncAlways,
+		"everysec": FsyncEverySec,
+		"never":    FsyncNever,
+	} {
+		if got, err := ParseFsyncPolicy(name); err != nil || got != want {
+			t.Errorf("got %v %v, wants: %v", got, err, want)
+		}
+	}
+
+	if _, err := ParseFsyncPolicy("sometimes"); err == nil {
+		t.Errorf("expected error for unknown policy")
+	}
+}
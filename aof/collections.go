@@ -0,0 +1,239 @@
+package aof
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rsampaio/kvstore/store"
+)
+
+// errNoCollections is returned by writes of collections when the wrapped
+// store does not implement store.Collections.
+var errNoCollections = errors.New("aof: store does not support collections")
+
+// LPush appends an LPUSH record.
+func (l *Log) LPush(key string, value []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rec.Reset()
+	writeValue(&l.rec, "LPUSH "+key, value)
+	return l.append()
+}
+
+// RPop appends an RPOP record.
+func (l *Log) RPop(key string) error {
+	return l.appendLine("RPOP " + key)
+}
+
+// HSet appends an HSET record.
+func (l *Log) HSet(key, field string, value []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rec.Reset()
+	writeValue(&l.rec, "HSET "+key+" "+field, value)
+	return l.append()
+}
+
+// SAdd appends an SADD record.
+func (l *Log) SAdd(key string, members ...string) error {
+	return l.appendLine("SADD " + key + " " + strings.Join(members, " "))
+}
+
+// ZAdd appends a ZADD record.
+func (l *Log) ZAdd(key string, score float64, member string) error {
+	return l.appendLine("ZADD " + key + " " + strconv.FormatFloat(score, 'g', -1, 64) + " " + member)
+}
+
+// writeCollection writes the records that rebuild the collection of key.
+func writeCollection(buf *bytes.Buffer, c store.Collections, key string) {
+	switch c.Type(key) {
+	case store.TypeList:
+		// LPUSH inserts at the head so the tail is written first.
+		values, _ := c.LRange(key, 0, -1)
+		for i := len(values) - 1; i >= 0; i-- {
+			writeValue(buf, "LPUSH "+key, values[i])
+		}
+	case store.TypeHash:
+		fields, _ := c.HGetAll(key)
+		for _, f := range fields {
+			writeValue(buf, "HSET "+key+" "+f.Key, f.Value)
+		}
+	case store.TypeSet:
+		members, _ := c.SMembers(key)
+		if len(members) > 0 {
+			fmt.Fprintf(buf, "SADD %s %s\r\n", key, strings.Join(members, " "))
+		}
+	case store.TypeZSet:
+		members, _ := c.ZRange(key, 0, -1)
+		for _, m := range members {
+			fmt.Fprintf(buf, "ZADD %s %s %s\r\n", key, strconv.FormatFloat(m.Score, 'g', -1, 64), m.Member)
+		}
+	}
+}
+
+// Type returns the type of the value of key.
+func (a *Store) Type(key string) store.Type {
+	c, ok := a.Store.(store.Collections)
+	if !ok {
+		return store.TypeNone
+	}
+	return c.Type(key)
+}
+
+// LPush inserts values at the head of the list and records them.
+func (a *Store) LPush(key string, values ...[]byte) (int, error) {
+	c, ok := a.Store.(store.Collections)
+	if !ok {
+		return 0, errNoCollections
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	n, err := c.LPush(key, values...)
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range values {
+		if err := a.record(a.log.LPush(key, v)); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// RPop removes the last element of the list and records it.
+func (a *Store) RPop(key string) ([]byte, bool, error) {
+	c, ok := a.Store.(store.Collections)
+	if !ok {
+		return nil, false, errNoCollections
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	v, ok, err := c.RPop(key)
+	if err != nil || !ok {
+		return v, ok, err
+	}
+	return v, ok, a.record(a.log.RPop(key))
+}
+
+// LRange returns the elements of the list between start and stop.
+func (a *Store) LRange(key string, start, stop int) ([][]byte, error) {
+	c, ok := a.Store.(store.Collections)
+	if !ok {
+		return nil, errNoCollections
+	}
+	return c.LRange(key, start, stop)
+}
+
+// HSet sets a field of the hash and records it.
+func (a *Store) HSet(key, field string, value []byte) (bool, error) {
+	c, ok := a.Store.(store.Collections)
+	if !ok {
+		return false, errNoCollections
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	added, err := c.HSet(key, field, value)
+	if err != nil {
+		return false, err
+	}
+	return added, a.record(a.log.HSet(key, field, value))
+}
+
+// HGet returns the value of a field of the hash.
+func (a *Store) HGet(key, field string) ([]byte, bool, error) {
+	c, ok := a.Store.(store.Collections)
+	if !ok {
+		return nil, false, errNoCollections
+	}
+	return c.HGet(key, field)
+}
+
+// HGetAll returns the fields of the hash.
+func (a *Store) HGetAll(key string) ([]store.KeyValue, error) {
+	c, ok := a.Store.(store.Collections)
+	if !ok {
+		return nil, errNoCollections
+	}
+	return c.HGetAll(key)
+}
+
+// SAdd adds members to the set and records them.
+func (a *Store) SAdd(key string, members ...string) (int, error) {
+	c, ok := a.Store.(store.Collections)
+	if !ok {
+		return 0, errNoCollections
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	n, err := c.SAdd(key, members...)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	return n, a.record(a.log.SAdd(key, members...))
+}
+
+// SIsMember reports whether member is in the set.
+func (a *Store) SIsMember(key, member string) (bool, error) {
+	c, ok := a.Store.(store.Collections)
+	if !ok {
+		return false, errNoCollections
+	}
+	return c.SIsMember(key, member)
+}
+
+// SMembers returns the members of the set.
+func (a *Store) SMembers(key string) ([]string, error) {
+	c, ok := a.Store.(store.Collections)
+	if !ok {
+		return nil, errNoCollections
+	}
+	return c.SMembers(key)
+}
+
+// ZAdd sets the score of a member of the sorted set and records it.
+func (a *Store) ZAdd(key string, score float64, member string) (bool, error) {
+	c, ok := a.Store.(store.Collections)
+	if !ok {
+		return false, errNoCollections
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	added, err := c.ZAdd(key, score, member)
+	if err != nil {
+		return false, err
+	}
+	return added, a.record(a.log.ZAdd(key, score, member))
+}
+
+// ZRange returns the members of the sorted set between the ranks start and stop.
+func (a *Store) ZRange(key string, start, stop int) ([]store.ScoredMember, error) {
+	c, ok := a.Store.(store.Collections)
+	if !ok {
+		return nil, errNoCollections
+	}
+	return c.ZRange(key, start, stop)
+}
+
+// ZScore returns the score of a member of the sorted set.
+func (a *Store) ZScore(key, member string) (float64, bool, error) {
+	c, ok := a.Store.(store.Collections)
+	if !ok {
+		return 0, false, errNoCollections
+	}
+	return c.ZScore(key, member)
+}
@@ -0,0 +1,10 @@
+/*
+Package aof implements an append-only file that records every write applied
+to a store so its contents can be rebuilt after a restart.
+The aof package defines a Log that appends SET, DELETE and expiry records with
+a configurable fsync policy, a Store that wraps a store.Store recording every
+write executed through it and a Replay function that applies a log to a store.
+The log is rewritten in the background from the contents of the store once it
+doubles in size so it does not grow forever.
+*/
+package aof
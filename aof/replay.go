@@ -0,0 +1,156 @@
+package aof
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rsampaio/kvstore/store"
+)
+
+// Replay applies the records of the log at path to s, a missing log is
+// not an error and an incomplete record at the end of the log, left by a
+// crash in the middle of a write, is ignored.
+func Replay(path string, s store.Store) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		err := replayRecord(r, s)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("aof record %d: %v", n, err)
+		}
+	}
+}
+
+func replayRecord(r *bufio.Reader, s store.Store) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line != "" {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	parsed := strings.Split(strings.TrimRight(line, "\r\n"), " ")
+	switch {
+	case parsed[0] == "SET" && len(parsed) == 3:
+		size, err := strconv.Atoi(parsed[2])
+		if err != nil {
+			return err
+		}
+
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		return s.Set(parsed[1], value[:size])
+
+	case parsed[0] == "SETEXAT" && len(parsed) == 4:
+		ms, err := strconv.ParseInt(parsed[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		size, err := strconv.Atoi(parsed[3])
+		if err != nil {
+			return err
+		}
+
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+
+		e, ok := s.(store.Expirer)
+		if !ok {
+			return s.Set(parsed[1], value[:size])
+		}
+		return e.SetExpire(parsed[1], value[:size], time.Until(time.Unix(0, ms*int64(time.Millisecond))))
+
+	case parsed[0] == "LPUSH" && len(parsed) == 3, parsed[0] == "HSET" && len(parsed) == 4:
+		size, err := strconv.Atoi(parsed[len(parsed)-1])
+		if err != nil {
+			return err
+		}
+
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+
+		c, ok := s.(store.Collections)
+		if !ok {
+			return errNoCollections
+		}
+		if parsed[0] == "LPUSH" {
+			_, err = c.LPush(parsed[1], value[:size])
+		} else {
+			_, err = c.HSet(parsed[1], parsed[2], value[:size])
+		}
+		return err
+
+	case parsed[0] == "RPOP" && len(parsed) == 2:
+		c, ok := s.(store.Collections)
+		if !ok {
+			return errNoCollections
+		}
+		_, _, err := c.RPop(parsed[1])
+		return err
+
+	case parsed[0] == "SADD" && len(parsed) >= 3:
+		c, ok := s.(store.Collections)
+		if !ok {
+			return errNoCollections
+		}
+		_, err := c.SAdd(parsed[1], parsed[2:]...)
+		return err
+
+	case parsed[0] == "ZADD" && len(parsed) == 4:
+		score, err := strconv.ParseFloat(parsed[2], 64)
+		if err != nil {
+			return err
+		}
+
+		c, ok := s.(store.Collections)
+		if !ok {
+			return errNoCollections
+		}
+		_, err = c.ZAdd(parsed[1], score, parsed[3])
+		return err
+
+	case parsed[0] == "DELETE" && len(parsed) == 2:
+		return s.Delete(parsed[1])
+
+	case parsed[0] == "EXPIREAT" && len(parsed) == 3:
+		ms, err := strconv.ParseInt(parsed[2], 10, 64)
+		if err != nil {
+			return err
+		}
+
+		if e, ok := s.(store.Expirer); ok {
+			e.Expire(parsed[1], time.Until(time.Unix(0, ms*int64(time.Millisecond))))
+		}
+		return nil
+
+	case parsed[0] == "PERSIST" && len(parsed) == 2:
+		if e, ok := s.(store.Expirer); ok {
+			e.Persist(parsed[1])
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid record %q", line)
+}
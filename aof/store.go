@@ -0,0 +1,320 @@
+package aof
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rsampaio/kvstore/store"
+)
+
+// Store wraps a store.Store and records every write executed through it in a Log.
+type Store struct {
+	store.Store
+	log *Log
+
+	// mu makes each write and its record atomic so the log has the
+	// same order as the writes applied to the store.
+	mu sync.Mutex
+
+	// tx is set for the stores passed to Atomically, they do not start
+	// rewrites since the wrapped store is only valid during the transaction.
+	tx bool
+}
+
+// NewStore returns a Store that applies writes to s and records them in l.
+func NewStore(s store.Store, l *Log) *Store {
+	return &Store{Store: s, log: l}
+}
+
+// Set saves the key/value and records it.
+func (a *Store) Set(key string, value []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.Store.Set(key, value); err != nil {
+		return err
+	}
+	return a.record(a.log.Set(key, value))
+}
+
+// Delete deletes key and records it.
+func (a *Store) Delete(key string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.Store.Delete(key); err != nil {
+		return err
+	}
+	return a.record(a.log.Delete(key))
+}
+
+// Expire sets the time to live of key and records its deadline,
+// it returns false if the wrapped store does not implement store.Expirer.
+func (a *Store) Expire(key string, ttl time.Duration) bool {
+	e, ok := a.Store.(store.Expirer)
+	if !ok {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	deadline := time.Now().Add(ttl)
+	if !e.Expire(key, ttl) {
+		return false
+	}
+
+	if ttl <= 0 {
+		a.record(a.log.Delete(key))
+	} else {
+		a.record(a.log.ExpireAt(key, deadline))
+	}
+	return true
+}
+
+// SetExpire saves the key/value with its time to live and records them in
+// a single record, so replaying a log cut after it never restores the key
+// without its deadline.
+func (a *Store) SetExpire(key string, value []byte, ttl time.Duration) error {
+	e, ok := a.Store.(store.Expirer)
+	if !ok {
+		return errors.New("aof: store does not support expiry")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	deadline := time.Now().Add(ttl)
+	if err := e.SetExpire(key, value, ttl); err != nil {
+		return err
+	}
+
+	if ttl <= 0 {
+		return a.record(a.log.Delete(key))
+	}
+	return a.record(a.log.SetExpireAt(key, value, deadline))
+}
+
+// TTL returns the time to live of key.
+func (a *Store) TTL(key string) (time.Duration, bool) {
+	e, ok := a.Store.(store.Expirer)
+	if !ok {
+		return 0, false
+	}
+	return e.TTL(key)
+}
+
+// Persist removes the deadline of key and records it.
+func (a *Store) Persist(key string) bool {
+	e, ok := a.Store.(store.Expirer)
+	if !ok {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !e.Persist(key) {
+		return false
+	}
+	a.record(a.log.Persist(key))
+	return true
+}
+
+// GetVersion returns the value and the version of key, it returns false if
+// the wrapped store does not implement store.Versioned.
+func (a *Store) GetVersion(key string) ([]byte, uint64, bool) {
+	v, ok := a.Store.(store.Versioned)
+	if !ok {
+		return nil, 0, false
+	}
+	return v.GetVersion(key)
+}
+
+// CompareAndSwap sets the value of key if its version matches and records
+// it, it returns an error if the wrapped store does not implement store.Versioned.
+func (a *Store) CompareAndSwap(key string, value []byte, version uint64) (uint64, error) {
+	v, ok := a.Store.(store.Versioned)
+	if !ok {
+		return 0, errors.New("aof: store is not versioned")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	rev, err := v.CompareAndSwap(key, value, version)
+	if err != nil {
+		return 0, err
+	}
+	return rev, a.record(a.log.Set(key, value))
+}
+
+// Scan returns the keys of the wrapped store matching pattern after cursor,
+// it returns no keys if the wrapped store does not implement store.Scanner.
+func (a *Store) Scan(cursor uint64, pattern string, count int) ([]string, uint64) {
+	sc, ok := a.Store.(store.Scanner)
+	if !ok {
+		return nil, 0
+	}
+	return sc.Scan(cursor, pattern, count)
+}
+
+// Range returns the keys of the wrapped store between start and end, it
+// returns no keys if the wrapped store does not implement store.Ranger.
+func (a *Store) Range(start, end string, limit int, reverse bool) []store.KeyValue {
+	r, ok := a.Store.(store.Ranger)
+	if !ok {
+		return nil
+	}
+	return r.Range(start, end, limit, reverse)
+}
+
+// Update atomically replaces the value of key and records the new value,
+// it returns an error if the wrapped store does not implement store.Updater.
+func (a *Store) Update(key string, fn func(value []byte, ok bool) ([]byte, error)) error {
+	u, ok := a.Store.(store.Updater)
+	if !ok {
+		return errors.New("aof: store does not support updates")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var value []byte
+	err := u.Update(key, func(old []byte, ok bool) ([]byte, error) {
+		var err error
+		value, err = fn(old, ok)
+		return value, err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := a.record(a.log.Set(key, value)); err != nil {
+		return err
+	}
+
+	// The SET record clears the deadline the key kept.
+	if e, ok := a.Store.(store.Expirer); ok {
+		if ttl, ok := e.TTL(key); ok && ttl != store.NoExpiry {
+			return a.record(a.log.ExpireAt(key, time.Now().Add(ttl)))
+		}
+	}
+	return nil
+}
+
+// Observe registers fn with the wrapped store, fn is never called if the
+// wrapped store does not implement store.Observable.
+func (a *Store) Observe(fn func(store.Event)) {
+	if o, ok := a.Store.(store.Observable); ok {
+		o.Observe(fn)
+	}
+}
+
+// View returns a view of the wrapped store, it returns nil if the wrapped
+// store does not implement store.Viewer.
+func (a *Store) View() *store.View {
+	if v, ok := a.Store.(store.Viewer); ok {
+		return v.View()
+	}
+	return nil
+}
+
+// CompressionStats returns the compression totals of the wrapped store, it
+// returns no totals if the wrapped store does not implement store.Compressor.
+func (a *Store) CompressionStats() store.CompressionStats {
+	if c, ok := a.Store.(store.Compressor); ok {
+		return c.CompressionStats()
+	}
+	return store.CompressionStats{}
+}
+
+// MemoryUsage returns the memory used by key in the wrapped store, it returns
+// false if the wrapped store does not implement store.MemoryReporter.
+func (a *Store) MemoryUsage(key string) (int, bool) {
+	if m, ok := a.Store.(store.MemoryReporter); ok {
+		return m.MemoryUsage(key)
+	}
+	return 0, false
+}
+
+// MemoryStats returns the memory used by the wrapped store, it returns no
+// memory if the wrapped store does not implement store.MemoryReporter.
+func (a *Store) MemoryStats() store.MemoryStats {
+	if m, ok := a.Store.(store.MemoryReporter); ok {
+		return m.MemoryStats()
+	}
+	return store.MemoryStats{}
+}
+
+// Stats returns the counters of the wrapped store, it returns no counters
+// if the wrapped store does not implement store.StatsReporter.
+func (a *Store) Stats() store.Stats {
+	if r, ok := a.Store.(store.StatsReporter); ok {
+		return r.Stats()
+	}
+	return store.Stats{}
+}
+
+// Revision returns the revision of key, it returns 0 if the wrapped store
+// does not implement store.Transactional.
+func (a *Store) Revision(key string) uint64 {
+	t, ok := a.Store.(store.Transactional)
+	if !ok {
+		return 0
+	}
+	return t.Revision(key)
+}
+
+// Atomically runs fn in a transaction of the wrapped store recording the
+// writes executed through it, it returns an error if the wrapped store does
+// not implement store.Transactional.
+func (a *Store) Atomically(watched map[string]uint64, fn func(tx store.Store) error) error {
+	t, ok := a.Store.(store.Transactional)
+	if !ok {
+		return errors.New("aof: store is not transactional")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	err := t.Atomically(watched, func(tx store.Store) error {
+		return fn(&Store{Store: tx, log: a.log, tx: true})
+	})
+	if err != nil {
+		return err
+	}
+	return a.record(nil)
+}
+
+// Close closes the log and the wrapped store if it implements io.Closer.
+func (a *Store) Close() error {
+	if c, ok := a.Store.(io.Closer); ok {
+		c.Close()
+	}
+	return a.log.Close()
+}
+
+// record returns an error for a failed append and starts a background
+// rewrite when the log grew enough, a.mu must be held.
+func (a *Store) record(err error) error {
+	if err != nil {
+		return fmt.Errorf("aof: %v", err)
+	}
+
+	// The view is taken with a.mu held when the log starts keeping the
+	// new records so every write is either in the view or in the records.
+	if !a.tx && a.log.needsRewrite() && a.log.startRewrite() {
+		view := store.ViewOf(a.Store)
+		go func() {
+			defer store.CloseView(view)
+			if err := a.log.finishRewrite(view); err != nil {
+				fmt.Printf("aof-rewrite error=%v\n", err)
+			}
+		}()
+	}
+	return nil
+}
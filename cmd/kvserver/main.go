@@ -1,14 +1,21 @@
 package main
 
 import (
+	"compress/flate"
 	"context"
 	"crypto/tls"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"strings"
 
+	"github.com/rsampaio/kvstore/aof"
+	"github.com/rsampaio/kvstore/lsm"
+	"github.com/rsampaio/kvstore/pubsub"
 	"github.com/rsampaio/kvstore/server"
+	"github.com/rsampaio/kvstore/snapshot"
 	"github.com/rsampaio/kvstore/store"
 )
 
@@ -18,24 +25,176 @@ var (
 	tlsPort   = flag.String("tls-listen", ":2021", "TLS server listen address")
 	tlsCert   = flag.String("tls-cert", "", "PEM certificate file")
 	tlsKey    = flag.String("tls-key", "", "Cerficate key file")
-	capacity  = flag.Int("capacity-bytes", 1000, "Max capacity in bytes")
+	capacity  = flag.Int("capacity-bytes", 1000, "Max capacity in bytes of each database counting keys, values and the estimated overhead of each key")
+	databases = flag.Int("databases", 1, "Number of databases selected with SELECT")
+	eviction  = flag.String("eviction-policy", "lru", "Eviction policy ("+strings.Join(store.EvictionPolicies(), ", ")+")")
+	engine    = flag.String("engine", "memory", "Storage engine (memory, lsm, tiered)")
+	dataDir   = flag.String("data-dir", "data", "Data directory of the lsm and tiered engines")
+	ordered   = flag.Bool("ordered-index", false, "Keeps keys ordered to speed up RANGE at the cost of O(log n) writes")
+	shards    = flag.Int("shards", 1, "Number of store shards, each shard gets an equal share of the capacity")
+	aofPath   = flag.String("aof-path", "", "Append-only file path, writes are not persisted when empty")
+	aofFsync  = flag.String("aof-fsync", "everysec", "Append-only file fsync policy (always, everysec, never)")
+	aofMin    = flag.Int64("aof-rewrite-min-bytes", aof.DefaultRewriteMinSize, "Minimum append-only file size before it is rewritten")
+	snapDir   = flag.String("snapshot-dir", "", "Snapshot directory, enables SAVE and BGSAVE and loads the newest snapshot at startup")
+	snapEvery = flag.Duration("snapshot-interval", 0, "Interval between background snapshots, disabled when zero")
+	pubBuffer = flag.Int("pubsub-buffer", pubsub.DefaultBufferSize, "Messages buffered for each subscriber, slower subscribers are disconnected")
+	notify    = flag.Bool("notify-keyspace-events", false, "Publishes key changes to the __keyspace@<db>__ and __keyevent@<db>__ channels")
+	compress  = flag.Int("compress-above", 0, "Compresses string values of at least this many bytes, disabled when zero")
+	level     = flag.Int("compress-level", flate.DefaultCompression, "Compression level from -2 (huffman only) to 9 (best compression)")
 )
 
-func startTCP(ctx context.Context, s store.Store) {
+// newStore creates the store configured by the command line flags.
+func newStore() (store.Store, error) {
+	policy, err := store.NewEvictionPolicy(*eviction)
+	if err != nil {
+		return nil, err
+	}
+
+	if *level < flate.HuffmanOnly || *level > flate.BestCompression {
+		return nil, fmt.Errorf("invalid compression level %d", *level)
+	}
+
+	switch *engine {
+	case "memory":
+	case "lsm":
+		if err := unsupportedFlags("lsm", "eviction-policy", "shards", "ordered-index", "compress-above", "compress-level"); err != nil {
+			return nil, err
+		}
+		return lsm.Open(*dataDir, lsm.Options{Capacity: *capacity})
+	case "tiered":
+		if err := unsupportedFlags("tiered", "shards", "ordered-index"); err != nil {
+			return nil, err
+		}
+		// Keys leave the hot store by eviction only.
+		if n, ok := policy.(store.NonEvicting); ok && n.NeverEvicts() {
+			return nil, fmt.Errorf("the tiered engine does not support the noeviction policy")
+		}
+		cold, err := lsm.Open(*dataDir, lsm.Options{})
+		if err != nil {
+			return nil, err
+		}
+		return store.NewTieredStore(*capacity, cold, store.WithEvictionPolicy(policy), store.WithCompression(*compress, *level), store.WithOverheadAccounting()), nil
+	default:
+		return nil, fmt.Errorf("unknown engine %q", *engine)
+	}
+
+	newShard := func(cap int) *store.MemoryStore {
+		policy, _ := store.NewEvictionPolicy(*eviction)
+		opts := []store.Option{
+			store.WithEvictionPolicy(policy),
+			store.WithCompression(*compress, *level),
+			store.WithOverheadAccounting(),
+		}
+		if *ordered {
+			opts = append(opts, store.WithOrderedIndex())
+		}
+		return store.NewMemoryStore(cap, opts...)
+	}
+
+	if *shards > 1 {
+		return store.NewShardedStore(*shards, *capacity, newShard), nil
+	}
+	return newShard(*capacity), nil
+}
+
+// unsupportedFlags returns an error for the first of the flags set on the
+// command line, they are not used by the engine.
+func unsupportedFlags(engine string, names ...string) error {
+	unused := make(map[string]bool, len(names))
+	for _, name := range names {
+		unused[name] = true
+	}
+
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		if unused[f.Name] && err == nil {
+			err = fmt.Errorf("the %s engine does not support --%s", engine, f.Name)
+		}
+	})
+	return err
+}
+
+// openAOF replays the append-only file into s and returns a store
+// that records every write, s is returned as is when --aof-path is not set.
+func openAOF(s store.Store) (store.Store, error) {
+	if *aofPath == "" {
+		return s, nil
+	}
+
+	policy, err := aof.ParseFsyncPolicy(*aofFsync)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("replaying-aof path=%v\n", *aofPath)
+	if err := aof.Replay(*aofPath, s); err != nil {
+		return nil, err
+	}
+
+	l, err := aof.Open(*aofPath, policy)
+	if err != nil {
+		return nil, err
+	}
+	l.RewriteMinSize = *aofMin
+	return aof.NewStore(s, l), nil
+}
+
+// loadSnapshot loads the newest valid snapshot into s unless the
+// append-only file exists, the log is more recent than any snapshot.
+func loadSnapshot(sn *snapshot.Snapshotter, s store.Store) error {
+	if *aofPath != "" {
+		if _, err := os.Stat(*aofPath); err == nil {
+			return nil
+		}
+	}
+
+	path, err := sn.LoadLatest(s)
+	if path != "" {
+		fmt.Printf("loaded-snapshot path=%v\n", path)
+	}
+	return err
+}
+
+// newDatabases creates the databases after the first one, persistence
+// and disk engines only support a single database.
+func newDatabases(first store.Store) (*server.Databases, error) {
+	dbs := []store.Store{first}
+	if *databases <= 1 {
+		return server.NewDatabases(dbs...), nil
+	}
+
+	if *aofPath != "" || *snapDir != "" || *engine != "memory" {
+		return nil, fmt.Errorf("--databases requires the memory engine without persistence")
+	}
+
+	for i := 1; i < *databases; i++ {
+		s, err := newStore()
+		if err != nil {
+			return nil, err
+		}
+		dbs = append(dbs, s)
+	}
+	return server.NewDatabases(dbs...), nil
+}
+
+func startTCP(ctx context.Context, dbs *server.Databases, b *pubsub.Broker, h server.Handlers) {
 	fmt.Printf("starting-tcp port=%v\n", *tcpPort)
 	l, err := server.NewTCPListener(*tcpPort)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, err.Error())
+		fmt.Fprintln(os.Stderr, err.Error())
 		return
 	}
 
-	r := server.NewCommander(s, l)
+	r := server.NewCommander(dbs.Get(0), l)
+	r.UseDatabases(dbs)
+	r.UseBroker(b)
+	r.Handle(h)
 	go func(ctx context.Context) {
 		r.Run(ctx)
 	}(ctx)
 }
 
-func startTLS(ctx context.Context, s store.Store) {
+func startTLS(ctx context.Context, dbs *server.Databases, b *pubsub.Broker, h server.Handlers) {
 	tlsPort := *tlsPort
 	if *tlsCert == "" || *tlsKey == "" {
 		fmt.Fprintln(os.Stderr, "missing --tls-cert or --tls-key arguments")
@@ -52,11 +211,14 @@ func startTLS(ctx context.Context, s store.Store) {
 
 	ls, err := server.NewTLSListener(tlsPort, &tls.Config{Certificates: []tls.Certificate{cert}})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, err.Error())
+		fmt.Fprintln(os.Stderr, err.Error())
 		return
 	}
 
-	rs := server.NewCommander(s, ls)
+	rs := server.NewCommander(dbs.Get(0), ls)
+	rs.UseDatabases(dbs)
+	rs.UseBroker(b)
+	rs.Handle(h)
 
 	go func() {
 		rs.Run(ctx)
@@ -72,11 +234,53 @@ func main() {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
 
-	s := store.NewMemoryStore(*capacity)
+	s, err := newStore()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	handlers := server.Handlers{}
+	if *snapDir != "" {
+		sn := snapshot.New(*snapDir)
+		if err := loadSnapshot(sn, s); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		handlers = server.SaveHandlers(sn)
+		if *snapEvery > 0 {
+			go sn.Run(ctx, s, *snapEvery)
+		}
+	}
+
+	// The log is replayed before the listeners are open.
+	if s, err = openAOF(s); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	dbs, err := newDatabases(s)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	for i := 0; i < dbs.Len(); i++ {
+		if c, ok := dbs.Get(i).(io.Closer); ok {
+			defer c.Close()
+		}
+	}
+
+	// TCP and TLS clients publish to the same subscribers.
+	broker := pubsub.NewBroker(pubsub.WithBufferSize(*pubBuffer))
+	if *notify {
+		server.NotifyKeyspace(dbs, broker)
+	}
 
-	startTCP(ctx, s)
+	startTCP(ctx, dbs, broker, handlers)
 	if *enableTLS {
-		startTLS(ctx, s)
+		startTLS(ctx, dbs, broker, handlers)
 	}
 
 	select {
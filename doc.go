@@ -19,11 +19,21 @@ Store
 
 The store package defines the Store interface with functions to store key value pairs, retrieve its capacity and a list of last modified pairs.
 
-The store package also defines a MemoryStore struct with internal fields to track access and modify time of each key and their mutexes and a capacity counter also guarded by a mutex, this struct implements the Store interface the initilizer NewMemoryStore receives the desidered capacity for the MemoryStore.
+The store package also defines a MemoryStore struct that keeps its entries in a map and links each entry into an intrusive doubly-linked list in modify order, the map, the list and the capacity counter are guarded by a single mutex. This struct implements the Store interface and the initializer NewMemoryStore receives the desired capacity for the MemoryStore and options such as WithEvictionPolicy.
 
-The tracking of access time is used to implement an LRU (Least-Recently-Used) replacement policy and the modify time is used to implement the STREAM the results ordered by the last modified key.
+The modify list is used to implement the STREAM the results ordered by the last modified key. Keys are evicted when the capacity runs out by an EvictionPolicy, the package implements LRU (Least-Recently-Used), LFU (Least-Frequently-Used), FIFO, random and ARC (Adaptive Replacement Cache) policies and LRU is the default. Moving an entry to the front of a list or unlinking it is O(1) and so are all the policies, so GET, overwrites and eviction are O(1), adding or removing a key takes O(log n) to keep it in the hash-ordered index of SCAN. The ShardedStore hashes keys across independent MemoryStore shards with their own lock, capacity and eviction policy to remove the contention on a single mutex, a revision counter shared by the shards keeps the last modified order across shards.
 
-The heavy use of mutexes in this package is limitation and lock contention causes additional complexy making all the operations at least O(N).
+MemoryStore and ShardedStore implement store.Viewer to take read-only point-in-time views of their keys. Taking a view only pins the current revision, the shards of a ShardedStore are locked together for it. While the view is open the store saves an entry the first time it is written, expires or is removed after that revision, a change of deadline gives the key a new revision, strings are never modified in place and collections shared with a view are copied before their next write. View.Close stops saving the entries, so STREAM, snapshots and the append-only file rewrite read a consistent listing without blocking writers for the whole read or changing the access tracking of the eviction policy.
+
+With WithOverheadAccounting the capacity also counts the bytes of the keys and an estimate of the memory used by each entry, its slot in the map and its tracking by the eviction policy and the ordered index, so --capacity-bytes is closer to the memory used by kvserver, which always enables it. Stores implementing store.MemoryReporter estimate the memory used whether it is counted or not, MEMORY USAGE key replies the bytes used by a key and its value and MEMORY STATS replies name:value lines with the number of keys, the key, value and overhead bytes, their total and the available capacity.
+
+WithOnDelete sets a function called with the key, the value and the reason of every entry evicted for capacity, expired or deleted, WithOnEvict is only called for the strings evicted for capacity. Removed entries are queued while the store lock is held and reported once it is released, so the functions may call back into the store to write the entry to a slower tier or emit a metric.
+
+With the noeviction policy keys are never evicted, SET, CAS, the counters and the writes of collection elements fail with store.ErrOutOfCapacity when the value does not fit in the available capacity and the old value is kept. The server replies ERROR OOM followed by the reason and the connection stays open, so --eviction-policy noeviction keeps data that cannot be lost while clients decide what to delete. Custom policies report the same behaviour by implementing store.NonEvicting. The key being written is never evicted to make room for itself, the built-in policies spare it through store.Sparing so it keeps its place in the eviction order, custom policies that do not implement it see the key removed and added again.
+
+WithCompression compresses string values of at least a threshold with compress/flate, values are only kept compressed when they get smaller and GET decompresses them transparently, values are compressed before and decompressed after taking the store lock so other keys are not blocked. The capacity counts the compressed bytes so --capacity-bytes holds more data, --compress-above sets the threshold and --compress-level the flate level. INFO replies name:value lines with the available capacity and, for stores implementing store.Compressor, the number of compressed values, their raw and compressed bytes and the compression ratio.
+
+Stores implementing store.StatsReporter keep atomic counters of the gets with their hits and misses, the sets, the deletes, the evictions and the bytes evicted, Stats reads them without taking the store lock and reads from views are not counted. The periodic capacity line logged by the Commander adds the hits, misses, hit rate and evictions of the databases and INFO replies every counter, so --capacity-bytes can be tuned from the eviction and hit rates.
 
 Server
 
@@ -31,7 +41,38 @@ The server package defines Handlers, helper functions for new Listeners that can
 
 The handler.go file also defines a variable DefaultHandler that is a map initialized with the default handlers for the commands GET, SET, DELETE and STREAM.
 
+INCR, DECR, INCRBY and INCRBYFLOAT atomically update counters through the store.Updater interface, Update calls a function with the current value of a key and stores its result unless the key was modified in the meantime, the function is then called again. The lock is not held while the value is decompressed, the function runs and its result is compressed. Increments that overflow 64 bits or produce NaN or infinity are rejected, and values that are canonical integers are kept as an int64 in the entry and formatted back when they are read with GET.
+
+Keys may also hold lists, hashes, sets and sorted sets through the store.Collections interface with the commands LPUSH, RPOP, LRANGE, HSET, HGET, HGETALL, SADD, SISMEMBER, SMEMBERS, ZADD, ZRANGE and ZSCORE, a command on a key holding another type replies a WRONGTYPE error and SET replaces a value of any type. The elements of a collection count against the capacity, other keys are evicted to make room for new elements and a write whose elements cannot fit fails with store.ErrOutOfCapacity, sorted sets keep their members ordered by score in a skiplist, and the append-only file and snapshots record collections like strings.
+
+SCAN cursor [MATCH pattern] [COUNT n] iterates the keys incrementally through the store.Scanner interface, keys are returned in the order of a hash of the key and the cursor is the hash to continue from so it stays valid while the store is modified. The keys are kept ordered by hash so a call seeks to the cursor and looks at COUNT keys in O(log n + COUNT), it may reply fewer keys matching the pattern, even none, before the end. Patterns are matched by the glob package.
+
+RANGE start end [LIMIT n] [REVERSE] returns the keys between start and end inclusive with their values in lexicographic order through the store.Ranger interface. The WithOrderedIndex option, enabled with --ordered-index, keeps the keys of a MemoryStore in a skiplist so a range takes O(log n + k) while SET and DELETE become O(log n), stores without the index sort their keys on every RANGE.
+
+Every write gives the key a new version from the revision counter of the store, GETV replies the value with its version and CAS key version size only stores the value if the key still has that version and replies a conflict error otherwise, a version of 0 expects the key to not exist. Stores report versions through the store.Versioned interface.
+
+WAITKEY key [timeout] [since-version] parks the connection in the Commander until the key is modified or deleted and replies like GETV, a deleted key has version 0. With a since version it replies immediately when the key no longer has that version so clients do not miss changes between a GETV and the WAITKEY, TIMEOUT is replied after the timeout in seconds and a timeout of 0 waits forever. Waiters are woken through the store.Observable hook and released when the client disconnects or the server shuts down.
+
+The Databases type holds numbered stores with their own capacity, the number of databases is set with --databases and every connection starts on database 0. SELECT changes the database of the connection, SWAPDB exchanges two databases for every connection and FLUSHDB deletes the keys of the selected database at once. Both abort the transactions watching keys of the databases they change. The append-only file, snapshots and the disk engines only support a single database.
+
+Transactions are per connection, commands received after MULTI are queued by the Commander with their values and EXEC applies them atomically through the store.Transactional interface implemented by MemoryStore and ShardedStore. WATCH saves the revision of each key and EXEC replies ABORTED without running the queued commands if any watched key was modified since, a watched key that did not exist is also modified when any key of its shard is removed so a key added and removed again is not missed. DISCARD drops the queued commands.
+
+PUBLISH channel size sends a message to the subscribers of the channel and of the glob patterns matching it through a pubsub.Broker shared by the TCP and TLS listeners and replies the number of receivers. SUBSCRIBE and PSUBSCRIBE switch the connection into push mode where messages are written as MESSAGE channel size or PMESSAGE pattern channel size followed by the payload and only the subscription commands are accepted, the connection leaves push mode once UNSUBSCRIBE and PUNSUBSCRIBE removed every subscription. Publishers never wait for subscribers, each subscriber buffers up to --pubsub-buffer messages and a subscriber that falls further behind is disconnected.
+
+Stores implementing store.Observable report every write of a string or a collection, deletion, eviction and expiry of a key to their observers, MemoryStore and ShardedStore call them with the store lock held so events arrive in the order of the changes. With --notify-keyspace-events the changes are published to the channel __keyspace@<db>__:<key> with the event (set, del, evicted or expired) as message and to the channel __keyevent@<db>__:<event> with the key as message, so clients filter keys and events with PSUBSCRIBE patterns like __keyspace@0__:user:* or __keyevent@*__:expired.
+
 The implementation of this package was tricky and I ended up facing interesting issues with connection used in bufio Readers and re-used later for direct IO operations with different results due to buffered nature of the bufio. Once I realized that that I should perform Read operations on the buffer the implementation got simpler.
 
+AOF
+
+The aof package implements an append-only file, the Store type wraps a store.Store and records every SET, DELETE and expiry executed through the server handlers in a Log. SET with EX is a single record holding the value and its deadline, so a log cut after it never restores the key without its time to live. The log is synced to disk after every record, once per second or left to the operating system depending on the fsync policy, it is replayed with Replay at startup before the listeners are open and rewritten in the background from the contents of the store once it doubles in size.
+
+Snapshot
+
+The snapshot package writes compact binary snapshots of the whole store ending with a CRC-32 checksum, keys are written from the least to the most recently modified so loading a snapshot keeps the order used by STREAM. The Snapshotter writes each snapshot to a temporary file and renames it once it is synced, snapshots are saved with the SAVE and BGSAVE commands or on a timer and the newest valid snapshot is loaded at startup.
+
+LSM
+
+The lsm package implements a store.Store backed by an on-disk log-structured merge tree for datasets larger than the memory, it is selected with --engine=lsm. The store.TieredStore keeps hot keys in a bounded MemoryStore in front of a persistent store, keys evicted by the capacity limit are demoted to the persistent store instead of being deleted and promoted back on GET, --engine=tiered uses an LSM tree as the persistent store. Writes go to a write-ahead log and a memtable that is flushed in the background to immutable sorted tables with a block index and a bloom filter, tables are merged by a background leveled compaction and the MANIFEST file lists the tables of each level. With --engine=lsm the capacity limits the bytes of the memtables and tables, SET fails with store.ErrOutOfCapacity once it is reached and overwritten values count until a compaction drops them. Flags an engine does not use are rejected, --engine=lsm does not accept the eviction, sharding, ordered index and compression flags and --engine=tiered does not accept --shards and --ordered-index. The store/storetest package has the tests shared by every store.Store implementation.
 */
 package kvstore
@@ -0,0 +1,101 @@
+// Package glob matches strings against glob patterns.
+//
+// A pattern may contain the wildcards * that matches any sequence of bytes,
+// ? that matches a single byte and [class] that matches a byte in the class,
+// a class is a list of bytes and ranges like a-z and it is negated when it
+// starts with ^. A backslash escapes the next byte of the pattern. Unlike
+// path.Match the wildcards also match slashes.
+package glob
+
+// Match reports whether name matches pattern, malformed classes match
+// nothing.
+func Match(pattern, name string) bool {
+	// The position after the last * and the name position it was tried
+	// at, on a mismatch the star consumes one more byte.
+	star, next := -1, 0
+
+	p, n := 0, 0
+	for n < len(name) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				star, next = p+1, n
+				p++
+				continue
+			case '?':
+				p++
+				n++
+				continue
+			case '[':
+				if end, ok := matchClass(pattern, p, name[n]); ok {
+					p = end
+					n++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) && pattern[p+1] == name[n] {
+					p += 2
+					n++
+					continue
+				}
+			default:
+				if pattern[p] == name[n] {
+					p++
+					n++
+					continue
+				}
+			}
+		}
+
+		if star < 0 {
+			return false
+		}
+		next++
+		p, n = star, next
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass matches c against the class starting at pattern[start] and
+// returns the position after the class.
+func matchClass(pattern string, start int, c byte) (int, bool) {
+	i := start + 1
+	negated := i < len(pattern) && pattern[i] == '^'
+	if negated {
+		i++
+	}
+
+	matched := false
+	for first := true; ; first = false {
+		if i >= len(pattern) {
+			return 0, false
+		}
+		if pattern[i] == ']' && !first {
+			break
+		}
+
+		lo := pattern[i]
+		if lo == '\\' && i+1 < len(pattern) {
+			i++
+			lo = pattern[i]
+		}
+		hi := lo
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi = pattern[i+2]
+			if hi == '\\' && i+3 < len(pattern) {
+				i++
+				hi = pattern[i+2]
+			}
+			i += 2
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+		i++
+	}
+	return i + 1, matched != negated
+}
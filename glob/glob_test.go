@@ -0,0 +1,36 @@
+package glob
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	for _, tt := range []struct {
+		Pattern string
+		Name    string
+		Match   bool
+	}{
+		{"*", "", true},
+		{"*", "foo/bar", true},
+		{"foo", "foo", true},
+		{"foo", "foobar", false},
+		{"foo*", "foobar", true},
+		{"*bar", "foobar", true},
+		{"f*o*r", "foobar", true},
+		{"f*o*z", "foobar", false},
+		{"user:?", "user:1", true},
+		{"user:?", "user:12", false},
+		{"h[ae]llo", "hello", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"key[0-9]", "key7", true},
+		{"key[0-9]", "keyx", false},
+		{"[]]", "]", true},
+		{"a\\*", "a*", true},
+		{"a\\*", "ab", false},
+		{"[abc", "a", false},
+	} {
+		if got := Match(tt.Pattern, tt.Name); got != tt.Match {
+			t.Errorf("Match(%q, %q) = %v, expected %v", tt.Pattern, tt.Name, got, tt.Match)
+		}
+	}
+}
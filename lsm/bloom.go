@@ -0,0 +1,66 @@
+package lsm
+
+import "hash/fnv"
+
+// bloom is a bloom filter, the last byte holds the number of hash functions.
+type bloom []byte
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// newBloom builds a filter for the key hashes using bitsPerKey bits per key.
+func newBloom(hashes []uint32, bitsPerKey int) bloom {
+	// k = bitsPerKey * ln(2) minimizes the false positive rate.
+	k := bitsPerKey * 69 / 100
+	if k < 1 {
+		k = 1
+	}
+	if k > 30 {
+		k = 30
+	}
+
+	bits := len(hashes) * bitsPerKey
+	if bits < 64 {
+		bits = 64
+	}
+	n := (bits + 7) / 8
+	bits = n * 8
+
+	b := make(bloom, n+1)
+	b[n] = byte(k)
+	for _, h := range hashes {
+		// Double hashing generates the k hash values from h.
+		delta := h>>17 | h<<15
+		for i := 0; i < k; i++ {
+			pos := h % uint32(bits)
+			b[pos/8] |= 1 << (pos % 8)
+			h += delta
+		}
+	}
+	return b
+}
+
+// mayContain returns false if key is definitely not in the filter.
+func (b bloom) mayContain(key string) bool {
+	if len(b) < 2 {
+		return true
+	}
+
+	n := len(b) - 1
+	bits := uint32(n * 8)
+	k := int(b[n])
+
+	h := hashKey(key)
+	delta := h>>17 | h<<15
+	for i := 0; i < k; i++ {
+		pos := h % bits
+		if b[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+		h += delta
+	}
+	return true
+}
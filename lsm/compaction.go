@@ -0,0 +1,293 @@
+package lsm
+
+import (
+	"container/heap"
+	"os"
+	"sort"
+)
+
+// compaction merges the input tables of level into level+1.
+type compaction struct {
+	level  int
+	inputs [2][]*table
+}
+
+// maxLevelSize returns the maximum size in bytes of level.
+func (s *Store) maxLevelSize(level int) int64 {
+	size := int64(s.opts.LevelSize)
+	for i := 1; i < level; i++ {
+		size *= 10
+	}
+	return size
+}
+
+// pickCompaction returns the compaction for the level that exceeds its
+// limit by the largest ratio or nil if no level needs a compaction.
+func (s *Store) pickCompaction() *compaction {
+	s.vmu.RLock()
+	defer s.vmu.RUnlock()
+
+	level, best := -1, 1.0
+	if score := float64(len(s.levels[0])) / float64(s.opts.L0CompactionTrigger); score >= best {
+		level, best = 0, score
+	}
+
+	for i := 1; i < numLevels-1; i++ {
+		var size int64
+		for _, t := range s.levels[i] {
+			size += t.size
+		}
+
+		if score := float64(size) / float64(s.maxLevelSize(i)); score > best {
+			level, best = i, score
+		}
+	}
+
+	if level < 0 {
+		return nil
+	}
+
+	c := &compaction{level: level}
+	if level == 0 {
+		// Level 0 tables overlap so all of them are compacted together.
+		c.inputs[0] = append([]*table(nil), s.levels[0]...)
+	} else {
+		// Tables are picked in turns across the key space of the level.
+		tables := s.levels[level]
+		i := sort.Search(len(tables), func(i int) bool { return tables[i].smallest > s.cursor[level] })
+		if i == len(tables) {
+			i = 0
+		}
+		c.inputs[0] = []*table{tables[i]}
+	}
+
+	smallest, largest := keyRange(c.inputs[0])
+	for _, t := range s.levels[level+1] {
+		if t.overlaps(smallest, largest) {
+			c.inputs[1] = append(c.inputs[1], t)
+		}
+	}
+	return c
+}
+
+// compact merges the inputs into new tables of the next level keeping only
+// the newest version of every key.
+func (s *Store) compact(c *compaction) error {
+	output := c.level + 1
+
+	// Tombstones can be dropped when no deeper level may hold an older version.
+	s.vmu.RLock()
+	bottom := true
+	for _, tables := range s.levels[output+1:] {
+		if len(tables) > 0 {
+			bottom = false
+		}
+	}
+	s.vmu.RUnlock()
+
+	var iters []*tableIterator
+	for _, inputs := range c.inputs {
+		for _, t := range inputs {
+			iters = append(iters, t.iterator())
+		}
+	}
+
+	var (
+		outputs []*table
+		w       *tableWriter
+		num     uint64
+	)
+
+	abort := func() {
+		if w != nil {
+			w.abort()
+		}
+		for _, t := range outputs {
+			t.close()
+			os.Remove(t.f.Name())
+		}
+	}
+
+	finish := func() error {
+		if err := w.finish(); err != nil {
+			os.Remove(s.path(num, "sst"))
+			w = nil
+			return err
+		}
+		w = nil
+
+		t, err := openTable(s.path(num, "sst"), num)
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, t)
+		return nil
+	}
+
+	it := newMergeIterator(iters)
+	var last string
+	for first := true; it.next(); first = false {
+		r := it.cur
+		if !first && r.key == last {
+			continue
+		}
+		last = r.key
+
+		if r.kind == kindDelete && bottom {
+			continue
+		}
+
+		if w == nil {
+			num = s.newFileNumber()
+			var err error
+			if w, err = newTableWriter(s.path(num, "sst"), s.opts.BlockSize, s.opts.BloomBitsPerKey); err != nil {
+				abort()
+				return err
+			}
+		}
+
+		if err := w.add(r); err != nil {
+			abort()
+			return err
+		}
+
+		if w.size() >= uint64(s.opts.TableSize) {
+			if err := finish(); err != nil {
+				abort()
+				return err
+			}
+		}
+	}
+
+	if err := it.err(); err != nil {
+		abort()
+		return err
+	}
+
+	if w != nil {
+		if err := finish(); err != nil {
+			abort()
+			return err
+		}
+	}
+
+	s.install(c, outputs)
+	return nil
+}
+
+// install replaces the compaction inputs with its outputs and removes the input files.
+func (s *Store) install(c *compaction, outputs []*table) error {
+	s.vmu.Lock()
+
+	removed := make(map[*table]bool)
+	for _, inputs := range c.inputs {
+		for _, t := range inputs {
+			removed[t] = true
+		}
+	}
+
+	for i, level := range []int{c.level, c.level + 1} {
+		var kept []*table
+		for _, t := range s.levels[level] {
+			if !removed[t] {
+				kept = append(kept, t)
+			}
+		}
+		if i == 1 {
+			kept = append(kept, outputs...)
+			sort.Slice(kept, func(i, j int) bool { return kept[i].smallest < kept[j].smallest })
+		}
+		s.levels[level] = kept
+	}
+
+	if c.level > 0 {
+		_, s.cursor[c.level] = keyRange(c.inputs[0])
+	}
+
+	err := s.saveManifest()
+	s.vmu.Unlock()
+
+	// No reader holds the input tables once the write lock is released.
+	for t := range removed {
+		t.close()
+		os.Remove(t.f.Name())
+	}
+	return err
+}
+
+func keyRange(tables []*table) (smallest, largest string) {
+	for i, t := range tables {
+		if i == 0 || t.smallest < smallest {
+			smallest = t.smallest
+		}
+		if i == 0 || t.largest > largest {
+			largest = t.largest
+		}
+	}
+	return smallest, largest
+}
+
+// mergeIterator merges table iterators in key order, records with the same
+// key are returned from the newest to the oldest.
+type mergeIterator struct {
+	h   iteratorHeap
+	cur record
+	e   error
+}
+
+func newMergeIterator(iters []*tableIterator) *mergeIterator {
+	m := &mergeIterator{}
+	for _, it := range iters {
+		m.push(it)
+	}
+	heap.Init(&m.h)
+	return m
+}
+
+func (m *mergeIterator) push(it *tableIterator) {
+	if it.next() {
+		m.h = append(m.h, it)
+	} else if it.err != nil {
+		m.e = it.err
+	}
+}
+
+func (m *mergeIterator) next() bool {
+	if len(m.h) == 0 || m.e != nil {
+		return false
+	}
+
+	it := m.h[0]
+	m.cur = it.cur
+	if it.next() {
+		heap.Fix(&m.h, 0)
+	} else {
+		heap.Pop(&m.h)
+		if it.err != nil {
+			m.e = it.err
+		}
+	}
+	return true
+}
+
+func (m *mergeIterator) err() error {
+	return m.e
+}
+
+type iteratorHeap []*tableIterator
+
+func (h iteratorHeap) Len() int { return len(h) }
+func (h iteratorHeap) Less(i, j int) bool {
+	if h[i].cur.key != h[j].cur.key {
+		return h[i].cur.key < h[j].cur.key
+	}
+	return h[i].cur.seq > h[j].cur.seq
+}
+func (h iteratorHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *iteratorHeap) Push(x interface{}) { *h = append(*h, x.(*tableIterator)) }
+func (h *iteratorHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,24 @@
+/*
+Package lsm implements a store.Store backed by an on-disk log-structured merge tree.
+
+Writes are appended to a write-ahead log and applied to an in-memory memtable,
+once the memtable is full it is frozen and flushed in the background to an
+immutable sorted table (SSTable) in level 0. Every table is made of data blocks,
+a block index with the last key of each block and a bloom filter so lookups for
+missing keys rarely touch the disk.
+
+Tables in level 0 may overlap, when there are too many of them they are merged
+with the overlapping tables of level 1, every level after level 0 is a sorted run
+of non-overlapping tables ten times larger than the previous level and a level
+that grows past its size is compacted into the next one. Compactions run in the
+background and keep only the newest version of each key, deletions are recorded
+as tombstones that are dropped once they reach the last level.
+
+The MANIFEST file lists the tables of each level and is replaced atomically after
+every flush and compaction.
+
+Options.Capacity limits the bytes of the memtables and tables, writes fail with
+store.ErrOutOfCapacity once they would go past it while deletes are always
+accepted. Overwritten and deleted values count until a compaction drops them.
+*/
+package lsm
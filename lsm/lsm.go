@@ -0,0 +1,522 @@
+package lsm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rsampaio/kvstore/store"
+)
+
+const numLevels = 7
+
+// Options configures a Store, zero values are replaced by their defaults.
+type Options struct {
+	// Capacity is the number of bytes reported by Cap before any write,
+	// writes fail with store.ErrOutOfCapacity once the memtables and the
+	// tables would use more, zero disables the limit.
+	Capacity int
+	// MemtableSize is the size of the memtable before it is flushed, default 4MB.
+	MemtableSize int
+	// TableSize is the target size of the tables written by compactions, default 2MB.
+	TableSize int
+	// BlockSize is the size of the table data blocks, default 4KB.
+	BlockSize int
+	// BloomBitsPerKey is the size of the bloom filters, default 10 bits per key.
+	BloomBitsPerKey int
+	// L0CompactionTrigger is the number of level 0 tables that starts a compaction, default 4.
+	L0CompactionTrigger int
+	// LevelSize is the maximum size of level 1, each next level is ten times larger, default 10MB.
+	LevelSize int
+	// SyncWrites syncs the write-ahead log after every write.
+	SyncWrites bool
+}
+
+func (o *Options) defaults() {
+	if o.MemtableSize <= 0 {
+		o.MemtableSize = 4 << 20
+	}
+	if o.TableSize <= 0 {
+		o.TableSize = 2 << 20
+	}
+	if o.BlockSize <= 0 {
+		o.BlockSize = 4 << 10
+	}
+	if o.BloomBitsPerKey <= 0 {
+		o.BloomBitsPerKey = 10
+	}
+	if o.L0CompactionTrigger <= 0 {
+		o.L0CompactionTrigger = 4
+	}
+	if o.LevelSize <= 0 {
+		o.LevelSize = 10 << 20
+	}
+}
+
+// Store implements the store.Store interface with a log-structured merge tree.
+type Store struct {
+	dir  string
+	opts Options
+
+	// mu guards the memtables, the write-ahead log and the sequence number,
+	// cond is signaled when the immutable memtable is flushed.
+	mu   sync.Mutex
+	cond *sync.Cond
+	mem  *memtable
+	imm  *memtable
+	wal  *wal
+	seq  uint64
+
+	// vmu guards the tables of each level, level 0 is ordered from the
+	// oldest to the newest table and other levels are ordered by key.
+	vmu    sync.RWMutex
+	levels [numLevels][]*table
+	cursor [numLevels]string
+
+	nextFile uint64
+
+	work chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open opens the store in dir creating it if needed, tables listed in the
+// manifest are opened and write-ahead logs left by a previous run are
+// replayed and flushed to level 0.
+func Open(dir string, opts Options) (*Store, error) {
+	opts.defaults()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	m, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		dir:      dir,
+		opts:     opts,
+		nextFile: m.NextFile,
+		work:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	live := map[uint64]bool{}
+	for level, nums := range m.Levels {
+		for _, num := range nums {
+			t, err := openTable(s.path(num, "sst"), num)
+			if err != nil {
+				s.closeTables()
+				return nil, fmt.Errorf("lsm: table %d: %v", num, err)
+			}
+
+			s.levels[level] = append(s.levels[level], t)
+			live[num] = true
+			if t.maxSeq > s.seq {
+				s.seq = t.maxSeq
+			}
+		}
+	}
+
+	if err := s.recover(live); err != nil {
+		s.closeTables()
+		return nil, err
+	}
+
+	s.wg.Add(1)
+	go s.background()
+	s.schedule()
+	return s, nil
+}
+
+// recover replays the write-ahead logs, flushes them and removes files
+// that are not referenced by the manifest.
+func (s *Store) recover(live map[uint64]bool) error {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	var wals []uint64
+	for _, fi := range files {
+		name := fi.Name()
+		ext := filepath.Ext(name)
+		num, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case ext == ".log":
+			wals = append(wals, num)
+		case ext == ".sst" && !live[num]:
+			// Left by a flush or compaction that did not finish.
+			os.Remove(filepath.Join(s.dir, name))
+		}
+
+		if num >= s.nextFile {
+			s.nextFile = num + 1
+		}
+	}
+	sort.Slice(wals, func(i, j int) bool { return wals[i] < wals[j] })
+
+	mem := newMemtable(0)
+	for _, num := range wals {
+		err := replayWAL(s.path(num, "log"), func(r record) {
+			mem.put(r)
+			if r.seq > s.seq {
+				s.seq = r.seq
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(mem.records) > 0 {
+		if err := s.flush(mem); err != nil {
+			return err
+		}
+	}
+
+	for _, num := range wals {
+		os.Remove(s.path(num, "log"))
+	}
+
+	num := s.newFileNumber()
+	w, err := createWAL(s.path(num, "log"), s.opts.SyncWrites)
+	if err != nil {
+		return err
+	}
+	s.wal = w
+	s.mem = newMemtable(num)
+	return nil
+}
+
+// Cap returns the configured capacity minus the bytes used by the tables and
+// memtables, overwritten and deleted values are counted until a compaction
+// drops them.
+func (s *Store) Cap() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.opts.Capacity - s.used()
+}
+
+// used returns the bytes of the memtables and the tables, s.mu must be held.
+func (s *Store) used() int {
+	used := s.mem.size
+	if s.imm != nil {
+		used += s.imm.size
+	}
+
+	s.vmu.RLock()
+	defer s.vmu.RUnlock()
+	for _, tables := range s.levels {
+		for _, t := range tables {
+			used += int(t.size)
+		}
+	}
+	return used
+}
+
+// Set writes the key/value to the write-ahead log and the memtable.
+func (s *Store) Set(key string, value []byte) error {
+	return s.write(record{key: key, value: value, kind: kindSet})
+}
+
+// Delete writes a tombstone for key.
+func (s *Store) Delete(key string) error {
+	return s.write(record{key: key, kind: kindDelete})
+}
+
+func (s *Store) write(r record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Tombstones are always written so deletes can make room.
+	if s.opts.Capacity > 0 && r.kind == kindSet && s.used()+len(r.key)+len(r.value) > s.opts.Capacity {
+		return store.ErrOutOfCapacity
+	}
+
+	if err := s.makeRoom(); err != nil {
+		return err
+	}
+
+	s.seq++
+	r.seq = s.seq
+	if err := s.wal.append(r); err != nil {
+		return err
+	}
+	s.mem.put(r)
+	return nil
+}
+
+// makeRoom freezes a full memtable and switches to a new write-ahead log,
+// it waits for the previous frozen memtable to be flushed first, s.mu must be held.
+func (s *Store) makeRoom() error {
+	if s.mem.size < s.opts.MemtableSize {
+		return nil
+	}
+
+	for s.imm != nil {
+		s.cond.Wait()
+	}
+
+	num := s.newFileNumber()
+	w, err := createWAL(s.path(num, "log"), s.opts.SyncWrites)
+	if err != nil {
+		return err
+	}
+
+	s.wal.close()
+	s.wal = w
+	s.imm = s.mem
+	s.mem = newMemtable(num)
+	s.schedule()
+	return nil
+}
+
+// Get returns the newest value of key looking at the memtables first and
+// then at the tables from level 0 to the last level.
+func (s *Store) Get(key string) ([]byte, bool) {
+	r, ok := s.get(key)
+	if !ok || r.kind == kindDelete {
+		return nil, false
+	}
+	return r.value, true
+}
+
+func (s *Store) get(key string) (record, bool) {
+	s.mu.Lock()
+	if r, ok := s.mem.get(key); ok {
+		s.mu.Unlock()
+		return r, true
+	}
+	if s.imm != nil {
+		if r, ok := s.imm.get(key); ok {
+			s.mu.Unlock()
+			return r, true
+		}
+	}
+	s.mu.Unlock()
+
+	s.vmu.RLock()
+	defer s.vmu.RUnlock()
+
+	for i := len(s.levels[0]) - 1; i >= 0; i-- {
+		if r, ok := s.tableGet(s.levels[0][i], key); ok {
+			return r, true
+		}
+	}
+
+	for _, tables := range s.levels[1:] {
+		i := sort.Search(len(tables), func(i int) bool { return tables[i].largest >= key })
+		if i < len(tables) {
+			if r, ok := s.tableGet(tables[i], key); ok {
+				return r, true
+			}
+		}
+	}
+	return record{}, false
+}
+
+func (s *Store) tableGet(t *table, key string) (record, bool) {
+	r, ok, err := t.get(key)
+	if err != nil {
+		fmt.Printf("lsm-read table=%d error=%v\n", t.num, err)
+	}
+	return r, ok
+}
+
+// GetLastModifiedKeys returns all keys ordered from the most to the least
+// recently modified, it reads every table so it is an expensive operation.
+func (s *Store) GetLastModifiedKeys() []string {
+	latest := make(map[string]record)
+	keep := func(r record) {
+		if old, ok := latest[r.key]; !ok || r.seq > old.seq {
+			latest[r.key] = r
+		}
+	}
+
+	s.mu.Lock()
+	for _, m := range []*memtable{s.mem, s.imm} {
+		if m != nil {
+			for _, r := range m.records {
+				keep(r)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	s.vmu.RLock()
+	for _, tables := range s.levels {
+		for _, t := range tables {
+			it := t.iterator()
+			for it.next() {
+				keep(record{key: it.cur.key, seq: it.cur.seq, kind: it.cur.kind})
+			}
+		}
+	}
+	s.vmu.RUnlock()
+
+	live := make([]record, 0, len(latest))
+	for _, r := range latest {
+		if r.kind == kindSet {
+			live = append(live, r)
+		}
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].seq > live[j].seq })
+
+	keys := make([]string, len(live))
+	for i, r := range live {
+		keys[i] = r.key
+	}
+	return keys
+}
+
+// Close stops the background work and closes the files, writes in the
+// memtable are kept in the write-ahead log and recovered by Open.
+func (s *Store) Close() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+		close(s.done)
+	}
+	s.wg.Wait()
+
+	s.mu.Lock()
+	err := s.wal.close()
+	s.mu.Unlock()
+
+	s.closeTables()
+	return err
+}
+
+func (s *Store) closeTables() {
+	s.vmu.Lock()
+	defer s.vmu.Unlock()
+	for _, tables := range s.levels {
+		for _, t := range tables {
+			t.close()
+		}
+	}
+}
+
+// schedule wakes up the background goroutine.
+func (s *Store) schedule() {
+	select {
+	case s.work <- struct{}{}:
+	default:
+	}
+}
+
+// background flushes the frozen memtable and runs compactions.
+func (s *Store) background() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.work:
+		}
+
+		s.mu.Lock()
+		imm := s.imm
+		s.mu.Unlock()
+
+		if imm != nil {
+			if err := s.flush(imm); err != nil {
+				fmt.Printf("lsm-flush error=%v\n", err)
+				time.AfterFunc(time.Second, s.schedule)
+				continue
+			}
+
+			s.mu.Lock()
+			s.imm = nil
+			s.cond.Broadcast()
+			s.mu.Unlock()
+			os.Remove(s.path(imm.wal, "log"))
+		}
+
+		for {
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+
+			c := s.pickCompaction()
+			if c == nil {
+				break
+			}
+
+			if err := s.compact(c); err != nil {
+				fmt.Printf("lsm-compaction level=%d error=%v\n", c.level, err)
+				break
+			}
+		}
+	}
+}
+
+// flush writes the memtable to a new level 0 table.
+func (s *Store) flush(m *memtable) error {
+	num := s.newFileNumber()
+	w, err := newTableWriter(s.path(num, "sst"), s.opts.BlockSize, s.opts.BloomBitsPerKey)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range m.sorted() {
+		if err := w.add(r); err != nil {
+			w.abort()
+			return err
+		}
+	}
+
+	if err := w.finish(); err != nil {
+		os.Remove(s.path(num, "sst"))
+		return err
+	}
+
+	t, err := openTable(s.path(num, "sst"), num)
+	if err != nil {
+		return err
+	}
+
+	s.vmu.Lock()
+	defer s.vmu.Unlock()
+	s.levels[0] = append(s.levels[0], t)
+	return s.saveManifest()
+}
+
+// saveManifest writes the current tables to the manifest, s.vmu must be held.
+func (s *Store) saveManifest() error {
+	m := &manifest{NextFile: atomic.LoadUint64(&s.nextFile)}
+	for _, tables := range s.levels {
+		nums := make([]uint64, len(tables))
+		for i, t := range tables {
+			nums[i] = t.num
+		}
+		m.Levels = append(m.Levels, nums)
+	}
+	return writeManifest(s.dir, m)
+}
+
+func (s *Store) newFileNumber() uint64 {
+	return atomic.AddUint64(&s.nextFile, 1) - 1
+}
+
+func (s *Store) path(num uint64, ext string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%06d.%s", num, ext))
+}
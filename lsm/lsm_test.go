@@ -0,0 +1,147 @@
+package lsm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rsampaio/kvstore/store"
+	"github.com/rsampaio/kvstore/store/storetest"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "lsm")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// smallOptions makes flushes and compactions happen after a few writes.
+var smallOptions = Options{
+	Capacity:            1 << 20,
+	MemtableSize:        256,
+	TableSize:           512,
+	BlockSize:           64,
+	L0CompactionTrigger: 2,
+	LevelSize:           1024,
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s, err := Open(tempDir(t), smallOptions)
+		if err != nil {
+			t.Fatalf("unexpected open error: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestReopen(t *testing.T) {
+	dir := tempDir(t)
+	s, err := Open(dir, smallOptions)
+	if err != nil {
+		t.Fatalf("unexpected open error: %v", err)
+	}
+
+	for i := 0; i < 500; i++ {
+		s.Set(fmt.Sprintf("key%03d", i%200), []byte(fmt.Sprintf("value%d", i)))
+	}
+	for i := 0; i < 200; i += 3 {
+		s.Delete(fmt.Sprintf("key%03d", i))
+	}
+	s.Close()
+
+	s, err = Open(dir, smallOptions)
+	if err != nil {
+		t.Fatalf("unexpected reopen error: %v", err)
+	}
+	defer s.Close()
+
+	for i := 300; i < 500; i++ {
+		key := fmt.Sprintf("key%03d", i%200)
+		v, ok := s.Get(key)
+		if i%200%3 == 0 {
+			if ok {
+				t.Errorf("unexpected deleted key %v found", key)
+			}
+			continue
+		}
+
+		if want := fmt.Sprintf("value%d", i); !ok || string(v) != want {
+			t.Errorf("%v: got %q %v, wants: %q", key, v, ok, want)
+		}
+	}
+
+	if got := s.GetLastModifiedKeys(); len(got) != 133 || got[0] != "key098" {
+		t.Errorf("unexpected last modified keys %d %v", len(got), got[:1])
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	s, err := Open(tempDir(t), smallOptions)
+	if err != nil {
+		t.Fatalf("unexpected open error: %v", err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 2000; i++ {
+		s.Set(fmt.Sprintf("key%04d", i%300), []byte(fmt.Sprintf("value%d", i)))
+	}
+
+	// Wait for the background flushes and compactions to settle.
+	for s.schedule(); s.pickCompaction() != nil; s.schedule() {
+		time.Sleep(time.Millisecond)
+	}
+
+	s.vmu.RLock()
+	deeper := 0
+	for _, tables := range s.levels[1:] {
+		deeper += len(tables)
+		for i := 1; i < len(tables); i++ {
+			if tables[i-1].largest >= tables[i].smallest {
+				t.Errorf("overlapping tables %v and %v", tables[i-1].num, tables[i].num)
+			}
+		}
+	}
+	s.vmu.RUnlock()
+
+	if deeper == 0 {
+		t.Errorf("expected tables to be compacted past level 0")
+	}
+
+	for i := 1700; i < 2000; i++ {
+		key := fmt.Sprintf("key%04d", i%300)
+		if v, ok := s.Get(key); !ok || string(v) != fmt.Sprintf("value%d", i) {
+			t.Errorf("%v: got %q %v", key, v, ok)
+		}
+	}
+}
+
+func TestBloom(t *testing.T) {
+	var hashes []uint32
+	for i := 0; i < 1000; i++ {
+		hashes = append(hashes, hashKey(fmt.Sprintf("key%d", i)))
+	}
+	b := newBloom(hashes, 10)
+
+	for i := 0; i < 1000; i++ {
+		if !b.mayContain(fmt.Sprintf("key%d", i)) {
+			t.Fatalf("false negative for key%d", i)
+		}
+	}
+
+	fp := 0
+	for i := 0; i < 1000; i++ {
+		if b.mayContain(fmt.Sprintf("other%d", i)) {
+			fp++
+		}
+	}
+	if fp > 50 {
+		t.Errorf("too many false positives %d", fp)
+	}
+}
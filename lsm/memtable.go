@@ -0,0 +1,39 @@
+package lsm
+
+import "sort"
+
+// memtable holds the most recent writes in memory until it is flushed.
+type memtable struct {
+	records map[string]record
+	size    int
+
+	// wal is the number of the write-ahead log holding the memtable records.
+	wal uint64
+}
+
+func newMemtable(wal uint64) *memtable {
+	return &memtable{records: make(map[string]record), wal: wal}
+}
+
+func (m *memtable) put(r record) {
+	if old, ok := m.records[r.key]; ok {
+		m.size -= len(old.key) + len(old.value)
+	}
+	m.records[r.key] = r
+	m.size += len(r.key) + len(r.value)
+}
+
+func (m *memtable) get(key string) (record, bool) {
+	r, ok := m.records[key]
+	return r, ok
+}
+
+// sorted returns the records ordered by key.
+func (m *memtable) sorted() []record {
+	r := make([]record, 0, len(m.records))
+	for _, rec := range m.records {
+		r = append(r, rec)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].key < r[j].key })
+	return r
+}
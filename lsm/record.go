@@ -0,0 +1,84 @@
+package lsm
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// kind distinguishes values from deletion tombstones.
+type kind byte
+
+const (
+	kindDelete kind = iota
+	kindSet
+)
+
+// record is a version of a key, records with higher seq are newer.
+type record struct {
+	key   string
+	value []byte
+	seq   uint64
+	kind  kind
+}
+
+var errCorrupted = errors.New("lsm: corrupted record")
+
+// appendRecord encodes r at the end of dst.
+func appendRecord(dst []byte, r record) []byte {
+	dst = append(dst, byte(r.kind))
+	dst = appendUvarint(dst, r.seq)
+	dst = appendBytes(dst, []byte(r.key))
+	return appendBytes(dst, r.value)
+}
+
+func appendUvarint(dst []byte, n uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(dst, buf[:binary.PutUvarint(buf[:], n)]...)
+}
+
+func appendBytes(dst []byte, b []byte) []byte {
+	return append(appendUvarint(dst, uint64(len(b))), b...)
+}
+
+// decodeRecord decodes the record at the start of b and returns its encoded size.
+func decodeRecord(b []byte) (record, int, error) {
+	var r record
+	if len(b) < 1 {
+		return r, 0, errCorrupted
+	}
+	r.kind = kind(b[0])
+	n := 1
+
+	seq, m := binary.Uvarint(b[n:])
+	if m <= 0 {
+		return r, 0, errCorrupted
+	}
+	r.seq = seq
+	n += m
+
+	key, m := decodeBytes(b[n:])
+	if m <= 0 {
+		return r, 0, errCorrupted
+	}
+	r.key = string(key)
+	n += m
+
+	value, m := decodeBytes(b[n:])
+	if m <= 0 {
+		return r, 0, errCorrupted
+	}
+	if r.kind == kindSet {
+		r.value = value
+	}
+	return r, n + m, nil
+}
+
+// decodeBytes decodes a length prefixed byte slice, the returned slice
+// shares memory with b.
+func decodeBytes(b []byte) ([]byte, int) {
+	l, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < l {
+		return nil, 0
+	}
+	return b[n : n+int(l)], n + int(l)
+}
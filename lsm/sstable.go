@@ -0,0 +1,373 @@
+package lsm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"sort"
+)
+
+// tableMagic ends every table file.
+const tableMagic uint64 = 0x6b7673746f72652e
+
+const footerSize = 40
+
+// indexEntry locates a data block and holds its last key.
+type indexEntry struct {
+	lastKey string
+	offset  uint64
+	size    uint64
+}
+
+// tableWriter writes records sorted by key to a new table file.
+//
+// The file is a sequence of data blocks followed by the index block, the
+// bloom filter and a fixed size footer with their offsets, every block ends
+// with the CRC-32 of its contents.
+type tableWriter struct {
+	f *os.File
+	w *bufio.Writer
+
+	blockSize  int
+	bitsPerKey int
+
+	block   []byte
+	lastKey string
+	offset  uint64
+	index   []indexEntry
+	hashes  []uint32
+
+	smallest string
+	maxSeq   uint64
+	count    int
+}
+
+func newTableWriter(path string, blockSize, bitsPerKey int) (*tableWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tableWriter{
+		f:          f,
+		w:          bufio.NewWriter(f),
+		blockSize:  blockSize,
+		bitsPerKey: bitsPerKey,
+	}, nil
+}
+
+// add appends r, records must be added in increasing key order.
+func (t *tableWriter) add(r record) error {
+	if t.count == 0 {
+		t.smallest = r.key
+	}
+	if r.seq > t.maxSeq {
+		t.maxSeq = r.seq
+	}
+	t.count++
+	t.lastKey = r.key
+	t.hashes = append(t.hashes, hashKey(r.key))
+
+	t.block = appendRecord(t.block, r)
+	if len(t.block) >= t.blockSize {
+		return t.flushBlock()
+	}
+	return nil
+}
+
+// size returns the number of bytes written so far.
+func (t *tableWriter) size() uint64 {
+	return t.offset + uint64(len(t.block))
+}
+
+func (t *tableWriter) flushBlock() error {
+	if len(t.block) == 0 {
+		return nil
+	}
+
+	n, err := t.writeBlock(t.block)
+	if err != nil {
+		return err
+	}
+
+	t.index = append(t.index, indexEntry{lastKey: t.lastKey, offset: t.offset, size: n})
+	t.offset += n
+	t.block = t.block[:0]
+	return nil
+}
+
+func (t *tableWriter) writeBlock(b []byte) (uint64, error) {
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(b))
+
+	if _, err := t.w.Write(b); err != nil {
+		return 0, err
+	}
+	if _, err := t.w.Write(crc[:]); err != nil {
+		return 0, err
+	}
+	return uint64(len(b) + 4), nil
+}
+
+// finish writes the index, the bloom filter and the footer and syncs the file.
+func (t *tableWriter) finish() error {
+	if err := t.flushBlock(); err != nil {
+		t.f.Close()
+		return err
+	}
+
+	var idx []byte
+	idx = appendBytes(idx, []byte(t.smallest))
+	idx = appendBytes(idx, []byte(t.lastKey))
+	idx = appendUvarint(idx, t.maxSeq)
+	idx = appendUvarint(idx, uint64(len(t.index)))
+	for _, e := range t.index {
+		idx = appendBytes(idx, []byte(e.lastKey))
+		idx = appendUvarint(idx, e.offset)
+		idx = appendUvarint(idx, e.size)
+	}
+
+	indexOffset := t.offset
+	indexSize, err := t.writeBlock(idx)
+	if err != nil {
+		t.f.Close()
+		return err
+	}
+
+	bloomOffset := indexOffset + indexSize
+	bloomSize, err := t.writeBlock(newBloom(t.hashes, t.bitsPerKey))
+	if err != nil {
+		t.f.Close()
+		return err
+	}
+
+	var footer [footerSize]byte
+	binary.BigEndian.PutUint64(footer[0:], indexOffset)
+	binary.BigEndian.PutUint64(footer[8:], indexSize)
+	binary.BigEndian.PutUint64(footer[16:], bloomOffset)
+	binary.BigEndian.PutUint64(footer[24:], bloomSize)
+	binary.BigEndian.PutUint64(footer[32:], tableMagic)
+	t.w.Write(footer[:])
+
+	if err := t.w.Flush(); err != nil {
+		t.f.Close()
+		return err
+	}
+
+	if err := t.f.Sync(); err != nil {
+		t.f.Close()
+		return err
+	}
+	return t.f.Close()
+}
+
+// abort closes and removes the unfinished table.
+func (t *tableWriter) abort() {
+	t.f.Close()
+	os.Remove(t.f.Name())
+}
+
+// table is an open immutable table file.
+type table struct {
+	num  uint64
+	f    *os.File
+	size int64
+
+	smallest, largest string
+	maxSeq            uint64
+
+	index []indexEntry
+	bloom bloom
+}
+
+var errBadTable = errors.New("lsm: corrupted table")
+
+func openTable(path string, num uint64) (*table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := readTable(f, num)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func readTable(f *os.File, num uint64) (*table, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.Size() < footerSize {
+		return nil, errBadTable
+	}
+
+	var footer [footerSize]byte
+	if _, err := f.ReadAt(footer[:], fi.Size()-footerSize); err != nil {
+		return nil, err
+	}
+
+	if binary.BigEndian.Uint64(footer[32:]) != tableMagic {
+		return nil, errBadTable
+	}
+
+	t := &table{num: num, f: f, size: fi.Size()}
+
+	idx, err := t.readBlock(binary.BigEndian.Uint64(footer[0:]), binary.BigEndian.Uint64(footer[8:]))
+	if err != nil {
+		return nil, err
+	}
+
+	if t.bloom, err = t.readBlock(binary.BigEndian.Uint64(footer[16:]), binary.BigEndian.Uint64(footer[24:])); err != nil {
+		return nil, err
+	}
+
+	smallest, n := decodeBytes(idx)
+	if n <= 0 {
+		return nil, errBadTable
+	}
+	idx = idx[n:]
+
+	largest, n := decodeBytes(idx)
+	if n <= 0 {
+		return nil, errBadTable
+	}
+	idx = idx[n:]
+	t.smallest, t.largest = string(smallest), string(largest)
+
+	if t.maxSeq, n = binary.Uvarint(idx); n <= 0 {
+		return nil, errBadTable
+	}
+	idx = idx[n:]
+
+	count, n := binary.Uvarint(idx)
+	if n <= 0 {
+		return nil, errBadTable
+	}
+	idx = idx[n:]
+
+	t.index = make([]indexEntry, count)
+	for i := range t.index {
+		key, n := decodeBytes(idx)
+		if n <= 0 {
+			return nil, errBadTable
+		}
+		idx = idx[n:]
+
+		offset, n := binary.Uvarint(idx)
+		if n <= 0 {
+			return nil, errBadTable
+		}
+		idx = idx[n:]
+
+		size, n := binary.Uvarint(idx)
+		if n <= 0 {
+			return nil, errBadTable
+		}
+		idx = idx[n:]
+
+		t.index[i] = indexEntry{lastKey: string(key), offset: offset, size: size}
+	}
+	return t, nil
+}
+
+// readBlock reads and checks the block at offset and returns its contents.
+func (t *table) readBlock(offset, size uint64) ([]byte, error) {
+	if size < 4 {
+		return nil, errBadTable
+	}
+
+	b := make([]byte, size)
+	if _, err := t.f.ReadAt(b, int64(offset)); err != nil {
+		return nil, err
+	}
+
+	data := b[:size-4]
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(b[size-4:]) {
+		return nil, errBadTable
+	}
+	return data, nil
+}
+
+// get returns the record of key in the table.
+func (t *table) get(key string) (record, bool, error) {
+	if key < t.smallest || key > t.largest || !t.bloom.mayContain(key) {
+		return record{}, false, nil
+	}
+
+	i := sort.Search(len(t.index), func(i int) bool { return t.index[i].lastKey >= key })
+	if i == len(t.index) {
+		return record{}, false, nil
+	}
+
+	b, err := t.readBlock(t.index[i].offset, t.index[i].size)
+	if err != nil {
+		return record{}, false, err
+	}
+
+	for len(b) > 0 {
+		r, n, err := decodeRecord(b)
+		if err != nil {
+			return record{}, false, err
+		}
+		if r.key == key {
+			return r, true, nil
+		}
+		if r.key > key {
+			break
+		}
+		b = b[n:]
+	}
+	return record{}, false, nil
+}
+
+func (t *table) overlaps(smallest, largest string) bool {
+	return t.largest >= smallest && t.smallest <= largest
+}
+
+func (t *table) close() error {
+	return t.f.Close()
+}
+
+// tableIterator iterates over the records of a table in key order.
+type tableIterator struct {
+	t     *table
+	block int
+	buf   []byte
+	cur   record
+	err   error
+}
+
+func (t *table) iterator() *tableIterator {
+	return &tableIterator{t: t}
+}
+
+// next advances to the next record and returns false at the end or on error.
+func (it *tableIterator) next() bool {
+	for len(it.buf) == 0 {
+		if it.err != nil || it.block >= len(it.t.index) {
+			return false
+		}
+
+		e := it.t.index[it.block]
+		it.block++
+		if it.buf, it.err = it.t.readBlock(e.offset, e.size); it.err != nil {
+			return false
+		}
+	}
+
+	r, n, err := decodeRecord(it.buf)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.cur = r
+	it.buf = it.buf[n:]
+	return true
+}
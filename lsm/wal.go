@@ -0,0 +1,83 @@
+package lsm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// wal is a write-ahead log, each entry is the CRC-32 and the length of
+// an encoded record followed by the record.
+type wal struct {
+	f    *os.File
+	sync bool
+	buf  []byte
+}
+
+func createWAL(path string, sync bool) (*wal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &wal{f: f, sync: sync}, nil
+}
+
+func (w *wal) append(r record) error {
+	w.buf = appendRecord(w.buf[:0], r)
+
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], crc32.ChecksumIEEE(w.buf))
+	binary.BigEndian.PutUint32(header[4:], uint32(len(w.buf)))
+
+	if _, err := w.f.Write(append(header[:], w.buf...)); err != nil {
+		return err
+	}
+
+	if w.sync {
+		return w.f.Sync()
+	}
+	return nil
+}
+
+func (w *wal) close() error {
+	if err := w.f.Sync(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// replayWAL calls fn for every record of the log at path, it stops at the
+// first incomplete or corrupted entry left by a crash in the middle of a write.
+func replayWAL(path string, fn func(record)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil
+		}
+
+		b := make([]byte, binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil
+		}
+
+		if crc32.ChecksumIEEE(b) != binary.BigEndian.Uint32(header[:4]) {
+			return nil
+		}
+
+		rec, _, err := decodeRecord(b)
+		if err != nil {
+			return nil
+		}
+		fn(rec)
+	}
+}
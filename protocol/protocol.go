@@ -2,8 +2,10 @@ package protocol
 
 import (
 	"errors"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Parser interface defines what a parser should implement.
@@ -17,7 +19,11 @@ type Parser interface {
 type Protocol struct {
 	Command       string
 	Args          []string
+	Options       map[string]string
 	ReceivesValue bool
+	// ValueSize is the size of the value that follows the command line
+	// when ReceivesValue is set.
+	ValueSize int
 }
 
 // Parse receives line string without newline and parse command and arguments.
@@ -27,40 +33,383 @@ func (p *Protocol) Parse(line string) error {
 		return errors.New("empty command")
 	}
 
+	args := parsed[1:]
+	var options map[string]string
+	var size int
+
 	switch {
 	case parsed[0] == "SET":
-		if len(parsed[1:]) != 2 {
+		if len(args) < 2 {
 			return errors.New("set invalid arguments")
 		}
 
-		if _, err := strconv.Atoi(parsed[2]); err != nil {
+		var err error
+		if size, err = parseSize(args[1]); err != nil {
 			return errors.New("set invalid size")
 		}
+
+		if options, err = parseOptions(args[2:], map[string]bool{"EX": true}); err != nil {
+			return errors.New("set " + err.Error())
+		}
+
+		if ex, ok := options["EX"]; ok && !positive(ex) {
+			return errors.New("set invalid expire")
+		} else if ok && !expireInRange(ex) {
+			return errors.New("set invalid expire time")
+		}
+		args = args[:2]
 		p.ReceivesValue = true
 
 	case parsed[0] == "GET":
-		if len(parsed[1:]) != 1 {
+		if len(args) != 1 {
 			return errors.New("get invalid arguments")
 		}
 		p.ReceivesValue = false
 
+	case parsed[0] == "GETV":
+		if len(args) != 1 {
+			return errors.New("getv invalid arguments")
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "WAITKEY":
+		if len(args) < 1 || len(args) > 3 {
+			return errors.New("waitkey invalid arguments")
+		}
+
+		if len(args) > 1 {
+			if n, err := strconv.Atoi(args[1]); err != nil || n < 0 {
+				return errors.New("waitkey invalid timeout")
+			}
+		}
+
+		if len(args) > 2 {
+			if _, err := strconv.ParseUint(args[2], 10, 64); err != nil {
+				return errors.New("waitkey invalid version")
+			}
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "CAS":
+		if len(args) != 3 {
+			return errors.New("cas invalid arguments")
+		}
+
+		if _, err := strconv.ParseUint(args[1], 10, 64); err != nil {
+			return errors.New("cas invalid version")
+		}
+
+		var err error
+		if size, err = parseSize(args[2]); err != nil {
+			return errors.New("cas invalid size")
+		}
+		p.ReceivesValue = true
+
 	case parsed[0] == "DELETE":
-		if len(parsed[1:]) != 1 {
+		if len(args) != 1 {
 			return errors.New("delete invalid arguments")
 		}
 		p.ReceivesValue = false
 
 	case parsed[0] == "STREAM":
-		if len(parsed[1:]) != 0 {
+		if len(args) != 0 {
 			return errors.New("stream invalid arguments")
 		}
 		p.ReceivesValue = false
 
+	case parsed[0] == "SCAN":
+		if len(args) < 1 {
+			return errors.New("scan invalid arguments")
+		}
+
+		if _, err := strconv.ParseUint(args[0], 10, 64); err != nil {
+			return errors.New("scan invalid cursor")
+		}
+
+		var err error
+		if options, err = parseOptions(args[1:], map[string]bool{"MATCH": true, "COUNT": true}); err != nil {
+			return errors.New("scan " + err.Error())
+		}
+
+		if count, ok := options["COUNT"]; ok && !positive(count) {
+			return errors.New("scan invalid count")
+		}
+		args = args[:1]
+		p.ReceivesValue = false
+
+	case parsed[0] == "RANGE":
+		if len(args) < 2 {
+			return errors.New("range invalid arguments")
+		}
+
+		var err error
+		if options, err = parseOptions(args[2:], map[string]bool{"LIMIT": true, "REVERSE": false}); err != nil {
+			return errors.New("range " + err.Error())
+		}
+
+		if limit, ok := options["LIMIT"]; ok && !positive(limit) {
+			return errors.New("range invalid limit")
+		}
+		args = args[:2]
+		p.ReceivesValue = false
+
+	case parsed[0] == "LPUSH":
+		if len(args) != 2 {
+			return errors.New("lpush invalid arguments")
+		}
+
+		var err error
+		if size, err = parseSize(args[1]); err != nil {
+			return errors.New("lpush invalid size")
+		}
+		p.ReceivesValue = true
+
+	case parsed[0] == "HSET":
+		if len(args) != 3 {
+			return errors.New("hset invalid arguments")
+		}
+
+		var err error
+		if size, err = parseSize(args[2]); err != nil {
+			return errors.New("hset invalid size")
+		}
+		p.ReceivesValue = true
+
+	case parsed[0] == "INCR" || parsed[0] == "DECR":
+		if len(args) != 1 {
+			return errors.New(strings.ToLower(parsed[0]) + " invalid arguments")
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "INCRBY":
+		if len(args) != 2 {
+			return errors.New("incrby invalid arguments")
+		}
+
+		if _, err := strconv.ParseInt(args[1], 10, 64); err != nil {
+			return errors.New("incrby invalid increment")
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "INCRBYFLOAT":
+		if len(args) != 2 {
+			return errors.New("incrbyfloat invalid arguments")
+		}
+
+		if f, err := strconv.ParseFloat(args[1], 64); err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return errors.New("incrbyfloat invalid increment")
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "RPOP" || parsed[0] == "HGETALL" || parsed[0] == "SMEMBERS":
+		if len(args) != 1 {
+			return errors.New(strings.ToLower(parsed[0]) + " invalid arguments")
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "HGET" || parsed[0] == "SISMEMBER" || parsed[0] == "ZSCORE":
+		if len(args) != 2 {
+			return errors.New(strings.ToLower(parsed[0]) + " invalid arguments")
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "SADD":
+		if len(args) < 2 {
+			return errors.New("sadd invalid arguments")
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "ZADD":
+		if len(args) != 3 {
+			return errors.New("zadd invalid arguments")
+		}
+
+		if score, err := strconv.ParseFloat(args[1], 64); err != nil || math.IsNaN(score) {
+			return errors.New("zadd invalid score")
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "LRANGE" || parsed[0] == "ZRANGE":
+		if len(args) < 3 {
+			return errors.New(strings.ToLower(parsed[0]) + " invalid arguments")
+		}
+
+		for _, index := range args[1:3] {
+			if _, err := strconv.Atoi(index); err != nil {
+				return errors.New(strings.ToLower(parsed[0]) + " invalid index")
+			}
+		}
+
+		spec := map[string]bool{}
+		if parsed[0] == "ZRANGE" {
+			spec["WITHSCORES"] = false
+		}
+
+		var err error
+		if options, err = parseOptions(args[3:], spec); err != nil {
+			return errors.New(strings.ToLower(parsed[0]) + " " + err.Error())
+		}
+		args = args[:3]
+		p.ReceivesValue = false
+
+	case parsed[0] == "SAVE" || parsed[0] == "BGSAVE":
+		if len(args) != 0 {
+			return errors.New(strings.ToLower(parsed[0]) + " invalid arguments")
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "MULTI" || parsed[0] == "EXEC" || parsed[0] == "DISCARD":
+		if len(args) != 0 {
+			return errors.New(strings.ToLower(parsed[0]) + " invalid arguments")
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "SELECT" || parsed[0] == "SWAPDB" || parsed[0] == "FLUSHDB":
+		want := map[string]int{"SELECT": 1, "SWAPDB": 2, "FLUSHDB": 0}[parsed[0]]
+		if len(args) != want {
+			return errors.New(strings.ToLower(parsed[0]) + " invalid arguments")
+		}
+
+		for _, index := range args {
+			if n, err := strconv.Atoi(index); err != nil || n < 0 {
+				return errors.New(strings.ToLower(parsed[0]) + " invalid index")
+			}
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "WATCH":
+		if len(args) < 1 {
+			return errors.New("watch invalid arguments")
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "SUBSCRIBE" || parsed[0] == "PSUBSCRIBE":
+		if len(args) < 1 {
+			return errors.New(strings.ToLower(parsed[0]) + " invalid arguments")
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "UNSUBSCRIBE" || parsed[0] == "PUNSUBSCRIBE":
+		p.ReceivesValue = false
+
+	case parsed[0] == "PUBLISH":
+		if len(args) != 2 {
+			return errors.New("publish invalid arguments")
+		}
+
+		var err error
+		if size, err = parseSize(args[1]); err != nil {
+			return errors.New("publish invalid size")
+		}
+		p.ReceivesValue = true
+
+	case parsed[0] == "EXPIRE":
+		if len(args) != 2 {
+			return errors.New("expire invalid arguments")
+		}
+
+		if _, err := strconv.Atoi(args[1]); err != nil {
+			return errors.New("expire invalid seconds")
+		}
+		if !expireInRange(args[1]) {
+			return errors.New("expire invalid expire time")
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "TTL":
+		if len(args) != 1 {
+			return errors.New("ttl invalid arguments")
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "PERSIST":
+		if len(args) != 1 {
+			return errors.New("persist invalid arguments")
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "MEMORY":
+		switch {
+		case len(args) == 2 && args[0] == "USAGE":
+		case len(args) == 1 && args[0] == "STATS":
+		default:
+			return errors.New("memory invalid arguments")
+		}
+		p.ReceivesValue = false
+
+	case parsed[0] == "INFO":
+		if len(args) != 0 {
+			return errors.New("info invalid arguments")
+		}
+		p.ReceivesValue = false
+
 	default:
 		return errors.New("invalid command")
 	}
 
 	p.Command = parsed[0]
-	p.Args = parsed[1:]
+	p.Args = args
+	p.Options = options
+	p.ValueSize = size
 	return nil
 }
+
+// MaxValueSize is the largest value size accepted in a command, the server
+// allocates the declared size before reading the value.
+const MaxValueSize = 512 << 20
+
+// MaxExpireSeconds is the largest time to live in seconds accepted by SET EX
+// and EXPIRE, longer times to live overflow a time.Duration.
+const MaxExpireSeconds = math.MaxInt64 / int64(time.Second)
+
+// parseSize parses the size of the value that follows a command.
+func parseSize(arg string) (int, error) {
+	size, err := strconv.Atoi(arg)
+	if err != nil || size < 0 || size > MaxValueSize {
+		return 0, errors.New("invalid size")
+	}
+	return size, nil
+}
+
+// parseOptions parses optional NAME [value] arguments, spec maps the
+// accepted option names to whether they are followed by a value.
+func parseOptions(args []string, spec map[string]bool) (map[string]string, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+
+	options := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		name := strings.ToUpper(args[i])
+		hasValue, ok := spec[name]
+		if !ok {
+			return nil, errors.New("invalid option " + args[i])
+		}
+
+		if _, ok := options[name]; ok {
+			return nil, errors.New("duplicated option " + name)
+		}
+
+		options[name] = ""
+		if hasValue {
+			if i+1 >= len(args) {
+				return nil, errors.New("missing value for " + name)
+			}
+			i++
+			options[name] = args[i]
+		}
+	}
+	return options, nil
+}
+
+// positive reports whether s is a positive integer.
+// expireInRange reports whether the seconds in s fit in a time.Duration.
+func expireInRange(s string) bool {
+	n, err := strconv.ParseInt(s, 10, 64)
+	return err == nil && n >= -MaxExpireSeconds && n <= MaxExpireSeconds
+}
+
+func positive(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0
+}
@@ -22,6 +22,7 @@ func TestProtocolParse(t *testing.T) {
 				Command:       "SET",
 				Args:          []string{"foo", "3"},
 				ReceivesValue: true,
+				ValueSize:     3,
 			},
 		},
 		{
@@ -34,6 +35,42 @@ func TestProtocolParse(t *testing.T) {
 			Text:         "SET foo a",
 			ParsingError: errors.New("set invalid size"),
 		},
+		{
+			Name:         "TestSetSizeTooLarge",
+			Text:         "SET foo 999999999999999999",
+			ParsingError: errors.New("set invalid size"),
+		},
+		{
+			Name: "TestSetExpireSuccess",
+			Text: "SET foo 3 EX 10",
+			Parsed: &Protocol{
+				Command:       "SET",
+				Args:          []string{"foo", "3"},
+				Options:       map[string]string{"EX": "10"},
+				ReceivesValue: true,
+				ValueSize:     3,
+			},
+		},
+		{
+			Name:         "TestSetInvalidExpire",
+			Text:         "SET foo 3 EX 0",
+			ParsingError: errors.New("set invalid expire"),
+		},
+		{
+			Name:         "TestSetExpireOverflow",
+			Text:         "SET foo 3 EX 9223372037",
+			ParsingError: errors.New("set invalid expire time"),
+		},
+		{
+			Name:         "TestSetMissingExpire",
+			Text:         "SET foo 3 EX",
+			ParsingError: errors.New("set missing value for EX"),
+		},
+		{
+			Name:         "TestSetInvalidOption",
+			Text:         "SET foo 3 PX 10",
+			ParsingError: errors.New("set invalid option PX"),
+		},
 		{
 			Name: "TestGetSucess",
 			Text: "GET foo",
@@ -60,6 +97,279 @@ func TestProtocolParse(t *testing.T) {
 			Text:         "DELETE",
 			ParsingError: errors.New("delete invalid arguments"),
 		},
+		{
+			Name: "TestExpireSuccess",
+			Text: "EXPIRE foo 10",
+			Parsed: &Protocol{
+				Command: "EXPIRE",
+				Args:    []string{"foo", "10"},
+			},
+		},
+		{
+			Name:         "TestExpireInvalidSeconds",
+			Text:         "EXPIRE foo bar",
+			ParsingError: errors.New("expire invalid seconds"),
+		},
+		{
+			Name:         "TestExpireOverflow",
+			Text:         "EXPIRE foo -9223372037",
+			ParsingError: errors.New("expire invalid expire time"),
+		},
+		{
+			Name: "TestTTLSuccess",
+			Text: "TTL foo",
+			Parsed: &Protocol{
+				Command: "TTL",
+				Args:    []string{"foo"},
+			},
+		},
+		{
+			Name:         "TestPersistInvalidArguments",
+			Text:         "PERSIST",
+			ParsingError: errors.New("persist invalid arguments"),
+		},
+		{
+			Name: "TestBackgroundSaveSuccess",
+			Text: "BGSAVE",
+			Parsed: &Protocol{
+				Command: "BGSAVE",
+				Args:    []string{},
+			},
+		},
+		{
+			Name:         "TestSaveInvalidArguments",
+			Text:         "SAVE now",
+			ParsingError: errors.New("save invalid arguments"),
+		},
+		{
+			Name: "TestCompareAndSwapSuccess",
+			Text: "CAS foo 12 3",
+			Parsed: &Protocol{
+				Command:       "CAS",
+				Args:          []string{"foo", "12", "3"},
+				ReceivesValue: true,
+				ValueSize:     3,
+			},
+		},
+		{
+			Name:         "TestCompareAndSwapInvalidVersion",
+			Text:         "CAS foo -1 3",
+			ParsingError: errors.New("cas invalid version"),
+		},
+		{
+			Name:         "TestGetVersionInvalidArguments",
+			Text:         "GETV foo bar",
+			ParsingError: errors.New("getv invalid arguments"),
+		},
+		{
+			Name: "TestWaitKeySuccess",
+			Text: "WAITKEY foo 10 42",
+			Parsed: &Protocol{
+				Command: "WAITKEY",
+				Args:    []string{"foo", "10", "42"},
+			},
+		},
+		{
+			Name:         "TestWaitKeyInvalidTimeout",
+			Text:         "WAITKEY foo -1",
+			ParsingError: errors.New("waitkey invalid timeout"),
+		},
+		{
+			Name: "TestScanSuccess",
+			Text: "SCAN 0 MATCH user:* COUNT 100",
+			Parsed: &Protocol{
+				Command: "SCAN",
+				Args:    []string{"0"},
+				Options: map[string]string{"MATCH": "user:*", "COUNT": "100"},
+			},
+		},
+		{
+			Name:         "TestScanInvalidCursor",
+			Text:         "SCAN foo",
+			ParsingError: errors.New("scan invalid cursor"),
+		},
+		{
+			Name:         "TestScanInvalidCount",
+			Text:         "SCAN 0 COUNT 0",
+			ParsingError: errors.New("scan invalid count"),
+		},
+		{
+			Name: "TestRangeSuccess",
+			Text: "RANGE user:1000 user:2000 REVERSE LIMIT 10",
+			Parsed: &Protocol{
+				Command: "RANGE",
+				Args:    []string{"user:1000", "user:2000"},
+				Options: map[string]string{"LIMIT": "10", "REVERSE": ""},
+			},
+		},
+		{
+			Name:         "TestRangeInvalidArguments",
+			Text:         "RANGE user:1000",
+			ParsingError: errors.New("range invalid arguments"),
+		},
+		{
+			Name:         "TestRangeInvalidLimit",
+			Text:         "RANGE a b LIMIT -1",
+			ParsingError: errors.New("range invalid limit"),
+		},
+		{
+			Name: "TestHashSetSuccess",
+			Text: "HSET user name 5",
+			Parsed: &Protocol{
+				Command:       "HSET",
+				Args:          []string{"user", "name", "5"},
+				ReceivesValue: true,
+				ValueSize:     5,
+			},
+		},
+		{
+			Name: "TestSetAddSuccess",
+			Text: "SADD tags a b c",
+			Parsed: &Protocol{
+				Command: "SADD",
+				Args:    []string{"tags", "a", "b", "c"},
+			},
+		},
+		{
+			Name:         "TestSortedSetAddInvalidScore",
+			Text:         "ZADD board NaN alice",
+			ParsingError: errors.New("zadd invalid score"),
+		},
+		{
+			Name: "TestSortedSetRangeSuccess",
+			Text: "ZRANGE board 0 -1 WITHSCORES",
+			Parsed: &Protocol{
+				Command: "ZRANGE",
+				Args:    []string{"board", "0", "-1"},
+				Options: map[string]string{"WITHSCORES": ""},
+			},
+		},
+		{
+			Name:         "TestListRangeInvalidOption",
+			Text:         "LRANGE list 0 -1 WITHSCORES",
+			ParsingError: errors.New("lrange invalid option WITHSCORES"),
+		},
+		{
+			Name:         "TestListRangeInvalidIndex",
+			Text:         "LRANGE list a -1",
+			ParsingError: errors.New("lrange invalid index"),
+		},
+		{
+			Name: "TestIncrementSuccess",
+			Text: "INCRBY counter -5",
+			Parsed: &Protocol{
+				Command: "INCRBY",
+				Args:    []string{"counter", "-5"},
+			},
+		},
+		{
+			Name:         "TestIncrementOverflow",
+			Text:         "INCRBY counter 9223372036854775808",
+			ParsingError: errors.New("incrby invalid increment"),
+		},
+		{
+			Name:         "TestIncrementFloatInvalid",
+			Text:         "INCRBYFLOAT counter inf",
+			ParsingError: errors.New("incrbyfloat invalid increment"),
+		},
+		{
+			Name: "TestSwapDatabasesSuccess",
+			Text: "SWAPDB 0 1",
+			Parsed: &Protocol{
+				Command: "SWAPDB",
+				Args:    []string{"0", "1"},
+			},
+		},
+		{
+			Name:         "TestSelectInvalidIndex",
+			Text:         "SELECT -1",
+			ParsingError: errors.New("select invalid index"),
+		},
+		{
+			Name:         "TestFlushInvalidArguments",
+			Text:         "FLUSHDB 0",
+			ParsingError: errors.New("flushdb invalid arguments"),
+		},
+		{
+			Name: "TestMemoryUsageSuccess",
+			Text: "MEMORY USAGE foo",
+			Parsed: &Protocol{
+				Command: "MEMORY",
+				Args:    []string{"USAGE", "foo"},
+			},
+		},
+		{
+			Name: "TestMemoryStatsSuccess",
+			Text: "MEMORY STATS",
+			Parsed: &Protocol{
+				Command: "MEMORY",
+				Args:    []string{"STATS"},
+			},
+		},
+		{
+			Name:         "TestMemoryInvalidArguments",
+			Text:         "MEMORY USAGE",
+			ParsingError: errors.New("memory invalid arguments"),
+		},
+		{
+			Name: "TestInfoSuccess",
+			Text: "INFO",
+			Parsed: &Protocol{
+				Command: "INFO",
+				Args:    []string{},
+			},
+		},
+		{
+			Name:         "TestInfoInvalidArguments",
+			Text:         "INFO compression",
+			ParsingError: errors.New("info invalid arguments"),
+		},
+		{
+			Name: "TestPublishSuccess",
+			Text: "PUBLISH news 5",
+			Parsed: &Protocol{
+				Command:       "PUBLISH",
+				Args:          []string{"news", "5"},
+				ReceivesValue: true,
+				ValueSize:     5,
+			},
+		},
+		{
+			Name:         "TestPublishInvalidSize",
+			Text:         "PUBLISH news a",
+			ParsingError: errors.New("publish invalid size"),
+		},
+		{
+			Name:         "TestSubscribeInvalidArguments",
+			Text:         "PSUBSCRIBE",
+			ParsingError: errors.New("psubscribe invalid arguments"),
+		},
+		{
+			Name: "TestUnsubscribeAllSuccess",
+			Text: "UNSUBSCRIBE",
+			Parsed: &Protocol{
+				Command: "UNSUBSCRIBE",
+				Args:    []string{},
+			},
+		},
+		{
+			Name: "TestWatchSuccess",
+			Text: "WATCH foo bar",
+			Parsed: &Protocol{
+				Command: "WATCH",
+				Args:    []string{"foo", "bar"},
+			},
+		},
+		{
+			Name:         "TestWatchInvalidArguments",
+			Text:         "WATCH",
+			ParsingError: errors.New("watch invalid arguments"),
+		},
+		{
+			Name:         "TestExecInvalidArguments",
+			Text:         "EXEC now",
+			ParsingError: errors.New("exec invalid arguments"),
+		},
 		{
 			Name:         "TestInvalidCommand",
 			Text:         "NONE",
@@ -0,0 +1,261 @@
+// Package pubsub delivers messages published to channels to the subscribers
+// of the channel and of the glob patterns matching it.
+//
+// Publishing never waits for subscribers, each subscriber has a bounded
+// buffer of messages and a subscriber whose buffer is full is closed and
+// reported as overflowed so a slow consumer cannot stall the publishers.
+package pubsub
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/rsampaio/kvstore/glob"
+)
+
+// DefaultBufferSize is the number of messages buffered for a subscriber.
+const DefaultBufferSize = 1024
+
+// Message is a message published to a channel, Pattern is the pattern that
+// matched the channel for messages received through PSubscribe.
+//
+// The payload is shared by every subscriber and must not be modified.
+type Message struct {
+	Pattern string
+	Channel string
+	Payload []byte
+}
+
+// Broker keeps the subscriptions of channels and patterns.
+type Broker struct {
+	mu       sync.RWMutex
+	channels map[string]map[*Subscriber]struct{}
+	patterns map[string]map[*Subscriber]struct{}
+
+	bufferSize int
+}
+
+// Option configures optional behaviour of a Broker.
+type Option func(*Broker)
+
+// WithBufferSize sets the number of messages buffered for each subscriber,
+// the default is DefaultBufferSize.
+func WithBufferSize(n int) Option {
+	return func(b *Broker) {
+		b.bufferSize = n
+	}
+}
+
+// NewBroker creates a broker without subscriptions.
+func NewBroker(opts ...Option) *Broker {
+	b := &Broker{
+		channels:   make(map[string]map[*Subscriber]struct{}),
+		patterns:   make(map[string]map[*Subscriber]struct{}),
+		bufferSize: DefaultBufferSize,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Subscriber receives the messages of its channels and patterns.
+type Subscriber struct {
+	b        *Broker
+	messages chan Message
+
+	// The fields below are guarded by b.mu.
+	channels   map[string]struct{}
+	patterns   map[string]struct{}
+	closed     bool
+	overflowed bool
+}
+
+// NewSubscriber creates a subscriber without subscriptions.
+func (b *Broker) NewSubscriber() *Subscriber {
+	return &Subscriber{
+		b:        b,
+		messages: make(chan Message, b.bufferSize),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+}
+
+// Publish sends payload to the subscribers of channel and of the patterns
+// matching it and returns the number of messages delivered, a subscriber
+// subscribed to the channel and to matching patterns receives one message
+// for each subscription.
+func (b *Broker) Publish(channel string, payload []byte) int {
+	var (
+		n    int
+		full []*Subscriber
+	)
+
+	send := func(s *Subscriber, m Message) {
+		if s.closed {
+			return
+		}
+		select {
+		case s.messages <- m:
+			n++
+		default:
+			full = append(full, s)
+		}
+	}
+
+	b.mu.RLock()
+	for s := range b.channels[channel] {
+		send(s, Message{Channel: channel, Payload: payload})
+	}
+	for pattern, subs := range b.patterns {
+		if !glob.Match(pattern, channel) {
+			continue
+		}
+		for s := range subs {
+			send(s, Message{Pattern: pattern, Channel: channel, Payload: payload})
+		}
+	}
+	b.mu.RUnlock()
+
+	if len(full) > 0 {
+		b.mu.Lock()
+		for _, s := range full {
+			if !s.closed {
+				s.overflowed = true
+				s.close()
+			}
+		}
+		b.mu.Unlock()
+	}
+	return n
+}
+
+// Subscribe subscribes to channel and returns the number of subscriptions
+// of the subscriber.
+func (s *Subscriber) Subscribe(channel string) int {
+	return s.add(s.b.channels, s.channels, channel)
+}
+
+// PSubscribe subscribes to the channels matching pattern and returns the
+// number of subscriptions of the subscriber.
+func (s *Subscriber) PSubscribe(pattern string) int {
+	return s.add(s.b.patterns, s.patterns, pattern)
+}
+
+// Unsubscribe removes the subscription to channel and returns the number of
+// subscriptions left.
+func (s *Subscriber) Unsubscribe(channel string) int {
+	return s.drop(s.b.channels, s.channels, channel)
+}
+
+// PUnsubscribe removes the subscription to pattern and returns the number of
+// subscriptions left.
+func (s *Subscriber) PUnsubscribe(pattern string) int {
+	return s.drop(s.b.patterns, s.patterns, pattern)
+}
+
+// Channels returns the subscribed channels in order.
+func (s *Subscriber) Channels() []string {
+	s.b.mu.RLock()
+	defer s.b.mu.RUnlock()
+	return sortedNames(s.channels)
+}
+
+// Patterns returns the subscribed patterns in order.
+func (s *Subscriber) Patterns() []string {
+	s.b.mu.RLock()
+	defer s.b.mu.RUnlock()
+	return sortedNames(s.patterns)
+}
+
+// Count returns the number of subscriptions.
+func (s *Subscriber) Count() int {
+	s.b.mu.RLock()
+	defer s.b.mu.RUnlock()
+	return len(s.channels) + len(s.patterns)
+}
+
+// Messages returns the channel of received messages, it is closed when the
+// subscriber is closed.
+func (s *Subscriber) Messages() <-chan Message {
+	return s.messages
+}
+
+// Overflowed reports whether the subscriber was closed because its buffer
+// was full.
+func (s *Subscriber) Overflowed() bool {
+	s.b.mu.RLock()
+	defer s.b.mu.RUnlock()
+	return s.overflowed
+}
+
+// Close removes every subscription and closes the messages channel after
+// the buffered messages.
+func (s *Subscriber) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	if !s.closed {
+		s.close()
+	}
+}
+
+// close removes the subscriptions and closes the messages channel,
+// b.mu must be held.
+func (s *Subscriber) close() {
+	for channel := range s.channels {
+		delete(s.channels, channel)
+		s.b.remove(s.b.channels, channel, s)
+	}
+	for pattern := range s.patterns {
+		delete(s.patterns, pattern)
+		s.b.remove(s.b.patterns, pattern, s)
+	}
+	s.closed = true
+	close(s.messages)
+}
+
+// add subscribes to name in subs and returns the number of subscriptions,
+// closed subscribers are not subscribed.
+func (s *Subscriber) add(subs map[string]map[*Subscriber]struct{}, names map[string]struct{}, name string) int {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	if !s.closed {
+		if subs[name] == nil {
+			subs[name] = make(map[*Subscriber]struct{})
+		}
+		subs[name][s] = struct{}{}
+		names[name] = struct{}{}
+	}
+	return len(s.channels) + len(s.patterns)
+}
+
+// drop unsubscribes from name in subs and returns the number of subscriptions.
+func (s *Subscriber) drop(subs map[string]map[*Subscriber]struct{}, names map[string]struct{}, name string) int {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	if _, ok := names[name]; ok {
+		delete(names, name)
+		s.b.remove(subs, name, s)
+	}
+	return len(s.channels) + len(s.patterns)
+}
+
+// remove deletes the subscription of s to name, b.mu must be held.
+func (b *Broker) remove(subs map[string]map[*Subscriber]struct{}, name string, s *Subscriber) {
+	delete(subs[name], s)
+	if len(subs[name]) == 0 {
+		delete(subs, name)
+	}
+}
+
+func sortedNames(names map[string]struct{}) []string {
+	r := make([]string, 0, len(names))
+	for name := range names {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return r
+}
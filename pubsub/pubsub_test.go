@@ -0,0 +1,115 @@
+package pubsub
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPublish(t *testing.T) {
+	b := NewBroker()
+	s := b.NewSubscriber()
+	defer s.Close()
+
+	if n := s.Subscribe("news.tech"); n != 1 {
+		t.Errorf("got %d subscriptions, expected 1", n)
+	}
+	if n := s.PSubscribe("news.*"); n != 2 {
+		t.Errorf("got %d subscriptions, expected 2", n)
+	}
+
+	if n := b.Publish("news.tech", []byte("a")); n != 2 {
+		t.Errorf("got %d receivers, expected 2", n)
+	}
+	if n := b.Publish("news.art", []byte("b")); n != 1 {
+		t.Errorf("got %d receivers, expected 1", n)
+	}
+	if n := b.Publish("sports", []byte("c")); n != 0 {
+		t.Errorf("got %d receivers, expected 0", n)
+	}
+
+	var got []Message
+	for i := 0; i < 3; i++ {
+		got = append(got, <-s.Messages())
+	}
+
+	// The messages of one publish are sent to channels before patterns.
+	expected := []Message{
+		{Channel: "news.tech", Payload: []byte("a")},
+		{Pattern: "news.*", Channel: "news.tech", Payload: []byte("a")},
+		{Pattern: "news.*", Channel: "news.art", Payload: []byte("b")},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	b := NewBroker()
+	s := b.NewSubscriber()
+	defer s.Close()
+
+	s.Subscribe("a")
+	s.Subscribe("b")
+	s.PSubscribe("c*")
+
+	if n := s.Unsubscribe("a"); n != 2 {
+		t.Errorf("got %d subscriptions, expected 2", n)
+	}
+	if n := s.Unsubscribe("missing"); n != 2 {
+		t.Errorf("got %d subscriptions, expected 2", n)
+	}
+	if got := s.Channels(); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("got channels %v, expected [b]", got)
+	}
+	if got := s.Patterns(); !reflect.DeepEqual(got, []string{"c*"}) {
+		t.Errorf("got patterns %v, expected [c*]", got)
+	}
+
+	if n := s.PUnsubscribe("c*"); n != 1 {
+		t.Errorf("got %d subscriptions, expected 1", n)
+	}
+	if n := b.Publish("a", nil) + b.Publish("cat", nil); n != 0 {
+		t.Errorf("got %d receivers of removed subscriptions, expected 0", n)
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	b := NewBroker(WithBufferSize(2))
+	slow := b.NewSubscriber()
+	fast := b.NewSubscriber()
+	defer fast.Close()
+
+	slow.Subscribe("ch")
+	fast.Subscribe("ch")
+
+	for i := 0; i < 2; i++ {
+		if n := b.Publish("ch", nil); n != 2 {
+			t.Fatalf("got %d receivers, expected 2", n)
+		}
+		<-fast.Messages()
+	}
+
+	// The slow subscriber buffer is full, it is closed instead of
+	// blocking the publisher.
+	if n := b.Publish("ch", nil); n != 1 {
+		t.Errorf("got %d receivers, expected 1", n)
+	}
+	if !slow.Overflowed() {
+		t.Error("expected the slow subscriber to overflow")
+	}
+
+	var buffered int
+	for range slow.Messages() {
+		buffered++
+	}
+	if buffered != 2 {
+		t.Errorf("got %d buffered messages, expected 2", buffered)
+	}
+
+	if n := slow.Subscribe("ch"); n != 0 {
+		t.Errorf("got %d subscriptions of a closed subscriber, expected 0", n)
+	}
+	if n := b.Publish("ch", nil); n != 1 {
+		t.Errorf("got %d receivers, expected 1", n)
+	}
+}
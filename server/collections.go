@@ -0,0 +1,235 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/rsampaio/kvstore/protocol"
+	"github.com/rsampaio/kvstore/store"
+)
+
+// LPush inserts the value at the head of a list and replies its length.
+func (h Handler) LPush(s store.Store, p *protocol.Protocol, in *bufio.Reader, _ net.Conn) (string, error) {
+	value, err := readValue(p, in)
+	if err != nil {
+		return "ERROR\r", err
+	}
+
+	c, ok := s.(store.Collections)
+	if !ok {
+		return unsupported, nil
+	}
+
+	n, err := c.LPush(p.Args[0], value)
+	if err != nil {
+		return clientError(err)
+	}
+	return fmt.Sprintf("%d\r", n), nil
+}
+
+// RPop removes the last element of a list and replies it like GET.
+func (h Handler) RPop(s store.Store, p *protocol.Protocol, _ *bufio.Reader, conn net.Conn) (string, error) {
+	c, ok := s.(store.Collections)
+	if !ok {
+		return unsupported, nil
+	}
+
+	value, _, err := c.RPop(p.Args[0])
+	if err != nil {
+		return clientError(err)
+	}
+	return writeValue(conn, value), nil
+}
+
+// LRange replies a "LRANGE n" line followed by n elements, each framed as a
+// size line, the bytes of the element and CRLF, and OK.
+func (h Handler) LRange(s store.Store, p *protocol.Protocol, _ *bufio.Reader, conn net.Conn) (string, error) {
+	c, ok := s.(store.Collections)
+	if !ok {
+		return unsupported, nil
+	}
+
+	start, _ := strconv.Atoi(p.Args[1])
+	stop, _ := strconv.Atoi(p.Args[2])
+	values, err := c.LRange(p.Args[0], start, stop)
+	if err != nil {
+		return clientError(err)
+	}
+
+	fmt.Fprintf(conn, "LRANGE %d\r\n", len(values))
+	for _, v := range values {
+		fmt.Fprintf(conn, "%d\r\n", len(v))
+		conn.Write(v)
+		fmt.Fprint(conn, "\r\n")
+	}
+	return "OK\r", nil
+}
+
+// HSet sets a field of a hash and replies 1 if the field is new or 0 otherwise.
+func (h Handler) HSet(s store.Store, p *protocol.Protocol, in *bufio.Reader, _ net.Conn) (string, error) {
+	value, err := readValue(p, in)
+	if err != nil {
+		return "ERROR\r", err
+	}
+
+	c, ok := s.(store.Collections)
+	if !ok {
+		return unsupported, nil
+	}
+
+	added, err := c.HSet(p.Args[0], p.Args[1], value)
+	if err != nil {
+		return clientError(err)
+	}
+	return reply(added), nil
+}
+
+// HGet replies the value of a field of a hash like GET.
+func (h Handler) HGet(s store.Store, p *protocol.Protocol, _ *bufio.Reader, conn net.Conn) (string, error) {
+	c, ok := s.(store.Collections)
+	if !ok {
+		return unsupported, nil
+	}
+
+	value, _, err := c.HGet(p.Args[0], p.Args[1])
+	if err != nil {
+		return clientError(err)
+	}
+	return writeValue(conn, value), nil
+}
+
+// HGetAll sends the fields of a hash with their values framed like STREAM.
+func (h Handler) HGetAll(s store.Store, p *protocol.Protocol, _ *bufio.Reader, conn net.Conn) (string, error) {
+	c, ok := s.(store.Collections)
+	if !ok {
+		return unsupported, nil
+	}
+
+	fields, err := c.HGetAll(p.Args[0])
+	if err != nil {
+		return clientError(err)
+	}
+
+	for _, f := range fields {
+		writePair(conn, f.Key, f.Value)
+	}
+	return "OK\r", nil
+}
+
+// SAdd adds members to a set and replies the number of new members.
+func (h Handler) SAdd(s store.Store, p *protocol.Protocol, _ *bufio.Reader, _ net.Conn) (string, error) {
+	c, ok := s.(store.Collections)
+	if !ok {
+		return unsupported, nil
+	}
+
+	n, err := c.SAdd(p.Args[0], p.Args[1:]...)
+	if err != nil {
+		return clientError(err)
+	}
+	return fmt.Sprintf("%d\r", n), nil
+}
+
+// SIsMember replies 1 if the member is in the set or 0 otherwise.
+func (h Handler) SIsMember(s store.Store, p *protocol.Protocol, _ *bufio.Reader, _ net.Conn) (string, error) {
+	c, ok := s.(store.Collections)
+	if !ok {
+		return unsupported, nil
+	}
+
+	member, err := c.SIsMember(p.Args[0], p.Args[1])
+	if err != nil {
+		return clientError(err)
+	}
+	return reply(member), nil
+}
+
+// SMembers replies a "SMEMBERS n" line followed by n members, one per line, and OK.
+func (h Handler) SMembers(s store.Store, p *protocol.Protocol, _ *bufio.Reader, conn net.Conn) (string, error) {
+	c, ok := s.(store.Collections)
+	if !ok {
+		return unsupported, nil
+	}
+
+	members, err := c.SMembers(p.Args[0])
+	if err != nil {
+		return clientError(err)
+	}
+
+	fmt.Fprintf(conn, "SMEMBERS %d\r\n", len(members))
+	for _, m := range members {
+		fmt.Fprintf(conn, "%s\r\n", m)
+	}
+	return "OK\r", nil
+}
+
+// ZAdd sets the score of a member of a sorted set and replies 1 if the
+// member is new or 0 otherwise.
+func (h Handler) ZAdd(s store.Store, p *protocol.Protocol, _ *bufio.Reader, _ net.Conn) (string, error) {
+	c, ok := s.(store.Collections)
+	if !ok {
+		return unsupported, nil
+	}
+
+	score, err := strconv.ParseFloat(p.Args[1], 64)
+	if err != nil {
+		return "ERROR\r", err
+	}
+
+	added, err := c.ZAdd(p.Args[0], score, p.Args[2])
+	if err != nil {
+		return clientError(err)
+	}
+	return reply(added), nil
+}
+
+// ZRange replies a "ZRANGE n" line followed by n members ordered by score,
+// one per line followed by the score with WITHSCORES, and OK.
+func (h Handler) ZRange(s store.Store, p *protocol.Protocol, _ *bufio.Reader, conn net.Conn) (string, error) {
+	c, ok := s.(store.Collections)
+	if !ok {
+		return unsupported, nil
+	}
+
+	start, _ := strconv.Atoi(p.Args[1])
+	stop, _ := strconv.Atoi(p.Args[2])
+	members, err := c.ZRange(p.Args[0], start, stop)
+	if err != nil {
+		return clientError(err)
+	}
+
+	_, withScores := p.Options["WITHSCORES"]
+	fmt.Fprintf(conn, "ZRANGE %d\r\n", len(members))
+	for _, m := range members {
+		if withScores {
+			fmt.Fprintf(conn, "%s %s\r\n", m.Member, formatScore(m.Score))
+		} else {
+			fmt.Fprintf(conn, "%s\r\n", m.Member)
+		}
+	}
+	return "OK\r", nil
+}
+
+// ZScore replies the score of a member of a sorted set or an empty line if
+// the member does not exist.
+func (h Handler) ZScore(s store.Store, p *protocol.Protocol, _ *bufio.Reader, _ net.Conn) (string, error) {
+	c, ok := s.(store.Collections)
+	if !ok {
+		return unsupported, nil
+	}
+
+	score, ok, err := c.ZScore(p.Args[0], p.Args[1])
+	if err != nil {
+		return clientError(err)
+	}
+	if !ok {
+		return "\r", nil
+	}
+	return formatScore(score) + "\r", nil
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
@@ -4,10 +4,13 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/rsampaio/kvstore/protocol"
+	"github.com/rsampaio/kvstore/pubsub"
 	"github.com/rsampaio/kvstore/store"
 )
 
@@ -15,21 +18,56 @@ type internalMetrics struct {
 	clientCount int
 }
 
-// Commander has a store.Store field that is passed to default handlers
+// Commander has the databases whose stores are passed to default handlers
 type Commander struct {
-	store    store.Store
+	dbs      *Databases
+	broker   *pubsub.Broker
 	listener net.Listener
 	metrics  internalMetrics
+	handlers Handlers
+
+	// waiters are the WAITKEY connections of each store.
+	waitersMu sync.Mutex
+	waiters   map[store.Observable]*keyWaiters
 }
 
 // NewCommander receives a store and a listener and returns a new Commander instance
+// that handles commands with the DefaultHandlers.
 func NewCommander(store store.Store, list net.Listener) *Commander {
+	handlers := make(Handlers, len(DefaultHandlers))
+	for command, h := range DefaultHandlers {
+		handlers[command] = h
+	}
+
 	return &Commander{
-		store:    store,
+		dbs:      NewDatabases(store),
+		broker:   pubsub.NewBroker(),
 		listener: list,
+		handlers: handlers,
+	}
+}
+
+// Handle registers the handlers for their commands replacing existing handlers,
+// it must be called before Run.
+func (c *Commander) Handle(handlers Handlers) {
+	for command, h := range handlers {
+		c.handlers[command] = h
 	}
 }
 
+// UseDatabases replaces the store of the commander with numbered databases,
+// it must be called before Run.
+func (c *Commander) UseDatabases(dbs *Databases) {
+	c.dbs = dbs
+}
+
+// UseBroker replaces the broker of PUBLISH and the subscriptions, commanders
+// sharing a broker deliver messages to each other's subscribers. It must be
+// called before Run.
+func (c *Commander) UseBroker(b *pubsub.Broker) {
+	c.broker = b
+}
+
 // Run runs a loop accepting connections to the listener and executes the commander
 func (c *Commander) Run(ctx context.Context) error {
 	defer c.listener.Close()
@@ -38,14 +76,16 @@ func (c *Commander) Run(ctx context.Context) error {
 		for {
 			select {
 			case <-ctx.Done():
-				break
-			default:
-				fmt.Printf(
-					"listener=%v capacity-left=%dbytes\n",
-					c.listener.Addr(),
-					c.store.Cap(),
-				)
-				time.Sleep(10 * time.Second)
+				return
+			case <-time.After(10 * time.Second):
+				line := fmt.Sprintf("listener=%v capacity-left=%dbytes", c.listener.Addr(), c.dbs.Cap())
+				if st, ok := c.dbs.Stats(); ok {
+					line += fmt.Sprintf(
+						" hits=%d misses=%d hit-rate=%.2f evictions=%d evicted=%dbytes",
+						st.Hits, st.Misses, st.HitRate(), st.Evictions, st.EvictedBytes,
+					)
+				}
+				fmt.Println(line)
 			}
 		}
 	}()
@@ -53,7 +93,7 @@ func (c *Commander) Run(ctx context.Context) error {
 	for {
 		select {
 		case <-ctx.Done():
-			break
+			return nil
 		default:
 			conn, err := c.listener.Accept()
 			if err != nil {
@@ -62,44 +102,97 @@ func (c *Commander) Run(ctx context.Context) error {
 			go func() {
 				if err := c.WaitCommands(ctx, conn); err != nil {
 					fmt.Printf("wait command error: %v\n", err)
-					conn.Close()
 				}
+				conn.Close()
 			}()
 		}
 	}
 }
 
-// WaitCommands handles connections and parse commands from clients
+// WaitCommands handles connections and parse commands from clients,
+// it returns nil when the client closes the connection.
 func (c *Commander) WaitCommands(ctx context.Context, conn net.Conn) error {
 	p := &protocol.Protocol{}
+	tx := &transaction{}
+	db := 0
+
+	ps := &subscription{conn: conn}
+	defer ps.stop()
 
 	buf := bufio.NewReader(conn)
 
 	for {
 		select {
 		case <-ctx.Done():
-			break
+			return nil
 		default:
-			// Ignore empty lines
-			line, _, err := buf.ReadLine()
-			if string(line) == "" {
-				continue
+		}
+
+		line, _, err := buf.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Ignore empty lines
+		if len(line) == 0 {
+			continue
+		}
+
+		// If command is invalid parse will return an error
+		if err := p.Parse(string(line)); err != nil {
+			fmt.Fprintln(conn, "ERROR")
+			return err
+		}
+
+		// Subscribed connections only accept the subscription commands.
+		if ok, err := c.pubsub(ps, tx, p, buf); ok {
+			if err != nil {
+				return err
 			}
+			continue
+		}
 
-			// If command is invalid parse will return an error
-			if err := p.Parse(string(line)); err != nil {
-				fmt.Fprintln(conn, "ERROR")
+		if result, ok, err := c.database(&db, tx, p); ok {
+			fmt.Fprintln(conn, result)
+			if err != nil {
 				return err
 			}
+			continue
+		}
 
-			result, err := DefaultHandlers[p.Command](c.store, p.Args, buf, conn)
+		s := c.dbs.Get(db)
+		if result, ok, err := c.waitKey(ctx, s, tx, p, buf, conn); ok {
+			fmt.Fprintln(conn, result)
+			if err != nil {
+				return err
+			}
+			continue
+		}
 
-			// Adds \n back but not \r
+		// Commands after MULTI are queued instead of executed.
+		if result, ok, err := c.transact(s, db, tx, p, buf, conn); ok {
 			fmt.Fprintln(conn, result)
 			if err != nil {
 				return err
 			}
+			continue
+		}
+
+		h, ok := c.handlers[p.Command]
+		if !ok {
+			fmt.Fprintln(conn, unsupported)
+			continue
+		}
+
+		result, err := h(s, p, buf, conn)
+
+		// Adds \n back but not \r
+		fmt.Fprintln(conn, result)
+		if err != nil {
+			return err
 		}
 	}
-	return nil
 }
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/rsampaio/kvstore/protocol"
+	"github.com/rsampaio/kvstore/store"
+)
+
+// Databases is a numbered set of stores, each connection selects the
+// database its commands run against with SELECT and starts with database 0.
+type Databases struct {
+	mu  sync.RWMutex
+	dbs []store.Store
+	// gens counts the swaps and flushes of every database, the keys
+	// watched before they changed are modified.
+	gens []uint64
+}
+
+// NewDatabases returns the databases numbered by the position of their store.
+func NewDatabases(dbs ...store.Store) *Databases {
+	return &Databases{dbs: dbs, gens: make([]uint64, len(dbs))}
+}
+
+// Len returns the number of databases.
+func (d *Databases) Len() int {
+	return len(d.dbs)
+}
+
+// Get returns the store of database i.
+func (d *Databases) Get(i int) store.Store {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.dbs[i]
+}
+
+// Swap exchanges the stores of databases i and j, connections that selected
+// one of them see the keys of the other.
+func (d *Databases) Swap(i, j int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dbs[i], d.dbs[j] = d.dbs[j], d.dbs[i]
+	d.gens[i]++
+	d.gens[j]++
+}
+
+// Flush deletes every key of database i, stores implementing
+// store.Transactional delete them atomically.
+func (d *Databases) Flush(i int) error {
+	d.mu.Lock()
+	s := d.dbs[i]
+	d.gens[i]++
+	d.mu.Unlock()
+
+	flush := func(s store.Store) error {
+		for _, k := range s.GetLastModifiedKeys() {
+			if err := s.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if t, ok := s.(store.Transactional); ok {
+		return t.Atomically(nil, flush)
+	}
+	return flush(s)
+}
+
+// generation returns the store of database i and the number of times it
+// was swapped or flushed.
+func (d *Databases) generation(i int) (store.Store, uint64) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.dbs[i], d.gens[i]
+}
+
+// Cap returns the available capacity of all databases.
+func (d *Databases) Cap() int {
+	// The stores are called without d.mu, observers of the stores take
+	// it with the store lock held.
+	d.mu.RLock()
+	dbs := append([]store.Store(nil), d.dbs...)
+	d.mu.RUnlock()
+
+	var c int
+	for _, s := range dbs {
+		c += s.Cap()
+	}
+	return c
+}
+
+// Stats returns the sum of the counters of the databases implementing
+// store.StatsReporter, it returns false if none does.
+func (d *Databases) Stats() (store.Stats, bool) {
+	d.mu.RLock()
+	dbs := append([]store.Store(nil), d.dbs...)
+	d.mu.RUnlock()
+
+	var (
+		st store.Stats
+		ok bool
+	)
+	for _, s := range dbs {
+		if r, is := s.(store.StatsReporter); is {
+			st = st.Add(r.Stats())
+			ok = true
+		}
+	}
+	return st, ok
+}
+
+// index returns the current number of the database of s.
+func (d *Databases) index(s store.Store) int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for i, db := range d.dbs {
+		if db == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// database handles the SELECT, SWAPDB and FLUSHDB commands, SELECT changes
+// the database of the connection in db and unwatches the watched keys,
+// SWAPDB and FLUSHDB abort the transactions watching keys of their databases.
+// It returns false for other commands.
+func (c *Commander) database(db *int, tx *transaction, p *protocol.Protocol) (string, bool, error) {
+	switch p.Command {
+	case "SELECT", "SWAPDB", "FLUSHDB":
+	default:
+		return "", false, nil
+	}
+
+	if tx.active {
+		return "ERROR " + p.Command + " inside MULTI is not allowed\r", true, nil
+	}
+
+	indexes := make([]int, len(p.Args))
+	for i, arg := range p.Args {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 || n >= c.dbs.Len() {
+			return "ERROR DB index is out of range\r", true, nil
+		}
+		indexes[i] = n
+	}
+
+	switch p.Command {
+	case "SELECT":
+		*db = indexes[0]
+		tx.watched = nil
+	case "SWAPDB":
+		c.dbs.Swap(indexes[0], indexes[1])
+	case "FLUSHDB":
+		if err := c.dbs.Flush(*db); err != nil {
+			return "ERROR\r", true, err
+		}
+	}
+	return "OK\r", true, nil
+}
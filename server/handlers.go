@@ -2,17 +2,20 @@ package server
 
 import (
 	"bufio"
-	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"strconv"
+	"time"
 
+	"github.com/rsampaio/kvstore/protocol"
 	"github.com/rsampaio/kvstore/store"
 )
 
-// HandlerFunc define the function to handle each command
-type HandlerFunc func(store.Store, []string, *bufio.Reader, net.Conn) (string, error)
+// HandlerFunc define the function to handle each command,
+// it receives the command parsed by the protocol.
+type HandlerFunc func(store.Store, *protocol.Protocol, *bufio.Reader, net.Conn) (string, error)
 
 // Handlers is a map of HandlerFunc using commands as keys
 type Handlers map[string]HandlerFunc
@@ -28,44 +31,431 @@ var DefaultHandlers = Handlers{
 	"GET":    defaultHandler.Get,
 	"DELETE": defaultHandler.Delete,
 	"STREAM": defaultHandler.Stream,
+	"SCAN":   defaultHandler.Scan,
+	"RANGE":  defaultHandler.Range,
+
+	"LPUSH":     defaultHandler.LPush,
+	"RPOP":      defaultHandler.RPop,
+	"LRANGE":    defaultHandler.LRange,
+	"HSET":      defaultHandler.HSet,
+	"HGET":      defaultHandler.HGet,
+	"HGETALL":   defaultHandler.HGetAll,
+	"SADD":      defaultHandler.SAdd,
+	"SISMEMBER": defaultHandler.SIsMember,
+	"SMEMBERS":  defaultHandler.SMembers,
+	"ZADD":      defaultHandler.ZAdd,
+	"ZRANGE":    defaultHandler.ZRange,
+	"ZSCORE":    defaultHandler.ZScore,
+
+	"INCR":        defaultHandler.Incr,
+	"DECR":        defaultHandler.Incr,
+	"INCRBY":      defaultHandler.Incr,
+	"INCRBYFLOAT": defaultHandler.IncrByFloat,
+
+	"GETV": defaultHandler.GetVersion,
+	"CAS":  defaultHandler.CompareAndSwap,
+
+	"EXPIRE":  defaultHandler.Expire,
+	"TTL":     defaultHandler.TTL,
+	"PERSIST": defaultHandler.Persist,
+
+	"INFO":   defaultHandler.Info,
+	"MEMORY": defaultHandler.Memory,
 }
 
-// Set receives a store, slice of args and a value to store
-// and returns a reply and an error.
-func (h Handler) Set(s store.Store, args []string, in *bufio.Reader, conn net.Conn) (string, error) {
-	key := args[0]
-	size, err := strconv.ParseInt(args[1], 10, 64)
+// unsupported is the reply for commands the store does not implement.
+const unsupported = "ERROR not supported\r"
+
+// Set receives a store, the parsed command and a value to store
+// and returns a reply and an error, the EX option sets the key time to live in seconds.
+func (h Handler) Set(s store.Store, p *protocol.Protocol, in *bufio.Reader, conn net.Conn) (string, error) {
+	key := p.Args[0]
+
+	// The value is read straight into the slice kept by the store.
+	value, err := readValue(p, in)
 	if err != nil {
 		return "ERROR\r", err
 	}
 
-	buf := bytes.NewBufferString("")
-	io.CopyN(buf, in, size)
-	return "OK\r", s.Set(key, buf.String())
+	ex, withExpiry := p.Options["EX"]
+	if !withExpiry {
+		if err := s.Set(key, value); err != nil {
+			return clientError(err)
+		}
+		return "OK\r", nil
+	}
+
+	// The value and the deadline are set together so the key is never
+	// seen or logged without its time to live.
+	e, ok := s.(store.Expirer)
+	if !ok {
+		return unsupported, nil
+	}
+	seconds, _ := strconv.ParseInt(ex, 10, 64)
+	if err := e.SetExpire(key, value, time.Duration(seconds)*time.Second); err != nil {
+		return clientError(err)
+	}
+	return "OK\r", nil
 }
 
 // Get receives a store, a slice of args and a connection and
 // handles the GET command when it is parsed by the protocol.
-func (h Handler) Get(s store.Store, args []string, _ *bufio.Reader, conn net.Conn) (string, error) {
-	value, _ := s.Get(args[0])
-	fmt.Fprintf(conn, "VALUE %d\r\n", len(value))
-	buf := bytes.NewReader([]byte(value))
-	io.CopyN(conn, buf, int64(len(value)))
+// Keys holding a list, hash, set or sorted set reply a WRONGTYPE error.
+func (h Handler) Get(s store.Store, p *protocol.Protocol, _ *bufio.Reader, conn net.Conn) (string, error) {
+	if c, ok := s.(store.Collections); ok {
+		if t := c.Type(p.Args[0]); t != store.TypeString && t != store.TypeNone {
+			return clientError(store.ErrWrongType)
+		}
+	}
+
+	value, _ := s.Get(p.Args[0])
+	return writeValue(conn, value), nil
+}
+
+// GetVersion handles the GETV command, it replies like GET with the
+// version of the key after the value size.
+func (h Handler) GetVersion(s store.Store, p *protocol.Protocol, _ *bufio.Reader, conn net.Conn) (string, error) {
+	v, ok := s.(store.Versioned)
+	if !ok {
+		return unsupported, nil
+	}
+
+	value, version, _ := v.GetVersion(p.Args[0])
+	fmt.Fprintf(conn, "VALUE %d %d\r\n", len(value), version)
+	conn.Write(value)
 	return "\r", nil
 }
 
+// CompareAndSwap handles the CAS command, the value is only stored if the
+// key version matches the version returned by GETV, 0 for keys that do not
+// exist, and a conflict error is replied otherwise.
+func (h Handler) CompareAndSwap(s store.Store, p *protocol.Protocol, in *bufio.Reader, _ net.Conn) (string, error) {
+	value, err := readValue(p, in)
+	if err != nil {
+		return "ERROR\r", err
+	}
+
+	v, ok := s.(store.Versioned)
+	if !ok {
+		return unsupported, nil
+	}
+
+	version, err := strconv.ParseUint(p.Args[1], 10, 64)
+	if err != nil {
+		return "ERROR\r", err
+	}
+
+	if _, err := v.CompareAndSwap(p.Args[0], value, version); err != nil {
+		if err == store.ErrVersionMismatch {
+			return "ERROR conflict\r", nil
+		}
+		return clientError(err)
+	}
+	return "OK\r", nil
+}
+
 // Delete receives a store, a slice of args and a connection and
 // handles the GET command when it is parsed by the protocol.
-func (h Handler) Delete(s store.Store, args []string, _ *bufio.Reader, _ net.Conn) (string, error) {
-	return "OK\r", s.Delete(args[0])
+func (h Handler) Delete(s store.Store, p *protocol.Protocol, _ *bufio.Reader, _ net.Conn) (string, error) {
+	return "OK\r", s.Delete(p.Args[0])
 }
 
-// Stream sends all keys with associated values ordered by last modified time
-func (h Handler) Stream(s store.Store, _ []string, _ *bufio.Reader, conn net.Conn) (string, error) {
+// Stream sends all keys with associated values ordered by last modified time,
+// each pair is framed as a "key size" line followed by size bytes of the value
+// and CRLF so values may contain any byte.
+func (h Handler) Stream(s store.Store, _ *protocol.Protocol, _ *bufio.Reader, conn net.Conn) (string, error) {
+	// A view lists the keys at one point in time without touching the
+	// access tracking of the eviction policy.
+	s = store.ViewOf(s)
+	defer store.CloseView(s)
+
 	list := s.GetLastModifiedKeys()
 	for _, k := range list {
-		v, _ := s.Get(k)
-		fmt.Fprintln(conn, fmt.Sprintf("%v %v\r", k, v))
+		v, ok := s.Get(k)
+		if !ok {
+			continue
+		}
+		writePair(conn, k, v)
+	}
+	return "OK\r", nil
+}
+
+// Range sends the keys between start and end inclusive with their values in
+// lexicographic order, or reverse order with REVERSE, framed like STREAM.
+func (h Handler) Range(s store.Store, p *protocol.Protocol, _ *bufio.Reader, conn net.Conn) (string, error) {
+	r, ok := s.(store.Ranger)
+	if !ok {
+		return unsupported, nil
+	}
+
+	var limit int
+	if l, ok := p.Options["LIMIT"]; ok {
+		limit, _ = strconv.Atoi(l)
+	}
+	_, reverse := p.Options["REVERSE"]
+
+	for _, kv := range r.Range(p.Args[0], p.Args[1], limit, reverse) {
+		writePair(conn, kv.Key, kv.Value)
 	}
 	return "OK\r", nil
 }
+
+// readValue reads the value that follows a command that receives one.
+func readValue(p *protocol.Protocol, in *bufio.Reader) ([]byte, error) {
+	value := make([]byte, p.ValueSize)
+	if _, err := io.ReadFull(in, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// writeValue writes a value framed like the reply of GET.
+func writeValue(conn net.Conn, value []byte) string {
+	fmt.Fprintf(conn, "VALUE %d\r\n", len(value))
+	conn.Write(value)
+	return "\r"
+}
+
+// clientErrors are the store errors caused by the command of the client,
+// they are replied without closing the connection.
+var clientErrors = map[error]bool{
+	store.ErrWrongType:  true,
+	store.ErrNotInteger: true,
+	store.ErrNotFloat:   true,
+	store.ErrOverflow:   true,
+	store.ErrNaN:        true,
+
+	store.ErrOutOfCapacity: true,
+}
+
+// clientError converts the error of a store operation into a reply.
+func clientError(err error) (string, error) {
+	if clientErrors[err] {
+		return "ERROR " + err.Error() + "\r", nil
+	}
+	return "ERROR\r", err
+}
+
+// writePair writes a "key size" line followed by the value and CRLF.
+func writePair(conn net.Conn, key string, value []byte) {
+	fmt.Fprintf(conn, "%s %d\r\n", key, len(value))
+	conn.Write(value)
+	fmt.Fprint(conn, "\r\n")
+}
+
+// DefaultScanCount is the number of keys returned by SCAN without COUNT.
+const DefaultScanCount = 10
+
+// Scan replies a "SCAN cursor n" line followed by n keys, one per line, and OK,
+// the iteration is complete when the returned cursor is 0.
+func (h Handler) Scan(s store.Store, p *protocol.Protocol, _ *bufio.Reader, conn net.Conn) (string, error) {
+	sc, ok := s.(store.Scanner)
+	if !ok {
+		return unsupported, nil
+	}
+
+	cursor, err := strconv.ParseUint(p.Args[0], 10, 64)
+	if err != nil {
+		return "ERROR\r", err
+	}
+
+	pattern, ok := p.Options["MATCH"]
+	if !ok {
+		pattern = "*"
+	}
+
+	count := DefaultScanCount
+	if c, ok := p.Options["COUNT"]; ok {
+		count, _ = strconv.Atoi(c)
+	}
+
+	keys, next := sc.Scan(cursor, pattern, count)
+	fmt.Fprintf(conn, "SCAN %d %d\r\n", next, len(keys))
+	for _, k := range keys {
+		fmt.Fprintf(conn, "%s\r\n", k)
+	}
+	return "OK\r", nil
+}
+
+// Incr handles INCR, DECR and INCRBY, it atomically adds the increment to
+// the integer value of the key and replies the new value.
+func (h Handler) Incr(s store.Store, p *protocol.Protocol, _ *bufio.Reader, _ net.Conn) (string, error) {
+	u, ok := s.(store.Updater)
+	if !ok {
+		return unsupported, nil
+	}
+
+	var delta int64 = 1
+	switch p.Command {
+	case "DECR":
+		delta = -1
+	case "INCRBY":
+		delta, _ = strconv.ParseInt(p.Args[1], 10, 64)
+	}
+
+	n, err := store.IncrBy(u, p.Args[0], delta)
+	if err != nil {
+		return clientError(err)
+	}
+	return fmt.Sprintf("%d\r", n), nil
+}
+
+// IncrByFloat atomically adds the increment to the float value of the key
+// and replies the new value.
+func (h Handler) IncrByFloat(s store.Store, p *protocol.Protocol, _ *bufio.Reader, _ net.Conn) (string, error) {
+	u, ok := s.(store.Updater)
+	if !ok {
+		return unsupported, nil
+	}
+
+	delta, _ := strconv.ParseFloat(p.Args[1], 64)
+	f, err := store.IncrByFloat(u, p.Args[0], delta)
+	if err != nil {
+		return clientError(err)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64) + "\r", nil
+}
+
+// Expire sets the time to live of a key in seconds and replies 1
+// if the key exists or 0 otherwise.
+func (h Handler) Expire(s store.Store, p *protocol.Protocol, _ *bufio.Reader, _ net.Conn) (string, error) {
+	e, ok := s.(store.Expirer)
+	if !ok {
+		return unsupported, nil
+	}
+
+	seconds, err := strconv.Atoi(p.Args[1])
+	if err != nil {
+		return "ERROR\r", err
+	}
+	return reply(e.Expire(p.Args[0], time.Duration(seconds)*time.Second)), nil
+}
+
+// TTL replies the remaining time to live of a key in seconds,
+// -1 if the key has no deadline or -2 if the key does not exist.
+func (h Handler) TTL(s store.Store, p *protocol.Protocol, _ *bufio.Reader, _ net.Conn) (string, error) {
+	e, ok := s.(store.Expirer)
+	if !ok {
+		return unsupported, nil
+	}
+
+	ttl, ok := e.TTL(p.Args[0])
+	switch {
+	case !ok:
+		return "-2\r", nil
+	case ttl == store.NoExpiry:
+		return "-1\r", nil
+	}
+	return fmt.Sprintf("%d\r", int64(math.Round(ttl.Seconds()))), nil
+}
+
+// Persist removes the deadline of a key and replies 1 if the key had
+// a deadline or 0 otherwise.
+func (h Handler) Persist(s store.Store, p *protocol.Protocol, _ *bufio.Reader, _ net.Conn) (string, error) {
+	e, ok := s.(store.Expirer)
+	if !ok {
+		return unsupported, nil
+	}
+	return reply(e.Persist(p.Args[0])), nil
+}
+
+// reply converts a boolean result into an integer reply.
+func reply(ok bool) string {
+	if ok {
+		return "1\r"
+	}
+	return "0\r"
+}
+
+// Info replies the "name:value" lines describing the store, the operation
+// counters and the compression totals are included if the store implements
+// store.StatsReporter and store.Compressor.
+func (h Handler) Info(s store.Store, _ *protocol.Protocol, _ *bufio.Reader, conn net.Conn) (string, error) {
+	lines := []string{fmt.Sprintf("capacity_left:%d", s.Cap())}
+	if c, ok := s.(store.Compressor); ok {
+		stats := c.CompressionStats()
+		lines = append(lines,
+			fmt.Sprintf("compressed_values:%d", stats.Values),
+			fmt.Sprintf("compressed_raw_bytes:%d", stats.RawBytes),
+			fmt.Sprintf("compressed_bytes:%d", stats.StoredBytes),
+			fmt.Sprintf("compression_ratio:%.2f", stats.Ratio()),
+		)
+	}
+	if r, ok := s.(store.StatsReporter); ok {
+		stats := r.Stats()
+		lines = append(lines,
+			fmt.Sprintf("gets:%d", stats.Gets),
+			fmt.Sprintf("hits:%d", stats.Hits),
+			fmt.Sprintf("misses:%d", stats.Misses),
+			fmt.Sprintf("hit_rate:%.2f", stats.HitRate()),
+			fmt.Sprintf("sets:%d", stats.Sets),
+			fmt.Sprintf("deletes:%d", stats.Deletes),
+			fmt.Sprintf("evictions:%d", stats.Evictions),
+			fmt.Sprintf("evicted_bytes:%d", stats.EvictedBytes),
+		)
+	}
+
+	fmt.Fprintf(conn, "INFO %d\r\n", len(lines))
+	for _, l := range lines {
+		fmt.Fprintf(conn, "%s\r\n", l)
+	}
+	return "OK\r", nil
+}
+
+// Memory handles MEMORY USAGE, which replies the estimated bytes used by a
+// key and its value or 0 for a missing key, and MEMORY STATS, which replies
+// "name:value" lines with the estimated memory by category.
+func (h Handler) Memory(s store.Store, p *protocol.Protocol, _ *bufio.Reader, conn net.Conn) (string, error) {
+	m, ok := s.(store.MemoryReporter)
+	if !ok {
+		return unsupported, nil
+	}
+
+	if p.Args[0] == "USAGE" {
+		n, _ := m.MemoryUsage(p.Args[1])
+		return fmt.Sprintf("%d\r", n), nil
+	}
+
+	stats := m.MemoryStats()
+	lines := []string{
+		fmt.Sprintf("keys:%d", stats.Keys),
+		fmt.Sprintf("key_bytes:%d", stats.KeyBytes),
+		fmt.Sprintf("value_bytes:%d", stats.ValueBytes),
+		fmt.Sprintf("overhead_bytes:%d", stats.OverheadBytes),
+		fmt.Sprintf("total_bytes:%d", stats.Total()),
+		fmt.Sprintf("capacity_left:%d", s.Cap()),
+	}
+
+	fmt.Fprintf(conn, "MEMORY %d\r\n", len(lines))
+	for _, l := range lines {
+		fmt.Fprintf(conn, "%s\r\n", l)
+	}
+	return "OK\r", nil
+}
+
+// Saver is implemented by types that write snapshots of a store.
+type Saver interface {
+	// Save writes a snapshot and returns when it is done.
+	Save(store.Store) (string, error)
+	// BackgroundSave starts writing a snapshot and returns immediately.
+	BackgroundSave(store.Store) error
+}
+
+// SaveHandlers returns handlers for the SAVE and BGSAVE commands
+// that write snapshots of the store with sv.
+func SaveHandlers(sv Saver) Handlers {
+	return Handlers{
+		"SAVE": func(s store.Store, _ *protocol.Protocol, _ *bufio.Reader, _ net.Conn) (string, error) {
+			if _, err := sv.Save(s); err != nil {
+				return fmt.Sprintf("ERROR %v\r", err), nil
+			}
+			return "OK\r", nil
+		},
+		"BGSAVE": func(s store.Store, _ *protocol.Protocol, _ *bufio.Reader, _ net.Conn) (string, error) {
+			if err := sv.BackgroundSave(s); err != nil {
+				return fmt.Sprintf("ERROR %v\r", err), nil
+			}
+			return "OK\r", nil
+		},
+	}
+}
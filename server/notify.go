@@ -0,0 +1,32 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/rsampaio/kvstore/pubsub"
+	"github.com/rsampaio/kvstore/store"
+)
+
+// NotifyKeyspace publishes the changes of the databases implementing
+// store.Observable to b. Every change is published to the channel
+// __keyspace@<db>__:<key> with the event as message and to the channel
+// __keyevent@<db>__:<event> with the key as message, clients choose the
+// keys and events they receive with PSUBSCRIBE patterns.
+//
+// The database of a change is its number when the change happens so
+// changes follow the databases exchanged by SWAPDB.
+func NotifyKeyspace(dbs *Databases, b *pubsub.Broker) {
+	for i := 0; i < dbs.Len(); i++ {
+		s := dbs.Get(i)
+		o, ok := s.(store.Observable)
+		if !ok {
+			continue
+		}
+
+		o.Observe(func(e store.Event) {
+			db := dbs.index(s)
+			b.Publish(fmt.Sprintf("__keyspace@%d__:%s", db, e.Key), []byte(e.Type.String()))
+			b.Publish(fmt.Sprintf("__keyevent@%d__:%s", db, e.Type), []byte(e.Key))
+		})
+	}
+}
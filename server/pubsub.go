@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/rsampaio/kvstore/protocol"
+	"github.com/rsampaio/kvstore/pubsub"
+)
+
+// subscription is the push mode state of a connection, while the connection
+// has subscriptions a goroutine writes the received messages and only the
+// subscription commands are accepted.
+type subscription struct {
+	// mu serializes the writes of messages and replies to conn.
+	mu   sync.Mutex
+	conn net.Conn
+
+	sub  *pubsub.Subscriber
+	done chan struct{}
+}
+
+// reply writes a reply like the command loop.
+func (ps *subscription) reply(result string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	fmt.Fprintln(ps.conn, result)
+}
+
+// deliver writes the messages of sub until it is closed, the connection is
+// closed if the subscriber buffer overflowed.
+func (ps *subscription) deliver(sub *pubsub.Subscriber, done chan struct{}) {
+	defer close(done)
+
+	for m := range sub.Messages() {
+		ps.mu.Lock()
+		if m.Pattern != "" {
+			fmt.Fprintf(ps.conn, "PMESSAGE %s %s %d\r\n", m.Pattern, m.Channel, len(m.Payload))
+		} else {
+			fmt.Fprintf(ps.conn, "MESSAGE %s %d\r\n", m.Channel, len(m.Payload))
+		}
+		ps.conn.Write(m.Payload)
+		fmt.Fprint(ps.conn, "\r\n")
+		ps.mu.Unlock()
+	}
+
+	if sub.Overflowed() {
+		fmt.Printf("subscriber buffer full, closing connection from %v\n", ps.conn.RemoteAddr())
+		ps.conn.Close()
+	}
+}
+
+// stop closes the subscriber after the buffered messages are written and
+// leaves push mode.
+func (ps *subscription) stop() {
+	if ps.sub == nil {
+		return
+	}
+	ps.sub.Close()
+	<-ps.done
+	ps.sub, ps.done = nil, nil
+}
+
+// pubsub handles the PUBLISH and subscription commands writing their replies
+// and rejects the other commands in push mode, it returns false for other
+// commands outside of push mode.
+func (c *Commander) pubsub(ps *subscription, tx *transaction, p *protocol.Protocol, in *bufio.Reader) (bool, error) {
+	switch p.Command {
+	case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE":
+	case "PUBLISH":
+		// The value is read now so the connection is ready for the next command.
+		value, err := readValue(p, in)
+		if err != nil {
+			ps.reply("ERROR\r")
+			return true, err
+		}
+
+		switch {
+		case ps.sub != nil:
+			ps.reply("ERROR PUBLISH is not allowed in push mode\r")
+		case tx.active:
+			ps.reply("ERROR PUBLISH inside MULTI is not allowed\r")
+		default:
+			ps.reply(fmt.Sprintf("%d\r", c.broker.Publish(p.Args[0], value)))
+		}
+		return true, nil
+	default:
+		if ps.sub != nil {
+			ps.reply("ERROR only SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE and PUNSUBSCRIBE are allowed in push mode\r")
+			return true, nil
+		}
+		return false, nil
+	}
+
+	if tx.active {
+		ps.reply(fmt.Sprintf("ERROR %s inside MULTI is not allowed\r", p.Command))
+		return true, nil
+	}
+
+	if ps.sub == nil {
+		if p.Command == "UNSUBSCRIBE" || p.Command == "PUNSUBSCRIBE" {
+			ps.reply(p.Command + " 0\r")
+			return true, nil
+		}
+
+		ps.sub, ps.done = c.broker.NewSubscriber(), make(chan struct{})
+		go ps.deliver(ps.sub, ps.done)
+	}
+
+	names := p.Args
+	if len(names) == 0 {
+		if p.Command == "UNSUBSCRIBE" {
+			names = ps.sub.Channels()
+		} else {
+			names = ps.sub.Patterns()
+		}
+	}
+
+	// The confirmations are written before the messages of the new
+	// subscriptions.
+	ps.mu.Lock()
+	var lines []string
+	for _, name := range names {
+		var n int
+		switch p.Command {
+		case "SUBSCRIBE":
+			n = ps.sub.Subscribe(name)
+		case "PSUBSCRIBE":
+			n = ps.sub.PSubscribe(name)
+		case "UNSUBSCRIBE":
+			n = ps.sub.Unsubscribe(name)
+		case "PUNSUBSCRIBE":
+			n = ps.sub.PUnsubscribe(name)
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %d", p.Command, name, n))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, fmt.Sprintf("%s %d", p.Command, ps.sub.Count()))
+	}
+	fmt.Fprintln(ps.conn, strings.Join(lines, "\r\n")+"\r")
+	ps.mu.Unlock()
+
+	if ps.sub.Count() == 0 {
+		ps.stop()
+	}
+	return true, nil
+}
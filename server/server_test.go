@@ -2,11 +2,17 @@ package server
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/rsampaio/kvstore/protocol"
+	"github.com/rsampaio/kvstore/pubsub"
 	"github.com/rsampaio/kvstore/store"
 )
 
@@ -46,6 +52,653 @@ func TestServer(t *testing.T) {
 		}
 		c.Close()
 	})
+
+	t.Run("expire", func(t *testing.T) {
+		c, err := net.Dial("tcp", "localhost:10000")
+		if err != nil {
+			t.Fatalf("unexpected connect error: %v", err)
+		}
+		defer c.Close()
+
+		r := bufio.NewReader(c)
+		for _, tt := range []struct {
+			Command string
+			Reply   string
+		}{
+			{"SET bar 1 EX 100\r\na", "OK\r\n"},
+			{"TTL bar", "100\r\n"},
+			{"PERSIST bar", "1\r\n"},
+			{"TTL bar", "-1\r\n"},
+			{"EXPIRE baz 10", "0\r\n"},
+			{"TTL baz", "-2\r\n"},
+		} {
+			fmt.Fprintf(c, "%s\r\n", tt.Command)
+			if v, _ := r.ReadString('\n'); v != tt.Reply {
+				t.Errorf("%v: got %q, expected %q", tt.Command, v, tt.Reply)
+			}
+		}
+	})
+
+	t.Run("cas", func(t *testing.T) {
+		c, err := net.Dial("tcp", "localhost:10000")
+		if err != nil {
+			t.Fatalf("unexpected connect error: %v", err)
+		}
+		defer c.Close()
+
+		r := bufio.NewReader(c)
+		for _, tt := range []struct {
+			Command string
+			Reply   string
+		}{
+			{"CAS cas 0 1\r\na", "OK\r\n"},
+			{"CAS cas 0 1\r\nb", "ERROR conflict\r\n"},
+		} {
+			fmt.Fprintf(c, "%s\r\n", tt.Command)
+			if v, _ := r.ReadString('\n'); v != tt.Reply {
+				t.Errorf("%v: got %q, expected %q", tt.Command, v, tt.Reply)
+			}
+		}
+
+		var size int
+		var version uint64
+		fmt.Fprint(c, "GETV cas\r\n")
+		if _, err := fmt.Fscanf(r, "VALUE %d %d\r\n", &size, &version); err != nil || size != 1 {
+			t.Fatalf("unexpected GETV response: size %d err %v", size, err)
+		}
+		if v, _ := r.ReadString('\n'); v != "a\r\n" {
+			t.Errorf("unexpected GETV value: %q", v)
+		}
+
+		fmt.Fprintf(c, "CAS cas %d 1\r\nc\r\n", version)
+		if v, _ := r.ReadString('\n'); v != "OK\r\n" {
+			t.Errorf("unexpected CAS response: %q", v)
+		}
+	})
+
+	t.Run("waitkey", func(t *testing.T) {
+		c, err := net.Dial("tcp", "localhost:10000")
+		if err != nil {
+			t.Fatalf("unexpected connect error: %v", err)
+		}
+		defer c.Close()
+
+		other, err := net.Dial("tcp", "localhost:10000")
+		if err != nil {
+			t.Fatalf("unexpected connect error: %v", err)
+		}
+		defer other.Close()
+
+		r, or := bufio.NewReader(c), bufio.NewReader(other)
+
+		// A change before the waiter is parked is caught by the version.
+		fmt.Fprint(c, "WAITKEY wk 5 0\r\n")
+		fmt.Fprint(other, "SET wk 1\r\na\r\n")
+		if v, _ := or.ReadString('\n'); v != "OK\r\n" {
+			t.Fatalf("unexpected SET response: %q", v)
+		}
+
+		var size int
+		var version uint64
+		if _, err := fmt.Fscanf(r, "VALUE %d %d\r\n", &size, &version); err != nil || size != 1 || version == 0 {
+			t.Fatalf("unexpected WAITKEY response: size %d version %d err %v", size, version, err)
+		}
+		if v, _ := r.ReadString('\n'); v != "a\r\n" {
+			t.Errorf("unexpected WAITKEY value: %q", v)
+		}
+
+		fmt.Fprintf(c, "WAITKEY wk 5 %d\r\n", version)
+		fmt.Fprint(other, "DELETE wk\r\n")
+		if v, _ := or.ReadString('\n'); v != "OK\r\n" {
+			t.Fatalf("unexpected DELETE response: %q", v)
+		}
+		for _, reply := range []string{"VALUE 0 0\r\n", "\r\n"} {
+			if v, _ := r.ReadString('\n'); v != reply {
+				t.Errorf("WAITKEY: got %q, expected %q", v, reply)
+			}
+		}
+
+		fmt.Fprint(c, "WAITKEY wk 1\r\n")
+		if v, _ := r.ReadString('\n'); v != "TIMEOUT\r\n" {
+			t.Errorf("unexpected WAITKEY response: %q", v)
+		}
+
+		// Closing the connection releases the waiter.
+		fmt.Fprint(other, "WAITKEY wk\r\n")
+		time.Sleep(10 * time.Millisecond)
+		other.Close()
+
+		w := s.keyWaiters(st)
+		for i := 0; i < 100; i++ {
+			w.mu.Lock()
+			n := len(w.waiters["wk"])
+			w.mu.Unlock()
+			if n == 0 {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Error("expected the waiter to be released")
+	})
+
+	t.Run("info", func(t *testing.T) {
+		c, err := net.Dial("tcp", "localhost:10000")
+		if err != nil {
+			t.Fatalf("unexpected connect error: %v", err)
+		}
+		defer c.Close()
+
+		r := bufio.NewReader(c)
+		fmt.Fprint(c, "INFO\r\n")
+		if v, _ := r.ReadString('\n'); v != "INFO 13\r\n" {
+			t.Fatalf("unexpected INFO response: %q", v)
+		}
+
+		lines := make([]string, 13)
+		for i := range lines {
+			lines[i], _ = r.ReadString('\n')
+		}
+		if !strings.HasPrefix(lines[0], "capacity_left:") {
+			t.Errorf("unexpected capacity line: %q", lines[0])
+		}
+		if lines[4] != "compression_ratio:1.00\r\n" {
+			t.Errorf("unexpected ratio line: %q", lines[4])
+		}
+		if wants := fmt.Sprintf("hits:%d\r\n", st.Stats().Hits); lines[6] != wants {
+			t.Errorf("got hits line %q, wants: %q", lines[6], wants)
+		}
+		if v, _ := r.ReadString('\n'); v != "OK\r\n" {
+			t.Errorf("unexpected INFO end: %q", v)
+		}
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		c, err := net.Dial("tcp", "localhost:10000")
+		if err != nil {
+			t.Fatalf("unexpected connect error: %v", err)
+		}
+		defer c.Close()
+
+		r := bufio.NewReader(c)
+		fmt.Fprint(c, "SET mem 3\r\nabc\r\n")
+		if v, _ := r.ReadString('\n'); v != "OK\r\n" {
+			t.Fatalf("unexpected SET response: %q", v)
+		}
+
+		usage, _ := st.MemoryUsage("mem")
+		for cmd, reply := range map[string]string{
+			"MEMORY USAGE mem\r\n":     fmt.Sprintf("%d\r\n", usage),
+			"MEMORY USAGE missing\r\n": "0\r\n",
+		} {
+			fmt.Fprint(c, cmd)
+			if v, _ := r.ReadString('\n'); v != reply {
+				t.Errorf("%q: got %q, expected %q", cmd, v, reply)
+			}
+		}
+
+		fmt.Fprint(c, "MEMORY STATS\r\n")
+		if v, _ := r.ReadString('\n'); v != "MEMORY 6\r\n" {
+			t.Fatalf("unexpected MEMORY response: %q", v)
+		}
+		for _, name := range []string{"keys", "key_bytes", "value_bytes", "overhead_bytes", "total_bytes", "capacity_left"} {
+			if v, _ := r.ReadString('\n'); !strings.HasPrefix(v, name+":") {
+				t.Errorf("got %q, expected %v", v, name)
+			}
+		}
+		if v, _ := r.ReadString('\n'); v != "OK\r\n" {
+			t.Errorf("unexpected MEMORY end: %q", v)
+		}
+	})
+
+	t.Run("oversized", func(t *testing.T) {
+		for _, cmd := range []string{
+			"SET k 999999999999999999\r\n",
+			"CAS k 0 999999999999999999\r\n",
+			"LPUSH l 999999999999999999\r\n",
+			"HSET h f 999999999999999999\r\n",
+			"PUBLISH ch 999999999999999999\r\n",
+		} {
+			c, err := net.Dial("tcp", "localhost:10000")
+			if err != nil {
+				t.Fatalf("unexpected connect error: %v", err)
+			}
+
+			fmt.Fprint(c, cmd)
+			if v, _ := bufio.NewReader(c).ReadString('\n'); v != "ERROR\n" {
+				t.Errorf("%q: got %q, expected ERROR", cmd, v)
+			}
+			c.Close()
+		}
+	})
+
+	t.Run("scan", func(t *testing.T) {
+		c, err := net.Dial("tcp", "localhost:10000")
+		if err != nil {
+			t.Fatalf("unexpected connect error: %v", err)
+		}
+		defer c.Close()
+
+		r := bufio.NewReader(c)
+		for _, k := range []string{"scan:a", "scan:b", "noscan"} {
+			fmt.Fprintf(c, "SET %s 1\r\na\r\n", k)
+			if v, _ := r.ReadString('\n'); v != "OK\r\n" {
+				t.Fatalf("unexpected SET response: %q", v)
+			}
+		}
+
+		fmt.Fprint(c, "SCAN 0 MATCH scan:* COUNT 10\r\n")
+		if v, _ := r.ReadString('\n'); v != "SCAN 0 2\r\n" {
+			t.Fatalf("unexpected SCAN response: %q", v)
+		}
+
+		keys := map[string]bool{}
+		for i := 0; i < 2; i++ {
+			v, _ := r.ReadString('\n')
+			keys[v] = true
+		}
+		if !keys["scan:a\r\n"] || !keys["scan:b\r\n"] {
+			t.Errorf("unexpected SCAN keys: %v", keys)
+		}
+
+		if v, _ := r.ReadString('\n'); v != "OK\r\n" {
+			t.Errorf("unexpected SCAN response: %q", v)
+		}
+	})
+
+	t.Run("range", func(t *testing.T) {
+		c, err := net.Dial("tcp", "localhost:10000")
+		if err != nil {
+			t.Fatalf("unexpected connect error: %v", err)
+		}
+		defer c.Close()
+
+		r := bufio.NewReader(c)
+		for _, k := range []string{"range:1", "range:2", "range:3"} {
+			fmt.Fprintf(c, "SET %s 1\r\n%s\r\n", k, k[6:])
+			if v, _ := r.ReadString('\n'); v != "OK\r\n" {
+				t.Fatalf("unexpected SET response: %q", v)
+			}
+		}
+
+		fmt.Fprint(c, "RANGE range:1 range:3 LIMIT 2 REVERSE\r\n")
+		for _, want := range []string{"range:3 1\r\n", "3\r\n", "range:2 1\r\n", "2\r\n", "OK\r\n"} {
+			if v, _ := r.ReadString('\n'); v != want {
+				t.Errorf("got %q, expected %q", v, want)
+			}
+		}
+	})
+
+	t.Run("collections", func(t *testing.T) {
+		c, err := net.Dial("tcp", "localhost:10000")
+		if err != nil {
+			t.Fatalf("unexpected connect error: %v", err)
+		}
+		defer c.Close()
+
+		r := bufio.NewReader(c)
+		for _, tt := range []struct {
+			Command string
+			Replies []string
+		}{
+			{"LPUSH list 1\r\na", []string{"1\r\n"}},
+			{"LPUSH list 2\r\nbc", []string{"2\r\n"}},
+			{"LRANGE list 0 -1", []string{"LRANGE 2\r\n", "2\r\n", "bc\r\n", "1\r\n", "a\r\n", "OK\r\n"}},
+			{"RPOP list", []string{"VALUE 1\r\n", "a\r\n"}},
+			{"GET list", []string{"ERROR " + store.ErrWrongType.Error() + "\r\n"}},
+			{"HSET hash f 1\r\nv", []string{"1\r\n"}},
+			{"HGET hash f", []string{"VALUE 1\r\n", "v\r\n"}},
+			{"SADD set x y x", []string{"2\r\n"}},
+			{"SISMEMBER set y", []string{"1\r\n"}},
+			{"SMEMBERS list", []string{"ERROR " + store.ErrWrongType.Error() + "\r\n"}},
+			{"ZADD zset 2.5 m", []string{"1\r\n"}},
+			{"ZADD zset -1 n", []string{"1\r\n"}},
+			{"ZRANGE zset 0 -1 WITHSCORES", []string{"ZRANGE 2\r\n", "n -1\r\n", "m 2.5\r\n", "OK\r\n"}},
+			{"ZSCORE zset m", []string{"2.5\r\n"}},
+		} {
+			fmt.Fprintf(c, "%s\r\n", tt.Command)
+			for _, reply := range tt.Replies {
+				if v, _ := r.ReadString('\n'); v != reply {
+					t.Errorf("%v: got %q, expected %q", tt.Command, v, reply)
+				}
+			}
+		}
+	})
+
+	t.Run("counters", func(t *testing.T) {
+		c, err := net.Dial("tcp", "localhost:10000")
+		if err != nil {
+			t.Fatalf("unexpected connect error: %v", err)
+		}
+		defer c.Close()
+
+		r := bufio.NewReader(c)
+		for _, tt := range []struct {
+			Command string
+			Reply   string
+		}{
+			{"INCR counter", "1\r\n"},
+			{"INCRBY counter 41", "42\r\n"},
+			{"DECR counter", "41\r\n"},
+			{"GET counter", "VALUE 2\r\n"},
+			{"", "41\r\n"},
+			{"INCRBYFLOAT counter 0.5", "41.5\r\n"},
+			{"INCR counter", "ERROR " + store.ErrNotInteger.Error() + "\r\n"},
+		} {
+			fmt.Fprintf(c, "%s\r\n", tt.Command)
+			if v, _ := r.ReadString('\n'); v != tt.Reply {
+				t.Errorf("%v: got %q, expected %q", tt.Command, v, tt.Reply)
+			}
+		}
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		c, err := net.Dial("tcp", "localhost:10000")
+		if err != nil {
+			t.Fatalf("unexpected connect error: %v", err)
+		}
+		defer c.Close()
+
+		other, err := net.Dial("tcp", "localhost:10000")
+		if err != nil {
+			t.Fatalf("unexpected connect error: %v", err)
+		}
+		defer other.Close()
+
+		r := bufio.NewReader(c)
+		expect := func(command string, replies ...string) {
+			fmt.Fprintf(c, "%s\r\n", command)
+			for _, reply := range replies {
+				if v, _ := r.ReadString('\n'); v != reply {
+					t.Errorf("%v: got %q, expected %q", command, v, reply)
+				}
+			}
+		}
+
+		expect("WATCH tx", "OK\r\n")
+		fmt.Fprint(other, "SET tx 1\r\nb\r\n")
+		if v, _ := bufio.NewReader(other).ReadString('\n'); v != "OK\r\n" {
+			t.Fatalf("unexpected SET response: %q", v)
+		}
+
+		expect("MULTI", "OK\r\n")
+		expect("SET tx 1\r\na", "QUEUED\r\n")
+		expect("EXEC", "ABORTED\r\n")
+
+		expect("MULTI", "OK\r\n")
+		expect("DELETE tx", "QUEUED\r\n")
+		expect("DISCARD", "OK\r\n")
+		expect("EXEC", "ERROR EXEC without MULTI\r\n")
+
+		expect("MULTI", "OK\r\n")
+		expect("SET tx 1\r\na", "QUEUED\r\n")
+		expect("GET tx", "QUEUED\r\n")
+		expect("EXEC", "EXEC 2\r\n", "OK\r\n", "VALUE 1\r\n", "a\r\n", "OK\r\n")
+	})
+}
+
+func TestStreamBinary(t *testing.T) {
+	st := store.NewMemoryStore(100)
+	ln, _ := NewTCPListener("localhost:10002")
+	s := NewCommander(st, ln)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	c, err := net.Dial("tcp", "localhost:10002")
+	if err != nil {
+		t.Fatalf("unexpected connect error: %v", err)
+	}
+	defer c.Close()
+	r := bufio.NewReader(c)
+
+	values := map[string][]byte{
+		"foo": []byte("a\r\nb"),
+		"bar": {0, '\r', '\n', 0xff},
+	}
+	for _, k := range []string{"foo", "bar"} {
+		fmt.Fprintf(c, "SET %s %d\r\n", k, len(values[k]))
+		c.Write(values[k])
+		if v, _ := r.ReadString('\n'); v != "OK\r\n" {
+			t.Fatalf("unexpected SET response: %q", v)
+		}
+	}
+
+	fmt.Fprint(c, "STREAM\r\n")
+	for _, k := range []string{"bar", "foo"} {
+		var (
+			key  string
+			size int
+		)
+		if _, err := fmt.Fscanf(r, "%s %d\r\n", &key, &size); err != nil {
+			t.Fatalf("unexpected header error: %v", err)
+		}
+
+		v := make([]byte, size+2)
+		if _, err := io.ReadFull(r, v); err != nil {
+			t.Fatalf("unexpected read error: %v", err)
+		}
+
+		if key != k || !bytes.Equal(v[:size], values[k]) {
+			t.Errorf("got %v %q, expected %v %q", key, v[:size], k, values[k])
+		}
+	}
+
+	if v, _ := r.ReadString('\n'); v != "OK\r\n" {
+		t.Errorf("unexpected STREAM response: %q", v)
+	}
+}
+
+func TestOutOfCapacity(t *testing.T) {
+	st := store.NewMemoryStore(3, store.WithEvictionPolicy(store.NewNoEvictionPolicy()))
+	ln, _ := NewTCPListener("localhost:10006")
+	s := NewCommander(st, ln)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	c, err := net.Dial("tcp", "localhost:10006")
+	if err != nil {
+		t.Fatalf("unexpected connect error: %v", err)
+	}
+	defer c.Close()
+
+	r := bufio.NewReader(c)
+	for _, tt := range []struct {
+		Command string
+		Reply   string
+	}{
+		{"SET a 2\r\nab\r\n", "OK\r\n"},
+		{"SET b 2\r\ncd\r\n", "ERROR " + store.ErrOutOfCapacity.Error() + "\r\n"},
+		{"CAS b 0 2\r\ncd\r\n", "ERROR " + store.ErrOutOfCapacity.Error() + "\r\n"},
+		{"SET b 1\r\nc\r\n", "OK\r\n"},
+	} {
+		fmt.Fprint(c, tt.Command)
+		if v, _ := r.ReadString('\n'); v != tt.Reply {
+			t.Errorf("%q: got %q, expected %q", tt.Command, v, tt.Reply)
+		}
+	}
+}
+
+func TestDatabases(t *testing.T) {
+	dbs := NewDatabases(store.NewMemoryStore(100), store.NewMemoryStore(100))
+	ln, _ := NewTCPListener("localhost:10003")
+	s := NewCommander(dbs.Get(0), ln)
+	s.UseDatabases(dbs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	c, err := net.Dial("tcp", "localhost:10003")
+	if err != nil {
+		t.Fatalf("unexpected connect error: %v", err)
+	}
+	defer c.Close()
+
+	r := bufio.NewReader(c)
+	expect := func(command string, replies ...string) {
+		fmt.Fprintf(c, "%s\r\n", command)
+		for _, reply := range replies {
+			if v, _ := r.ReadString('\n'); v != reply {
+				t.Errorf("%v: got %q, expected %q", command, v, reply)
+			}
+		}
+	}
+
+	expect("SET foo 1\r\na", "OK\r\n")
+	expect("SELECT 1", "OK\r\n")
+	expect("GET foo", "VALUE 0\r\n", "\r\n")
+	expect("SET bar 1\r\nb", "OK\r\n")
+
+	expect("SWAPDB 0 1", "OK\r\n")
+	expect("GET foo", "VALUE 1\r\n", "a\r\n")
+	expect("SELECT 0", "OK\r\n")
+	expect("GET bar", "VALUE 1\r\n", "b\r\n")
+
+	expect("FLUSHDB", "OK\r\n")
+	expect("GET bar", "VALUE 0\r\n", "\r\n")
+	expect("SELECT 2", "ERROR DB index is out of range\r\n")
+
+	expect("MULTI", "OK\r\n")
+	expect("SELECT 1", "ERROR SELECT inside MULTI is not allowed\r\n")
+	expect("DISCARD", "OK\r\n")
+
+	other, err := net.Dial("tcp", "localhost:10003")
+	if err != nil {
+		t.Fatalf("unexpected connect error: %v", err)
+	}
+	defer other.Close()
+	otherReader := bufio.NewReader(other)
+
+	// Swapping or flushing the database modifies the watched keys.
+	for _, command := range []string{"SWAPDB 0 1", "FLUSHDB"} {
+		expect("WATCH foo", "OK\r\n")
+		fmt.Fprintf(other, "%s\r\n", command)
+		if v, _ := otherReader.ReadString('\n'); v != "OK\r\n" {
+			t.Fatalf("unexpected %s response: %q", command, v)
+		}
+		expect("MULTI", "OK\r\n")
+		expect("SET foo 1\r\nc", "QUEUED\r\n")
+		expect("EXEC", "ABORTED\r\n")
+	}
+
+	expect("WATCH foo", "OK\r\n")
+	expect("MULTI", "OK\r\n")
+	expect("SET foo 1\r\nc", "QUEUED\r\n")
+	expect("EXEC", "EXEC 1\r\n", "OK\r\n", "OK\r\n")
+}
+
+func TestPubSub(t *testing.T) {
+	st := store.NewMemoryStore(100)
+	ln, _ := NewTCPListener("localhost:10004")
+	s := NewCommander(st, ln)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	expecter := func(c net.Conn) func(string, ...string) {
+		r := bufio.NewReader(c)
+		return func(command string, replies ...string) {
+			if command != "" {
+				fmt.Fprintf(c, "%s\r\n", command)
+			}
+			for _, reply := range replies {
+				if v, _ := r.ReadString('\n'); v != reply {
+					t.Errorf("%v: got %q, expected %q", command, v, reply)
+				}
+			}
+		}
+	}
+
+	sub, err := net.Dial("tcp", "localhost:10004")
+	if err != nil {
+		t.Fatalf("unexpected connect error: %v", err)
+	}
+	defer sub.Close()
+
+	pub, err := net.Dial("tcp", "localhost:10004")
+	if err != nil {
+		t.Fatalf("unexpected connect error: %v", err)
+	}
+	defer pub.Close()
+
+	subscriber, publisher := expecter(sub), expecter(pub)
+
+	subscriber("SUBSCRIBE news", "SUBSCRIBE news 1\r\n")
+	subscriber("PSUBSCRIBE n*", "PSUBSCRIBE n* 2\r\n")
+	publisher("PUBLISH news 2\r\nhi", "2\r\n")
+	publisher("PUBLISH other 2\r\nhi", "0\r\n")
+
+	// Messages are pushed without a command.
+	subscriber("", "MESSAGE news 2\r\n", "hi\r\n", "PMESSAGE n* news 2\r\n", "hi\r\n")
+
+	subscriber("GET news", "ERROR only SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE and PUNSUBSCRIBE are allowed in push mode\r\n")
+	subscriber("UNSUBSCRIBE", "UNSUBSCRIBE news 1\r\n")
+	subscriber("PUNSUBSCRIBE n*", "PUNSUBSCRIBE n* 0\r\n")
+	publisher("PUBLISH news 2\r\nhi", "0\r\n")
+
+	// The connection leaves push mode without subscriptions.
+	subscriber("GET news", "VALUE 0\r\n", "\r\n")
+}
+
+func TestKeyspaceNotifications(t *testing.T) {
+	dbs := NewDatabases(store.NewMemoryStore(100), store.NewMemoryStore(100))
+	broker := pubsub.NewBroker()
+	NotifyKeyspace(dbs, broker)
+
+	ln, _ := NewTCPListener("localhost:10005")
+	s := NewCommander(dbs.Get(0), ln)
+	s.UseDatabases(dbs)
+	s.UseBroker(broker)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	sub, err := net.Dial("tcp", "localhost:10005")
+	if err != nil {
+		t.Fatalf("unexpected connect error: %v", err)
+	}
+	defer sub.Close()
+
+	c, err := net.Dial("tcp", "localhost:10005")
+	if err != nil {
+		t.Fatalf("unexpected connect error: %v", err)
+	}
+	defer c.Close()
+
+	r := bufio.NewReader(sub)
+	expect := func(replies ...string) {
+		for _, reply := range replies {
+			if v, _ := r.ReadString('\n'); v != reply {
+				t.Errorf("got %q, expected %q", v, reply)
+			}
+		}
+	}
+
+	fmt.Fprint(sub, "PSUBSCRIBE __keyspace@0__:user:*\r\n")
+	expect("PSUBSCRIBE __keyspace@0__:user:* 1\r\n")
+	fmt.Fprint(sub, "PSUBSCRIBE __keyevent@*__:del\r\n")
+	expect("PSUBSCRIBE __keyevent@*__:del 2\r\n")
+
+	cr := bufio.NewReader(c)
+	for _, command := range []string{"SET user:1 1\r\na", "SET other 1\r\nb", "DELETE user:1", "SWAPDB 0 1", "SET user:2 1\r\nc"} {
+		fmt.Fprintf(c, "%s\r\n", command)
+		if v, _ := cr.ReadString('\n'); v != "OK\r\n" {
+			t.Fatalf("%v: unexpected response %q", command, v)
+		}
+	}
+
+	expect(
+		"PMESSAGE __keyspace@0__:user:* __keyspace@0__:user:1 3\r\n", "set\r\n",
+		"PMESSAGE __keyspace@0__:user:* __keyspace@0__:user:1 3\r\n", "del\r\n",
+		"PMESSAGE __keyevent@*__:del __keyevent@0__:del 6\r\n", "user:1\r\n",
+		// The store of database 1 became database 0.
+		"PMESSAGE __keyspace@0__:user:* __keyspace@0__:user:2 3\r\n", "set\r\n",
+	)
 }
 
 func BenchmarkServer(b *testing.B) {
@@ -94,3 +747,21 @@ func BenchmarkServer(b *testing.B) {
 	})
 	cancel()
 }
+
+func TestSetExpireUnsupported(t *testing.T) {
+	// Embedding only store.Store hides the Expirer methods.
+	s := struct{ store.Store }{store.NewMemoryStore(100)}
+
+	p := &protocol.Protocol{}
+	if err := p.Parse("SET foo 1 EX 10"); err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	reply, err := defaultHandler.Set(s, p, bufio.NewReader(strings.NewReader("a\r\n")), nil)
+	if reply != unsupported || err != nil {
+		t.Errorf("got %q %v, expected %q", reply, err, unsupported)
+	}
+	if _, ok := s.Get("foo"); ok {
+		t.Error("expected foo not to be set")
+	}
+}
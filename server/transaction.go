@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/rsampaio/kvstore/protocol"
+	"github.com/rsampaio/kvstore/store"
+)
+
+// transaction is the MULTI state of a connection, commands are queued
+// until EXEC applies them atomically or DISCARD drops them.
+type transaction struct {
+	active  bool
+	queued  []queuedCommand
+	watched map[string]uint64
+	// gen is the generation of the database when the first key was watched.
+	gen uint64
+}
+
+// queuedCommand is a parsed command with the value it received.
+type queuedCommand struct {
+	p     protocol.Protocol
+	value []byte
+}
+
+// notQueued are the commands that cannot run inside a transaction.
+var notQueued = map[string]bool{
+	// The snapshot would outlive the transaction store.
+	"BGSAVE": true,
+}
+
+func (tx *transaction) reset() {
+	tx.active = false
+	tx.queued = nil
+	tx.watched = nil
+}
+
+// transact handles the transaction commands and queues the commands received
+// after MULTI, it returns false for commands that must run immediately.
+func (c *Commander) transact(s store.Store, db int, tx *transaction, p *protocol.Protocol, in *bufio.Reader, conn net.Conn) (string, bool, error) {
+	switch p.Command {
+	case "MULTI":
+		if _, ok := s.(store.Transactional); !ok {
+			return unsupported, true, nil
+		}
+		if tx.active {
+			return "ERROR MULTI calls can not be nested\r", true, nil
+		}
+		tx.active = true
+		return "OK\r", true, nil
+
+	case "DISCARD":
+		if !tx.active {
+			return "ERROR DISCARD without MULTI\r", true, nil
+		}
+		tx.reset()
+		return "OK\r", true, nil
+
+	case "WATCH":
+		if _, ok := s.(store.Transactional); !ok {
+			return unsupported, true, nil
+		}
+		if tx.active {
+			return "ERROR WATCH inside MULTI is not allowed\r", true, nil
+		}
+
+		// The revisions are taken from the store the generation belongs to
+		// in case the database was swapped since s was selected.
+		s, gen := c.dbs.generation(db)
+		t, ok := s.(store.Transactional)
+		if !ok {
+			return unsupported, true, nil
+		}
+		if tx.watched == nil {
+			tx.watched = make(map[string]uint64)
+			tx.gen = gen
+		}
+		for _, key := range p.Args {
+			if _, ok := tx.watched[key]; !ok {
+				tx.watched[key] = t.Revision(key)
+			}
+		}
+		return "OK\r", true, nil
+
+	case "EXEC":
+		if !tx.active {
+			return "ERROR EXEC without MULTI\r", true, nil
+		}
+		reply, err := c.exec(s, db, tx, conn)
+		return reply, true, err
+	}
+
+	if !tx.active {
+		return "", false, nil
+	}
+
+	// The value is read now so the connection is ready for the next command.
+	var value []byte
+	if p.ReceivesValue {
+		var err error
+		if value, err = readValue(p, in); err != nil {
+			return "ERROR\r", true, err
+		}
+	}
+
+	if _, ok := c.handlers[p.Command]; !ok {
+		return unsupported, true, nil
+	}
+
+	if notQueued[p.Command] {
+		return fmt.Sprintf("ERROR %s inside MULTI is not allowed\r", p.Command), true, nil
+	}
+
+	tx.queued = append(tx.queued, queuedCommand{p: *p, value: value})
+	return "QUEUED\r", true, nil
+}
+
+// exec applies the queued commands atomically, the replies are written after
+// an "EXEC n" line once the transaction is done and followed by OK, ABORTED
+// is replied without running any command if a watched key was modified or
+// the database was swapped or flushed since it was watched.
+func (c *Commander) exec(s store.Store, db int, tx *transaction, conn net.Conn) (string, error) {
+	defer tx.reset()
+
+	var out bytes.Buffer
+	w := &bufferedConn{Conn: conn, w: &out}
+
+	t, ok := s.(store.Transactional)
+	if !ok {
+		return unsupported, nil
+	}
+
+	err := t.Atomically(tx.watched, func(s store.Store) error {
+		if _, gen := c.dbs.generation(db); tx.watched != nil && gen != tx.gen {
+			return store.ErrConflict
+		}
+		fmt.Fprintf(&out, "EXEC %d\r\n", len(tx.queued))
+		for i := range tx.queued {
+			q := &tx.queued[i]
+			in := bufio.NewReader(bytes.NewReader(q.value))
+
+			// Errors are replied but do not stop the remaining commands.
+			result, _ := c.handlers[q.p.Command](s, &q.p, in, w)
+			fmt.Fprintln(w, result)
+		}
+		return nil
+	})
+
+	switch {
+	case err == store.ErrConflict:
+		return "ABORTED\r", nil
+	case err != nil:
+		return "ERROR\r", err
+	}
+
+	if _, err := conn.Write(out.Bytes()); err != nil {
+		return "ERROR\r", err
+	}
+	return "OK\r", nil
+}
+
+// bufferedConn replaces the writes to a connection with writes to w.
+type bufferedConn struct {
+	net.Conn
+	w io.Writer
+}
+
+func (b *bufferedConn) Write(p []byte) (int, error) {
+	return b.w.Write(p)
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rsampaio/kvstore/protocol"
+	"github.com/rsampaio/kvstore/store"
+)
+
+// keyWaiters wakes the connections waiting for the changes of keys of a store.
+type keyWaiters struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+// add returns a channel closed on the next change of key.
+func (w *keyWaiters) add(key string) chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ch := make(chan struct{})
+	if w.waiters[key] == nil {
+		w.waiters[key] = make(map[chan struct{}]struct{})
+	}
+	w.waiters[key][ch] = struct{}{}
+	return ch
+}
+
+// remove drops a channel returned by add that was not closed.
+func (w *keyWaiters) remove(key string, ch chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.waiters[key], ch)
+	if len(w.waiters[key]) == 0 {
+		delete(w.waiters, key)
+	}
+}
+
+// observe wakes the waiters of the changed key, it is called by the store.
+func (w *keyWaiters) observe(e store.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ch := range w.waiters[e.Key] {
+		close(ch)
+	}
+	delete(w.waiters, e.Key)
+}
+
+// keyWaiters returns the waiters of s observing it the first time.
+func (c *Commander) keyWaiters(s store.Observable) *keyWaiters {
+	c.waitersMu.Lock()
+	defer c.waitersMu.Unlock()
+
+	if w, ok := c.waiters[s]; ok {
+		return w
+	}
+
+	if c.waiters == nil {
+		c.waiters = make(map[store.Observable]*keyWaiters)
+	}
+	w := &keyWaiters{waiters: make(map[string]map[chan struct{}]struct{})}
+	s.Observe(w.observe)
+	c.waiters[s] = w
+	return w
+}
+
+// waitKey handles the WAITKEY command, it blocks until the key is modified
+// or deleted and replies like GETV, a version of 0 is a deleted key. With a
+// since version it replies immediately if the key version is not since.
+// TIMEOUT is replied once the timeout in seconds passes, a timeout of 0
+// waits forever. It returns false for other commands.
+func (c *Commander) waitKey(ctx context.Context, s store.Store, tx *transaction, p *protocol.Protocol, in *bufio.Reader, conn net.Conn) (string, bool, error) {
+	if p.Command != "WAITKEY" {
+		return "", false, nil
+	}
+
+	if tx.active {
+		return "ERROR WAITKEY inside MULTI is not allowed\r", true, nil
+	}
+
+	o, ok := s.(store.Observable)
+	if !ok {
+		return unsupported, true, nil
+	}
+	v, ok := s.(store.Versioned)
+	if !ok {
+		return unsupported, true, nil
+	}
+
+	key := p.Args[0]
+	var timeout <-chan time.Time
+	if len(p.Args) > 1 && p.Args[1] != "0" {
+		seconds, _ := strconv.Atoi(p.Args[1])
+		t := time.NewTimer(time.Duration(seconds) * time.Second)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	// The waiter is added before the version is read so a change in
+	// between is not missed.
+	w := c.keyWaiters(o)
+	changed := w.add(key)
+
+	if len(p.Args) > 2 {
+		since, _ := strconv.ParseUint(p.Args[2], 10, 64)
+		if _, version, _ := v.GetVersion(key); version != since {
+			w.remove(key, changed)
+			result, err := defaultHandler.GetVersion(s, p, in, conn)
+			return result, true, err
+		}
+	}
+
+	closed := closeNotify(conn, in)
+	defer closed.stop()
+
+	select {
+	case <-changed:
+		result, err := defaultHandler.GetVersion(s, p, in, conn)
+		return result, true, err
+	case <-timeout:
+		w.remove(key, changed)
+		return "TIMEOUT\r", true, nil
+	case <-ctx.Done():
+	case <-closed.done:
+	}
+
+	// The command loop returns on the next read.
+	w.remove(key, changed)
+	return "ERROR\r", true, nil
+}
+
+// disconnect detects a client closing its connection while a command waits.
+type disconnect struct {
+	conn net.Conn
+	// done is closed when the client disconnects.
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// closeNotify peeks at in until the client disconnects or stop is called,
+// commands pipelined by the client are kept in the buffer.
+func closeNotify(conn net.Conn, in *bufio.Reader) *disconnect {
+	d := &disconnect{conn: conn, done: make(chan struct{}), stopped: make(chan struct{})}
+
+	go func() {
+		defer close(d.stopped)
+		if _, err := in.Peek(1); err != nil {
+			if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+				close(d.done)
+			}
+		}
+	}()
+	return d
+}
+
+// stop interrupts the peek with a read deadline and waits for it so the
+// buffer is only used by the command loop again.
+func (d *disconnect) stop() {
+	d.conn.SetReadDeadline(time.Now())
+	<-d.stopped
+	d.conn.SetReadDeadline(time.Time{})
+}
@@ -0,0 +1,10 @@
+/*
+Package snapshot writes and loads point-in-time binary snapshots of a store.
+The snapshot package defines the snapshot format with Write and Read, every
+snapshot ends with a CRC-32 checksum of its contents and keys are written from
+the least to the most recently modified so loading a snapshot keeps the order
+used by STREAM. The Snapshotter type saves snapshots atomically to a directory,
+in the foreground, in the background or on a timer and loads the newest valid
+snapshot at startup.
+*/
+package snapshot
@@ -0,0 +1,302 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"time"
+
+	"github.com/rsampaio/kvstore/store"
+)
+
+// magic identifies snapshot files and the format version.
+var magic = []byte("KVSNAP01")
+
+const (
+	opEntry byte = 1
+	opList  byte = 2
+	opHash  byte = 3
+	opSet   byte = 4
+	opZSet  byte = 5
+	opEOF   byte = 0xff
+)
+
+// ErrChecksum is returned when the checksum of a snapshot does not match its contents.
+var ErrChecksum = errors.New("snapshot checksum mismatch")
+
+// Write writes a snapshot of s to w, the keys are written from the least
+// to the most recently modified and each entry carries its expiry deadline.
+// Stores implementing store.Viewer are written from a point-in-time view.
+// Lists, hashes, sets and sorted sets are written as entries with their
+// elements when s implements store.Collections.
+func Write(w io.Writer, s store.Store) error {
+	// Writers are not blocked while the snapshot is written from a view.
+	if v := store.ViewOf(s); v != s {
+		defer store.CloseView(v)
+		s = v
+	}
+
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+
+	e, _ := s.(store.Expirer)
+	c, _ := s.(store.Collections)
+	keys := s.GetLastModifiedKeys()
+
+	bw.Write(magic)
+	for i := len(keys) - 1; i >= 0; i-- {
+		v, ok := s.Get(keys[i])
+		switch {
+		case ok:
+			bw.WriteByte(opEntry)
+			writeBytes(bw, []byte(keys[i]))
+			writeBytes(bw, v)
+		case c != nil && writeCollection(bw, c, keys[i]):
+		default:
+			continue
+		}
+
+		var deadline int64
+		if e != nil {
+			if ttl, ok := e.TTL(keys[i]); ok && ttl != store.NoExpiry {
+				deadline = time.Now().Add(ttl).UnixNano()
+			}
+		}
+
+		writeUvarint(bw, uint64(deadline))
+	}
+	bw.WriteByte(opEOF)
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// Verify reads the whole snapshot from r and checks its checksum.
+func Verify(r io.Reader) error {
+	crc := crc32.NewIEEE()
+	br := bufio.NewReader(r)
+
+	// The last four bytes are the checksum of everything before them.
+	var tail []byte
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := br.Read(buf)
+		tail = append(tail, buf[:n]...)
+		if len(tail) > 4 {
+			crc.Write(tail[:len(tail)-4])
+			tail = append(tail[:0], tail[len(tail)-4:]...)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(tail) < 4 || binary.BigEndian.Uint32(tail) != crc.Sum32() {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// Read loads the entries of a snapshot from r into s in the order they were
+// written, expired entries are skipped. The checksum should be checked with
+// Verify first since entries are applied as they are read.
+func Read(r io.Reader, s store.Store) error {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, header); err != nil {
+		return err
+	}
+	if !bytes.Equal(header, magic) {
+		return errors.New("invalid snapshot header")
+	}
+
+	e, _ := s.(store.Expirer)
+	now := time.Now()
+	for {
+		op, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		if op == opEOF {
+			return nil
+		}
+
+		key, err := readBytes(br)
+		if err != nil {
+			return err
+		}
+
+		var apply func() error
+		switch op {
+		case opEntry:
+			value, err := readBytes(br)
+			if err != nil {
+				return err
+			}
+			apply = func() error { return s.Set(string(key), value) }
+		case opList, opHash, opSet, opZSet:
+			c, ok := s.(store.Collections)
+			if !ok {
+				return errors.New("snapshot has collections but the store does not support them")
+			}
+			if apply, err = readCollection(br, c, op, string(key)); err != nil {
+				return err
+			}
+		default:
+			return errors.New("invalid snapshot entry")
+		}
+
+		deadline, err := binary.ReadUvarint(br)
+		if err != nil {
+			return err
+		}
+
+		expires := time.Unix(0, int64(deadline))
+		if deadline != 0 && !expires.After(now) {
+			continue
+		}
+
+		if err := apply(); err != nil {
+			return err
+		}
+		if deadline != 0 && e != nil {
+			e.Expire(string(key), expires.Sub(now))
+		}
+	}
+}
+
+// writeCollection writes the entry of the collection of key and returns
+// false if key does not hold a collection.
+func writeCollection(w *bufio.Writer, c store.Collections, key string) bool {
+	switch c.Type(key) {
+	case store.TypeList:
+		values, _ := c.LRange(key, 0, -1)
+		w.WriteByte(opList)
+		writeBytes(w, []byte(key))
+		writeUvarint(w, uint64(len(values)))
+		for _, v := range values {
+			writeBytes(w, v)
+		}
+	case store.TypeHash:
+		fields, _ := c.HGetAll(key)
+		w.WriteByte(opHash)
+		writeBytes(w, []byte(key))
+		writeUvarint(w, uint64(len(fields)))
+		for _, f := range fields {
+			writeBytes(w, []byte(f.Key))
+			writeBytes(w, f.Value)
+		}
+	case store.TypeSet:
+		members, _ := c.SMembers(key)
+		w.WriteByte(opSet)
+		writeBytes(w, []byte(key))
+		writeUvarint(w, uint64(len(members)))
+		for _, m := range members {
+			writeBytes(w, []byte(m))
+		}
+	case store.TypeZSet:
+		members, _ := c.ZRange(key, 0, -1)
+		w.WriteByte(opZSet)
+		writeBytes(w, []byte(key))
+		writeUvarint(w, uint64(len(members)))
+		for _, m := range members {
+			writeBytes(w, []byte(m.Member))
+			writeUvarint(w, math.Float64bits(m.Score))
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// readCollection reads the elements of a collection entry and returns a
+// function that adds them to c.
+func readCollection(r *bufio.Reader, c store.Collections, op byte, key string) (func() error, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var values [][]byte
+	var scores []float64
+	for i := uint64(0); i < n; i++ {
+		b, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, b)
+
+		switch op {
+		case opHash:
+			v, err := readBytes(r)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		case opZSet:
+			bits, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			scores = append(scores, math.Float64frombits(bits))
+		}
+	}
+
+	return func() error {
+		var err error
+		switch op {
+		case opList:
+			// LPUSH inserts at the head so the tail is pushed first.
+			for i := len(values) - 1; i >= 0 && err == nil; i-- {
+				_, err = c.LPush(key, values[i])
+			}
+		case opHash:
+			for i := 0; i < len(values) && err == nil; i += 2 {
+				_, err = c.HSet(key, string(values[i]), values[i+1])
+			}
+		case opSet:
+			for i := 0; i < len(values) && err == nil; i++ {
+				_, err = c.SAdd(key, string(values[i]))
+			}
+		case opZSet:
+			for i := 0; i < len(values) && err == nil; i++ {
+				_, err = c.ZAdd(key, scores[i], string(values[i]))
+			}
+		}
+		return err
+	}, nil
+}
+
+func writeUvarint(w *bufio.Writer, n uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], n)])
+}
+
+func writeBytes(w *bufio.Writer, b []byte) {
+	writeUvarint(w, uint64(len(b)))
+	w.Write(b)
+}
+
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,146 @@
+package snapshot
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rsampaio/kvstore/store"
+)
+
+func TestWriteRead(t *testing.T) {
+	s := store.NewMemoryStore(100)
+	defer s.Close()
+	s.Set("foo", []byte("a\r\n\x00b"))
+	s.Set("bar", []byte("1"))
+	s.Set("baz", []byte("2"))
+	s.Set("foo", []byte("3"))
+	s.Expire("bar", time.Hour)
+
+	var buf bytes.Buffer
+	if err := Write(&buf, s); err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+
+	if err := Verify(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("unexpected verify error: %v", err)
+	}
+
+	r := store.NewMemoryStore(100)
+	defer r.Close()
+	if err := Read(&buf, r); err != nil {
+		t.Fatalf("unexpected read error: %v", err)
+	}
+
+	// The modification order used by STREAM is kept.
+	if got, want := r.GetLastModifiedKeys(), s.GetLastModifiedKeys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wants: %v", got, want)
+	}
+
+	if ttl, _ := r.TTL("bar"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("unexpected ttl %v", ttl)
+	}
+}
+
+func TestWriteReadCollections(t *testing.T) {
+	s := store.NewMemoryStore(100)
+	s.LPush("list", []byte("a"), []byte("b"))
+	s.HSet("hash", "f", []byte("v"))
+	s.SAdd("set", "x", "y")
+	s.ZAdd("zset", -0.5, "m")
+
+	var buf bytes.Buffer
+	if err := Write(&buf, s); err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+
+	r := store.NewMemoryStore(100)
+	if err := Read(&buf, r); err != nil {
+		t.Fatalf("unexpected read error: %v", err)
+	}
+
+	if got, want := r.GetLastModifiedKeys(), s.GetLastModifiedKeys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wants: %v", got, want)
+	}
+
+	list, _ := r.LRange("list", 0, -1)
+	if want := [][]byte{[]byte("b"), []byte("a")}; !reflect.DeepEqual(list, want) {
+		t.Errorf("got list %q, wants: %q", list, want)
+	}
+
+	if v, _, _ := r.HGet("hash", "f"); string(v) != "v" {
+		t.Errorf("got field %q, wants: %q", v, "v")
+	}
+
+	if ok, _ := r.SIsMember("set", "y"); !ok {
+		t.Errorf("expected y to be a member")
+	}
+
+	if score, _, _ := r.ZScore("zset", "m"); score != -0.5 {
+		t.Errorf("got score %v, wants: %v", score, -0.5)
+	}
+
+	if r.Cap() != s.Cap() {
+		t.Errorf("got cap %d, wants: %d", r.Cap(), s.Cap())
+	}
+}
+
+func TestVerifyCorrupted(t *testing.T) {
+	s := store.NewMemoryStore(100)
+	s.Set("foo", []byte("bar"))
+
+	var buf bytes.Buffer
+	Write(&buf, s)
+	b := buf.Bytes()
+	b[len(magic)+3] ^= 0xff
+
+	if err := Verify(bytes.NewReader(b)); err != ErrChecksum {
+		t.Errorf("got %v, wants: %v", err, ErrChecksum)
+	}
+}
+
+func TestSnapshotter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := store.NewMemoryStore(100)
+	sn := New(dir)
+	sn.Keep = 2
+
+	s.Set("foo", []byte("1"))
+	if _, err := sn.Save(s); err != nil {
+		t.Fatalf("unexpected save error: %v", err)
+	}
+
+	s.Set("bar", []byte("2"))
+	path, err := sn.Save(s)
+	if err != nil {
+		t.Fatalf("unexpected save error: %v", err)
+	}
+
+	// A newer corrupted snapshot is skipped in favour of the last valid one.
+	ioutil.WriteFile(filepath.Join(dir, prefix+"99999999999999999999"+suffix), []byte("KVSNAP01"), 0644)
+
+	r := store.NewMemoryStore(100)
+	loaded, err := sn.LoadLatest(r)
+	if err != nil || loaded != path {
+		t.Fatalf("got %v %v, wants: %v", loaded, err, path)
+	}
+
+	if got := r.GetLastModifiedKeys(); !reflect.DeepEqual(got, []string{"bar", "foo"}) {
+		t.Errorf("got %v, wants: %v", got, []string{"bar", "foo"})
+	}
+
+	s.Set("baz", []byte("3"))
+	sn.Save(s)
+	if paths, _ := sn.list(); len(paths) != 2 {
+		t.Errorf("expected old snapshots to be pruned, got %v", paths)
+	}
+}
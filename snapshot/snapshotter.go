@@ -0,0 +1,212 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rsampaio/kvstore/store"
+)
+
+const (
+	prefix = "dump-"
+	suffix = ".kvs"
+)
+
+// DefaultKeep is the number of snapshots kept in the directory.
+const DefaultKeep = 3
+
+// ErrInProgress is returned when a snapshot is requested while another one is being saved.
+var ErrInProgress = errors.New("snapshot already in progress")
+
+// Snapshotter saves snapshots of a store to a directory.
+type Snapshotter struct {
+	// Keep is the number of snapshots kept, older snapshots are removed
+	// after a successful save.
+	Keep int
+
+	dir string
+
+	mu     sync.Mutex
+	saving bool
+}
+
+// New creates a Snapshotter that saves snapshots in dir.
+func New(dir string) *Snapshotter {
+	return &Snapshotter{Keep: DefaultKeep, dir: dir}
+}
+
+// Save writes a snapshot of s and returns its path, the snapshot is written
+// to a temporary file that is renamed once it is synced so a crash never
+// leaves a partial snapshot behind.
+func (sn *Snapshotter) Save(s store.Store) (string, error) {
+	if !sn.start() {
+		return "", ErrInProgress
+	}
+	defer sn.finish()
+	return sn.save(s)
+}
+
+// BackgroundSave starts saving a snapshot of s in a new goroutine, stores
+// implementing store.Viewer are saved as they are when it is called.
+func (sn *Snapshotter) BackgroundSave(s store.Store) error {
+	if !sn.start() {
+		return ErrInProgress
+	}
+	s = store.ViewOf(s)
+
+	go func() {
+		defer sn.finish()
+		defer store.CloseView(s)
+		if path, err := sn.save(s); err != nil {
+			fmt.Printf("snapshot-save error=%v\n", err)
+		} else {
+			fmt.Printf("snapshot-saved path=%v\n", path)
+		}
+	}()
+	return nil
+}
+
+// Run saves a snapshot of s on every interval until ctx is done.
+func (sn *Snapshotter) Run(ctx context.Context, s store.Store, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := sn.BackgroundSave(s); err != nil {
+				fmt.Printf("snapshot-save error=%v\n", err)
+			}
+		}
+	}
+}
+
+// LoadLatest loads the newest snapshot with a valid checksum into s and
+// returns its path, it returns an empty path when there is no valid snapshot.
+func (sn *Snapshotter) LoadLatest(s store.Store) (string, error) {
+	paths, err := sn.list()
+	if err != nil {
+		return "", err
+	}
+
+	for i := len(paths) - 1; i >= 0; i-- {
+		if err := verifyFile(paths[i]); err != nil {
+			fmt.Printf("snapshot-skipped path=%v error=%v\n", paths[i], err)
+			continue
+		}
+
+		f, err := os.Open(paths[i])
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		return paths[i], Read(f, s)
+	}
+	return "", nil
+}
+
+func (sn *Snapshotter) start() bool {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	if sn.saving {
+		return false
+	}
+	sn.saving = true
+	return true
+}
+
+func (sn *Snapshotter) finish() {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	sn.saving = false
+}
+
+func (sn *Snapshotter) save(s store.Store) (string, error) {
+	if err := os.MkdirAll(sn.dir, 0755); err != nil {
+		return "", err
+	}
+
+	f, err := ioutil.TempFile(sn.dir, "tmp-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	if err := Write(f, s); err != nil {
+		f.Close()
+		return "", err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return "", err
+	}
+
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	// Nanosecond timestamps are zero padded so names sort by time.
+	path := filepath.Join(sn.dir, fmt.Sprintf("%s%020d%s", prefix, time.Now().UnixNano(), suffix))
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", err
+	}
+
+	if d, err := os.Open(sn.dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	sn.prune()
+	return path, nil
+}
+
+// list returns the snapshot paths from the oldest to the newest.
+func (sn *Snapshotter) list() ([]string, error) {
+	files, err := ioutil.ReadDir(sn.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, fi := range files {
+		if strings.HasPrefix(fi.Name(), prefix) && strings.HasSuffix(fi.Name(), suffix) {
+			paths = append(paths, filepath.Join(sn.dir, fi.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (sn *Snapshotter) prune() {
+	paths, err := sn.list()
+	if err != nil || sn.Keep < 1 || len(paths) <= sn.Keep {
+		return
+	}
+
+	for _, p := range paths[:len(paths)-sn.Keep] {
+		os.Remove(p)
+	}
+}
+
+func verifyFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return Verify(f)
+}
@@ -0,0 +1,121 @@
+package store
+
+// ARCPolicy implements the Adaptive Replacement Cache policy.
+//
+// Resident keys are split between t1, keys seen once recently, and t2, keys
+// seen at least twice. Evicted keys are remembered in the ghost lists b1 and
+// b2 and a hit on a ghost key adapts the target size of t1 so the policy
+// balances between recency and frequency depending on the workload.
+//
+// The MemoryStore evicts by bytes and not by number of keys, so the cache
+// size used to bound the ghost lists is the largest number of resident keys
+// seen so far.
+type ARCPolicy struct {
+	t1, t2 *keyList
+	b1, b2 *keyList
+
+	// p is the target size of t1.
+	p int
+	// c is the largest number of resident keys seen.
+	c int
+}
+
+// NewARCPolicy creates an adaptive replacement cache eviction policy.
+func NewARCPolicy() *ARCPolicy {
+	return &ARCPolicy{
+		t1: newKeyList(),
+		t2: newKeyList(),
+		b1: newKeyList(),
+		b2: newKeyList(),
+	}
+}
+
+// Added tracks key in t1, or in t2 when key was recently evicted.
+func (p *ARCPolicy) Added(key string) {
+	switch {
+	case p.b1.remove(key):
+		p.p = min(p.p+max(p.b2.Len()/max(p.b1.Len(), 1), 1), p.c)
+		p.t2.pushFront(key)
+	case p.b2.remove(key):
+		p.p = max(p.p-max(p.b1.Len()/max(p.b2.Len(), 1), 1), 0)
+		p.t2.pushFront(key)
+	default:
+		p.t1.pushFront(key)
+	}
+
+	if n := p.t1.Len() + p.t2.Len(); n > p.c {
+		p.c = n
+	}
+	p.trim()
+}
+
+// Accessed promotes key to the most recently used position of t2.
+func (p *ARCPolicy) Accessed(key string) {
+	if p.t1.remove(key) {
+		p.t2.pushFront(key)
+		return
+	}
+	p.t2.moveToFront(key)
+}
+
+// Removed stops tracking key without remembering it as a ghost.
+func (p *ARCPolicy) Removed(key string) {
+	_ = p.t1.remove(key) || p.t2.remove(key) || p.b1.remove(key) || p.b2.remove(key)
+}
+
+// Victim evicts from t1 while it is larger than its target size and from t2
+// otherwise, the evicted key is remembered in the matching ghost list.
+func (p *ARCPolicy) Victim() (string, bool) {
+	var key string
+	switch {
+	case p.t1.Len() > 0 && (p.t1.Len() > p.p || p.t2.Len() == 0):
+		key, _ = p.t1.popBack()
+		p.b1.pushFront(key)
+	case p.t2.Len() > 0:
+		key, _ = p.t2.popBack()
+		p.b2.pushFront(key)
+	default:
+		return "", false
+	}
+
+	p.trim()
+	return key, true
+}
+
+// VictimExcept is Victim choosing a key other than except, except keeps its
+// place in t1 or t2.
+func (p *ARCPolicy) VictimExcept(except string) (string, bool) {
+	n1, n2 := p.t1.Len(), p.t2.Len()
+	if p.t1.contains(except) {
+		n1--
+	} else if p.t2.contains(except) {
+		n2--
+	}
+
+	var key string
+	switch {
+	case n1 > 0 && (p.t1.Len() > p.p || n2 == 0):
+		key, _ = p.t1.backExcept(except)
+		p.t1.remove(key)
+		p.b1.pushFront(key)
+	case n2 > 0:
+		key, _ = p.t2.backExcept(except)
+		p.t2.remove(key)
+		p.b2.pushFront(key)
+	default:
+		return "", false
+	}
+
+	p.trim()
+	return key, true
+}
+
+// trim bounds the ghost lists so |t1|+|b1| <= c and the total is at most 2c.
+func (p *ARCPolicy) trim() {
+	for p.b1.Len() > 0 && p.t1.Len()+p.b1.Len() > p.c {
+		p.b1.popBack()
+	}
+	for p.b2.Len() > 0 && p.t1.Len()+p.t2.Len()+p.b1.Len()+p.b2.Len() > 2*p.c {
+		p.b2.popBack()
+	}
+}
@@ -0,0 +1,83 @@
+package store
+
+import "sync/atomic"
+
+// DeleteReason is why an entry was removed from a MemoryStore.
+type DeleteReason int
+
+// Reasons reported to the function set by WithOnDelete.
+const (
+	// ReasonCapacity is an entry evicted to make room for a write.
+	ReasonCapacity DeleteReason = iota + 1
+	// ReasonExpired is an entry whose deadline passed.
+	ReasonExpired
+	// ReasonDeleted is an entry deleted by Delete or a non-positive Expire.
+	ReasonDeleted
+)
+
+func (r DeleteReason) String() string {
+	switch r {
+	case ReasonCapacity:
+		return "capacity"
+	case ReasonExpired:
+		return "expired"
+	case ReasonDeleted:
+		return "deleted"
+	}
+	return "unknown"
+}
+
+// WithOnDelete sets a function called with the key, the value and the reason
+// of every entry evicted, expired or deleted, the value is nil for lists,
+// hashes, sets and sorted sets. It is called after the store lock is
+// released so it may call back into the store.
+func WithOnDelete(fn func(key string, value []byte, reason DeleteReason)) Option {
+	return func(m *MemoryStore) {
+		m.onDelete = fn
+	}
+}
+
+// removal is a removed entry waiting to be reported.
+type removal struct {
+	e      *entry
+	reason DeleteReason
+}
+
+// removed counts e and queues it to be reported once m.mu is released,
+// m.mu must be held.
+func (m *MemoryStore) removed(e *entry, reason DeleteReason) {
+	switch reason {
+	case ReasonCapacity:
+		atomic.AddUint64(&m.counters.evictions, 1)
+		atomic.AddUint64(&m.counters.evictedBytes, uint64(e.size()))
+	case ReasonDeleted:
+		atomic.AddUint64(&m.counters.deletes, 1)
+	}
+
+	if m.onDelete == nil && (m.onEvict == nil || reason != ReasonCapacity) {
+		return
+	}
+	m.pending = append(m.pending, removal{e: e, reason: reason})
+}
+
+// unlock releases m.mu and reports the entries removed while it was held,
+// removed entries are not modified so their values are read after unlocking.
+func (m *MemoryStore) unlock() {
+	pending := m.pending
+	m.pending = nil
+	m.mu.Unlock()
+
+	for _, r := range pending {
+		var value []byte
+		if r.e.coll == nil {
+			value = r.e.bytes()
+		}
+
+		if m.onEvict != nil && r.reason == ReasonCapacity && r.e.coll == nil {
+			m.onEvict(r.e.key, value)
+		}
+		if m.onDelete != nil {
+			m.onDelete(r.e.key, value, r.reason)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// deletion is a call of the function set by WithOnDelete.
+type deletion struct {
+	Key    string
+	Value  string
+	Reason DeleteReason
+}
+
+func TestOnDelete(t *testing.T) {
+	var got []deletion
+	var s *MemoryStore
+	s = NewMemoryStore(3, WithReapInterval(time.Hour), WithOnDelete(func(key string, value []byte, reason DeleteReason) {
+		got = append(got, deletion{key, string(value), reason})
+		// The lock is released so the store may be used.
+		s.Cap()
+	}))
+	defer s.Close()
+
+	s.Set("a", []byte("1"))
+	s.Set("b", []byte("2"))
+	s.Set("c", []byte("3"))
+	s.Set("d", []byte("4"))
+	s.Delete("b")
+	s.Expire("c", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	s.Get("c")
+	s.Expire("d", 0)
+	s.LPush("list", []byte("x"))
+	s.Delete("list")
+
+	wants := []deletion{
+		{"a", "1", ReasonCapacity},
+		{"b", "2", ReasonDeleted},
+		{"c", "3", ReasonExpired},
+		{"d", "4", ReasonDeleted},
+		{"list", "", ReasonDeleted},
+	}
+	if !reflect.DeepEqual(got, wants) {
+		t.Errorf("got %v, wants: %v", got, wants)
+	}
+}
+
+func TestOnDeleteTransaction(t *testing.T) {
+	var evicted, deleted []string
+	s := NewMemoryStore(1,
+		WithOnEvict(func(key string, value []byte) { evicted = append(evicted, key) }),
+		WithOnDelete(func(key string, value []byte, reason DeleteReason) { deleted = append(deleted, key) }),
+	)
+
+	s.Set("a", []byte("1"))
+	err := s.Atomically(nil, func(tx Store) error {
+		tx.Set("b", []byte("2"))
+		tx.Delete("b")
+		if len(deleted) != 0 {
+			t.Error("expected the deletions to be reported after the transaction")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if wants := []string{"a"}; !reflect.DeepEqual(evicted, wants) {
+		t.Errorf("got evicted %v, wants: %v", evicted, wants)
+	}
+	if wants := []string{"a", "b"}; !reflect.DeepEqual(deleted, wants) {
+		t.Errorf("got deleted %v, wants: %v", deleted, wants)
+	}
+}
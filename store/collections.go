@@ -0,0 +1,533 @@
+package store
+
+import "sync/atomic"
+
+// Type returns the type of the value of key.
+func (m *MemoryStore) Type(key string) Type {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.typeOf(key)
+}
+
+// LPush inserts values at the head of the list.
+func (m *MemoryStore) LPush(key string, values ...[]byte) (int, error) {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.lpush(key, values)
+}
+
+// RPop removes and returns the last element of the list.
+func (m *MemoryStore) RPop(key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.rpop(key)
+}
+
+// LRange returns the elements of the list between start and stop.
+func (m *MemoryStore) LRange(key string, start, stop int) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.lrange(key, start, stop)
+}
+
+// HSet sets a field of the hash.
+func (m *MemoryStore) HSet(key, field string, value []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.hset(key, field, value)
+}
+
+// HGet returns the value of a field of the hash.
+func (m *MemoryStore) HGet(key, field string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.hget(key, field)
+}
+
+// HGetAll returns the fields of the hash.
+func (m *MemoryStore) HGetAll(key string) ([]KeyValue, error) {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.hgetall(key)
+}
+
+// SAdd adds members to the set.
+func (m *MemoryStore) SAdd(key string, members ...string) (int, error) {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.sadd(key, members)
+}
+
+// SIsMember reports whether member is in the set.
+func (m *MemoryStore) SIsMember(key, member string) (bool, error) {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.sismember(key, member)
+}
+
+// SMembers returns the members of the set.
+func (m *MemoryStore) SMembers(key string) ([]string, error) {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.smembers(key)
+}
+
+// ZAdd sets the score of a member of the sorted set.
+func (m *MemoryStore) ZAdd(key string, score float64, member string) (bool, error) {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.zadd(key, score, member)
+}
+
+// ZRange returns the members of the sorted set between the ranks start and stop.
+func (m *MemoryStore) ZRange(key string, start, stop int) ([]ScoredMember, error) {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.zrange(key, start, stop)
+}
+
+// ZScore returns the score of a member of the sorted set.
+func (m *MemoryStore) ZScore(key, member string) (float64, bool, error) {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.zscore(key, member)
+}
+
+// typeOf returns the type of the value of key, m.mu must be held.
+func (m *MemoryStore) typeOf(key string) Type {
+	e, ok := m.lookup(key)
+	if !ok {
+		return TypeNone
+	}
+	return e.typ()
+}
+
+// collection returns the collection of key for a read or nil if key does
+// not exist, m.mu must be held.
+func (m *MemoryStore) collection(key string, t Type) (collection, error) {
+	e, _ := m.lookup(key)
+	c, err := typed(e, t)
+	if c != nil {
+		m.policy.Accessed(key)
+	}
+	return c, err
+}
+
+// typed returns the collection of e if it has type t or nil if e is nil.
+func typed(e *entry, t Type) (collection, error) {
+	if e == nil {
+		return nil, nil
+	}
+	if e.typ() != t {
+		return nil, ErrWrongType
+	}
+	return e.coll, nil
+}
+
+// mutable returns the entry of key for a write or a new entry with an empty
+// collection when key does not exist, new entries are linked by reserve,
+// m.mu must be held.
+func (m *MemoryStore) mutable(key string, t Type, empty func() collection) (*entry, error) {
+	e, ok := m.lookup(key)
+	if !ok {
+		return &entry{key: key, coll: empty(), expiryIndex: -1}, nil
+	}
+	if e.typ() != t {
+		return nil, ErrWrongType
+	}
+	m.own(e)
+	return e, nil
+}
+
+// reserve evicts other entries to make room for delta bytes written to the
+// collection of e and links e if it is new, it returns ErrOutOfCapacity
+// without evicting when they cannot fit, m.mu must be held.
+func (m *MemoryStore) reserve(e *entry, delta int) error {
+	added := m.items[e.key] != e
+	need := delta
+	if added {
+		need += m.overhead(e.key)
+	}
+	if m.cap >= need {
+		if added {
+			m.add(e)
+		}
+		return nil
+	}
+
+	if !evicts(m.policy) {
+		return ErrOutOfCapacity
+	}
+
+	// The bytes of e are not given back by evicting the other entries.
+	used := 0
+	if !added {
+		used = e.size() + m.overhead(e.key)
+	}
+	if need > m.limit-used {
+		return ErrOutOfCapacity
+	}
+
+	// e is spared while cleaning, policies that cannot spare it stop
+	// tracking it meanwhile so it is not evicted.
+	_, sparing := m.policy.(Sparing)
+	if !added && !sparing {
+		m.policy.Removed(e.key)
+	}
+	m.clean(need, e.key)
+	if !added && !sparing {
+		m.policy.Added(e.key)
+	}
+	if m.cap < need {
+		return ErrOutOfCapacity
+	}
+	if added {
+		m.add(e)
+	}
+	return nil
+}
+
+// changed accounts delta bytes written to the collection of e and notifies
+// the write, empty collections are removed like a deleted key, m.mu must be held.
+func (m *MemoryStore) changed(e *entry, delta int) {
+	m.cap -= delta
+	if e.coll.len() == 0 {
+		m.remove(e)
+		m.policy.Removed(e.key)
+		m.removed(e, ReasonDeleted)
+		m.notify(EventDelete, e.key)
+		return
+	}
+
+	m.modified.moveToFront(e)
+	m.policy.Accessed(e.key)
+	e.rev = atomic.AddUint64(m.rev, 1)
+	m.notify(EventSet, e.key)
+}
+
+func (m *MemoryStore) lpush(key string, values [][]byte) (int, error) {
+	e, err := m.mutable(key, TypeList, func() collection { return &listValue{} })
+	if err != nil {
+		return 0, err
+	}
+
+	var delta int
+	for _, v := range values {
+		delta += len(v)
+	}
+	if err := m.reserve(e, delta); err != nil {
+		return 0, err
+	}
+
+	l := e.coll.(*listValue)
+	l.rev = append(l.rev, values...)
+	l.bytes += delta
+	m.changed(e, delta)
+	return l.len(), nil
+}
+
+func (m *MemoryStore) rpop(key string) ([]byte, bool, error) {
+	c, err := m.collection(key, TypeList)
+	if c == nil {
+		return nil, false, err
+	}
+
+	e := m.items[key]
+	m.own(e)
+	l := e.coll.(*listValue)
+	v := l.rev[0]
+	l.rev[0] = nil
+	l.rev = l.rev[1:]
+	l.bytes -= len(v)
+	m.changed(e, -len(v))
+	return v, true, nil
+}
+
+func (m *MemoryStore) lrange(key string, start, stop int) ([][]byte, error) {
+	c, err := m.collection(key, TypeList)
+	if c == nil {
+		return nil, err
+	}
+
+	return c.(*listValue).slice(start, stop), nil
+}
+
+func (m *MemoryStore) hset(key, field string, value []byte) (bool, error) {
+	e, err := m.mutable(key, TypeHash, func() collection {
+		return &hashValue{fields: make(map[string][]byte)}
+	})
+	if err != nil {
+		return false, err
+	}
+
+	h := e.coll.(*hashValue)
+	old, ok := h.fields[field]
+	delta := len(value) - len(old)
+	if !ok {
+		delta += len(field)
+	}
+	if err := m.reserve(e, delta); err != nil {
+		return false, err
+	}
+
+	h.fields[field] = value
+	h.bytes += delta
+	m.changed(e, delta)
+	return !ok, nil
+}
+
+func (m *MemoryStore) hget(key, field string) ([]byte, bool, error) {
+	c, err := m.collection(key, TypeHash)
+	if c == nil {
+		return nil, false, err
+	}
+
+	v, ok := c.(*hashValue).fields[field]
+	return v, ok, nil
+}
+
+func (m *MemoryStore) hgetall(key string) ([]KeyValue, error) {
+	c, err := m.collection(key, TypeHash)
+	if c == nil {
+		return nil, err
+	}
+
+	return c.(*hashValue).all(), nil
+}
+
+func (m *MemoryStore) sadd(key string, members []string) (int, error) {
+	e, err := m.mutable(key, TypeSet, func() collection {
+		return &setValue{members: make(map[string]struct{})}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s := e.coll.(*setValue)
+	added := make(map[string]struct{})
+	var delta int
+	for _, member := range members {
+		_, ok := s.members[member]
+		if _, dup := added[member]; !ok && !dup {
+			added[member] = struct{}{}
+			delta += len(member)
+		}
+	}
+	if err := m.reserve(e, delta); err != nil {
+		return 0, err
+	}
+
+	for member := range added {
+		s.members[member] = struct{}{}
+	}
+	s.bytes += delta
+	m.changed(e, delta)
+	return len(added), nil
+}
+
+func (m *MemoryStore) sismember(key, member string) (bool, error) {
+	c, err := m.collection(key, TypeSet)
+	if c == nil {
+		return false, err
+	}
+
+	_, ok := c.(*setValue).members[member]
+	return ok, nil
+}
+
+func (m *MemoryStore) smembers(key string) ([]string, error) {
+	c, err := m.collection(key, TypeSet)
+	if c == nil {
+		return nil, err
+	}
+
+	return c.(*setValue).sorted(), nil
+}
+
+// zsetMemberSize is the number of bytes counted for the score of a member.
+const zsetMemberSize = 8
+
+func (m *MemoryStore) zadd(key string, score float64, member string) (bool, error) {
+	e, err := m.mutable(key, TypeZSet, func() collection {
+		return &zsetValue{scores: make(map[string]float64), index: newSkiplist()}
+	})
+	if err != nil {
+		return false, err
+	}
+
+	z := e.coll.(*zsetValue)
+	var delta int
+	old, ok := z.scores[member]
+	if !ok {
+		delta = len(member) + zsetMemberSize
+	}
+	if err := m.reserve(e, delta); err != nil {
+		return false, err
+	}
+
+	if ok {
+		z.index.delete(zsetKey(old, member))
+	}
+
+	z.scores[member] = score
+	z.index.insert(zsetKey(score, member))
+	z.bytes += delta
+	m.changed(e, delta)
+	return !ok, nil
+}
+
+func (m *MemoryStore) zrange(key string, start, stop int) ([]ScoredMember, error) {
+	c, err := m.collection(key, TypeZSet)
+	if c == nil {
+		return nil, err
+	}
+
+	return c.(*zsetValue).slice(start, stop), nil
+}
+
+func (m *MemoryStore) zscore(key, member string) (float64, bool, error) {
+	c, err := m.collection(key, TypeZSet)
+	if c == nil {
+		return 0, false, err
+	}
+
+	score, ok := c.(*zsetValue).scores[member]
+	return score, ok, nil
+}
+
+// Type returns the type of the value of key from its shard.
+func (s *ShardedStore) Type(key string) Type { return s.shard(key).Type(key) }
+
+// LPush inserts values at the head of the list in the shard of key.
+func (s *ShardedStore) LPush(key string, values ...[]byte) (int, error) {
+	return s.shard(key).LPush(key, values...)
+}
+
+// RPop removes and returns the last element of the list in the shard of key.
+func (s *ShardedStore) RPop(key string) ([]byte, bool, error) { return s.shard(key).RPop(key) }
+
+// LRange returns the elements of the list in the shard of key.
+func (s *ShardedStore) LRange(key string, start, stop int) ([][]byte, error) {
+	return s.shard(key).LRange(key, start, stop)
+}
+
+// HSet sets a field of the hash in the shard of key.
+func (s *ShardedStore) HSet(key, field string, value []byte) (bool, error) {
+	return s.shard(key).HSet(key, field, value)
+}
+
+// HGet returns a field of the hash in the shard of key.
+func (s *ShardedStore) HGet(key, field string) ([]byte, bool, error) {
+	return s.shard(key).HGet(key, field)
+}
+
+// HGetAll returns the fields of the hash in the shard of key.
+func (s *ShardedStore) HGetAll(key string) ([]KeyValue, error) { return s.shard(key).HGetAll(key) }
+
+// SAdd adds members to the set in the shard of key.
+func (s *ShardedStore) SAdd(key string, members ...string) (int, error) {
+	return s.shard(key).SAdd(key, members...)
+}
+
+// SIsMember reports whether member is in the set in the shard of key.
+func (s *ShardedStore) SIsMember(key, member string) (bool, error) {
+	return s.shard(key).SIsMember(key, member)
+}
+
+// SMembers returns the members of the set in the shard of key.
+func (s *ShardedStore) SMembers(key string) ([]string, error) { return s.shard(key).SMembers(key) }
+
+// ZAdd sets the score of a member of the sorted set in the shard of key.
+func (s *ShardedStore) ZAdd(key string, score float64, member string) (bool, error) {
+	return s.shard(key).ZAdd(key, score, member)
+}
+
+// ZRange returns members of the sorted set in the shard of key.
+func (s *ShardedStore) ZRange(key string, start, stop int) ([]ScoredMember, error) {
+	return s.shard(key).ZRange(key, start, stop)
+}
+
+// ZScore returns the score of a member of the sorted set in the shard of key.
+func (s *ShardedStore) ZScore(key, member string) (float64, bool, error) {
+	return s.shard(key).ZScore(key, member)
+}
+
+func (t *memoryTx) Type(key string) Type { return t.m.typeOf(key) }
+
+func (t *memoryTx) LPush(key string, values ...[]byte) (int, error) {
+	return t.m.lpush(key, values)
+}
+
+func (t *memoryTx) RPop(key string) ([]byte, bool, error) { return t.m.rpop(key) }
+
+func (t *memoryTx) LRange(key string, start, stop int) ([][]byte, error) {
+	return t.m.lrange(key, start, stop)
+}
+
+func (t *memoryTx) HSet(key, field string, value []byte) (bool, error) {
+	return t.m.hset(key, field, value)
+}
+
+func (t *memoryTx) HGet(key, field string) ([]byte, bool, error) { return t.m.hget(key, field) }
+
+func (t *memoryTx) HGetAll(key string) ([]KeyValue, error) { return t.m.hgetall(key) }
+
+func (t *memoryTx) SAdd(key string, members ...string) (int, error) {
+	return t.m.sadd(key, members)
+}
+
+func (t *memoryTx) SIsMember(key, member string) (bool, error) { return t.m.sismember(key, member) }
+
+func (t *memoryTx) SMembers(key string) ([]string, error) { return t.m.smembers(key) }
+
+func (t *memoryTx) ZAdd(key string, score float64, member string) (bool, error) {
+	return t.m.zadd(key, score, member)
+}
+
+func (t *memoryTx) ZRange(key string, start, stop int) ([]ScoredMember, error) {
+	return t.m.zrange(key, start, stop)
+}
+
+func (t *memoryTx) ZScore(key, member string) (float64, bool, error) { return t.m.zscore(key, member) }
+
+func (t *shardedTx) Type(key string) Type { return t.tx(key).Type(key) }
+
+func (t *shardedTx) LPush(key string, values ...[]byte) (int, error) {
+	return t.tx(key).LPush(key, values...)
+}
+
+func (t *shardedTx) RPop(key string) ([]byte, bool, error) { return t.tx(key).RPop(key) }
+
+func (t *shardedTx) LRange(key string, start, stop int) ([][]byte, error) {
+	return t.tx(key).LRange(key, start, stop)
+}
+
+func (t *shardedTx) HSet(key, field string, value []byte) (bool, error) {
+	return t.tx(key).HSet(key, field, value)
+}
+
+func (t *shardedTx) HGet(key, field string) ([]byte, bool, error) { return t.tx(key).HGet(key, field) }
+
+func (t *shardedTx) HGetAll(key string) ([]KeyValue, error) { return t.tx(key).HGetAll(key) }
+
+func (t *shardedTx) SAdd(key string, members ...string) (int, error) {
+	return t.tx(key).SAdd(key, members...)
+}
+
+func (t *shardedTx) SIsMember(key, member string) (bool, error) {
+	return t.tx(key).SIsMember(key, member)
+}
+
+func (t *shardedTx) SMembers(key string) ([]string, error) { return t.tx(key).SMembers(key) }
+
+func (t *shardedTx) ZAdd(key string, score float64, member string) (bool, error) {
+	return t.tx(key).ZAdd(key, score, member)
+}
+
+func (t *shardedTx) ZRange(key string, start, stop int) ([]ScoredMember, error) {
+	return t.tx(key).ZRange(key, start, stop)
+}
+
+func (t *shardedTx) ZScore(key, member string) (float64, bool, error) {
+	return t.tx(key).ZScore(key, member)
+}
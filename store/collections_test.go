@@ -0,0 +1,163 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	s := NewMemoryStore(100)
+	if n, _ := s.LPush("l", []byte("a"), []byte("b")); n != 2 {
+		t.Errorf("got length %d, wants: %d", n, 2)
+	}
+	s.LPush("l", []byte("cc"))
+
+	got, _ := s.LRange("l", 0, -1)
+	if want := [][]byte{[]byte("cc"), []byte("b"), []byte("a")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, wants: %q", got, want)
+	}
+
+	if got, _ := s.LRange("l", -2, 10); len(got) != 2 || string(got[0]) != "b" {
+		t.Errorf("unexpected range %q", got)
+	}
+
+	if s.Cap() != 96 {
+		t.Errorf("got cap %d, wants: %d", s.Cap(), 96)
+	}
+
+	for _, want := range []string{"a", "b", "cc"} {
+		if v, ok, _ := s.RPop("l"); !ok || string(v) != want {
+			t.Errorf("got %q, wants: %q", v, want)
+		}
+	}
+
+	if s.Type("l") != TypeNone || s.Cap() != 100 {
+		t.Errorf("expected empty list to be removed, type %v cap %d", s.Type("l"), s.Cap())
+	}
+}
+
+func TestCollectionEviction(t *testing.T) {
+	s := NewMemoryStore(10, WithEvictionPolicy(NewFIFOPolicy()))
+	s.LPush("l", []byte("1234"))
+	s.Set("b", []byte("1"))
+
+	// The list is the first key in FIFO order but only b is evicted for it.
+	if n, err := s.LPush("l", []byte("123456")); n != 2 || err != nil {
+		t.Errorf("got %d %v, wants: %d", n, err, 2)
+	}
+	if s.Type("l") != TypeList || s.Type("b") != TypeNone {
+		t.Errorf("got types %v %v, wants b to be evicted", s.Type("l"), s.Type("b"))
+	}
+
+	// Elements that cannot fit are refused and the list is kept.
+	if _, err := s.LPush("l", []byte("1")); err != ErrOutOfCapacity {
+		t.Errorf("got %v, wants: %v", err, ErrOutOfCapacity)
+	}
+	if got, _ := s.LRange("l", 0, -1); len(got) != 2 || s.Cap() != 0 {
+		t.Errorf("got %q cap %d, wants 2 elements and cap 0", got, s.Cap())
+	}
+	if _, err := s.SAdd("s", "12345678901"); err != ErrOutOfCapacity || s.Type("s") != TypeNone {
+		t.Errorf("got %v type %v, wants: %v", err, s.Type("s"), ErrOutOfCapacity)
+	}
+}
+
+func TestCollectionEvictionLFU(t *testing.T) {
+	s := NewMemoryStore(12, WithEvictionPolicy(NewLFUPolicy()))
+	for i := 0; i < 4; i++ {
+		s.LPush("l", []byte("1"))
+	}
+	s.Set("a", []byte("1"))
+	s.Get("a")
+	s.Get("a")
+	s.Set("b", []byte("1234"))
+
+	// b is evicted for the list, which keeps its frequency while cleaning.
+	if _, err := s.LPush("l", []byte("12345")); err != nil || s.Type("b") != TypeNone {
+		t.Fatalf("got %v type %v, wants b to be evicted", err, s.Type("b"))
+	}
+
+	// The list is written more often than a so a is evicted for c.
+	if err := s.Set("c", []byte("123")); err != nil {
+		t.Fatal(err)
+	}
+	if s.Type("l") != TypeList || s.Type("a") != TypeNone {
+		t.Errorf("got types %v %v, wants a to be evicted", s.Type("l"), s.Type("a"))
+	}
+}
+
+func TestHashAndSet(t *testing.T) {
+	s := NewMemoryStore(100)
+	s.HSet("h", "f1", []byte("aa"))
+	if added, _ := s.HSet("h", "f1", []byte("b")); added {
+		t.Errorf("expected existing field")
+	}
+	s.HSet("h", "f0", []byte("c"))
+
+	if v, ok, _ := s.HGet("h", "f1"); !ok || string(v) != "b" {
+		t.Errorf("got %q, wants: %q", v, "b")
+	}
+
+	all, _ := s.HGetAll("h")
+	if want := []KeyValue{{"f0", []byte("c")}, {"f1", []byte("b")}}; !reflect.DeepEqual(all, want) {
+		t.Errorf("got %v, wants: %v", all, want)
+	}
+
+	if n, _ := s.SAdd("s", "x", "y", "x"); n != 2 {
+		t.Errorf("got %d new members, wants: %d", n, 2)
+	}
+	if ok, _ := s.SIsMember("s", "y"); !ok {
+		t.Errorf("expected y to be a member")
+	}
+	if members, _ := s.SMembers("s"); !reflect.DeepEqual(members, []string{"x", "y"}) {
+		t.Errorf("unexpected members %v", members)
+	}
+
+	// Fields, values and members count against the capacity.
+	if s.Cap() != 100-6-2 {
+		t.Errorf("got cap %d, wants: %d", s.Cap(), 100-6-2)
+	}
+}
+
+func TestSortedSet(t *testing.T) {
+	s := NewMemoryStore(100)
+	s.ZAdd("z", 2, "b")
+	s.ZAdd("z", -1.5, "c")
+	s.ZAdd("z", 2, "a")
+	s.ZAdd("z", 10, "b")
+
+	got, _ := s.ZRange("z", 0, -1)
+	want := []ScoredMember{{"c", -1.5}, {"a", 2}, {"b", 10}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wants: %v", got, want)
+	}
+
+	if got, _ := s.ZRange("z", 1, 1); len(got) != 1 || got[0].Member != "a" {
+		t.Errorf("unexpected range %v", got)
+	}
+
+	if score, ok, _ := s.ZScore("z", "c"); !ok || score != -1.5 {
+		t.Errorf("got score %v, wants: %v", score, -1.5)
+	}
+}
+
+func TestWrongType(t *testing.T) {
+	s := NewShardedStore(2, 100, nil)
+	s.Set("str", []byte("v"))
+	s.SAdd("set", "m")
+
+	if _, err := s.LPush("str", []byte("a")); err != ErrWrongType {
+		t.Errorf("got %v, wants: %v", err, ErrWrongType)
+	}
+	if _, _, err := s.HGet("set", "f"); err != ErrWrongType {
+		t.Errorf("got %v, wants: %v", err, ErrWrongType)
+	}
+	if _, ok := s.Get("set"); ok {
+		t.Errorf("expected Get to ignore the set")
+	}
+
+	// SET replaces values of any type.
+	s.Set("set", []byte("v"))
+	if s.Type("set") != TypeString {
+		t.Errorf("got type %v, wants: %v", s.Type("set"), TypeString)
+	}
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"sync"
+)
+
+// Compressor is implemented by stores that compress large values.
+type Compressor interface {
+	// CompressionStats returns the totals of the compressed values.
+	CompressionStats() CompressionStats
+}
+
+// CompressionStats are the totals of the values a store keeps compressed.
+type CompressionStats struct {
+	// Values is the number of compressed values.
+	Values int
+	// RawBytes is the length of the values before compression and
+	// StoredBytes the length counted against the capacity.
+	RawBytes    int64
+	StoredBytes int64
+}
+
+// Ratio returns the raw bytes divided by the stored bytes, it is 1 when no
+// value is compressed.
+func (c CompressionStats) Ratio() float64 {
+	if c.StoredBytes == 0 {
+		return 1
+	}
+	return float64(c.RawBytes) / float64(c.StoredBytes)
+}
+
+// WithCompression compresses string values of at least threshold bytes with
+// flate at level, values are only kept compressed when they get smaller.
+// Get decompresses values into a new slice and Cap counts the compressed
+// bytes. Levels outside the flate range use flate.DefaultCompression and a
+// threshold of 0 or less disables compression.
+func WithCompression(threshold, level int) Option {
+	return func(m *MemoryStore) {
+		if level < flate.HuffmanOnly || level > flate.BestCompression {
+			level = flate.DefaultCompression
+		}
+		m.compressAbove = threshold
+		m.writers.New = func() interface{} {
+			w, _ := flate.NewWriter(nil, level)
+			return w
+		}
+	}
+}
+
+// CompressionStats returns the totals of the compressed values.
+func (m *MemoryStore) CompressionStats() CompressionStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.compression
+}
+
+// CompressionStats returns the totals of the compressed values of all the shards.
+func (s *ShardedStore) CompressionStats() CompressionStats {
+	var c CompressionStats
+	for _, shard := range s.shards {
+		sc := shard.CompressionStats()
+		c.Values += sc.Values
+		c.RawBytes += sc.RawBytes
+		c.StoredBytes += sc.StoredBytes
+	}
+	return c
+}
+
+// CompressionStats returns the totals of the compressed values of the hot store.
+func (t *TieredStore) CompressionStats() CompressionStats {
+	return t.hot.CompressionStats()
+}
+
+func (t *memoryTx) CompressionStats() CompressionStats {
+	return t.m.compression
+}
+
+func (t *shardedTx) CompressionStats() CompressionStats {
+	var c CompressionStats
+	for _, tx := range t.txs {
+		tc := tx.CompressionStats()
+		c.Values += tc.Values
+		c.RawBytes += tc.RawBytes
+		c.StoredBytes += tc.StoredBytes
+	}
+	return c
+}
+
+// encode returns the string value of value, canonical integers are kept
+// in num so counters do not keep a slice and values above the compression
+// threshold are compressed. The threshold and the writers are not modified
+// once the store is created so writes encode values before taking m.mu.
+func (m *MemoryStore) encode(value []byte) stringValue {
+	if n, ok := parseInt(value); ok {
+		return stringValue{num: n, isInt: true}
+	}
+	if m.compressAbove <= 0 || len(value) < m.compressAbove {
+		return stringValue{value: value}
+	}
+
+	var buf bytes.Buffer
+	w := m.writers.Get().(*flate.Writer)
+	w.Reset(&buf)
+	w.Write(value)
+	w.Close()
+	m.writers.Put(w)
+
+	if buf.Len() >= len(value) {
+		return stringValue{value: value}
+	}
+	return stringValue{value: buf.Bytes(), compressed: true, raw: len(value)}
+}
+
+// compressed adds the value to the compression totals when sign is 1 and
+// removes it when sign is -1, m.mu must be held.
+func (m *MemoryStore) compressed(v *stringValue, sign int) {
+	if !v.compressed {
+		return
+	}
+	m.compression.Values += sign
+	m.compression.RawBytes += int64(sign * v.raw)
+	m.compression.StoredBytes += int64(sign * len(v.value))
+}
+
+// readers keeps the flate readers, they do not depend on the level.
+var readers sync.Pool
+
+// inflate decompresses value into a new slice of length raw.
+func inflate(value []byte, raw int) []byte {
+	r, ok := readers.Get().(io.ReadCloser)
+	if ok {
+		r.(flate.Resetter).Reset(bytes.NewReader(value), nil)
+	} else {
+		r = flate.NewReader(bytes.NewReader(value))
+	}
+	defer readers.Put(r)
+
+	out := make([]byte, raw)
+	// The value was compressed by the store so it is always valid.
+	io.ReadFull(r, out)
+	return out
+}
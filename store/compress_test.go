@@ -0,0 +1,108 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	s := NewMemoryStore(1000, WithCompression(64, -1))
+
+	large := bytes.Repeat([]byte("kvstore "), 100)
+	s.Set("large", large)
+	s.Set("small", []byte("value"))
+
+	if got, ok := s.Get("large"); !ok || !bytes.Equal(got, large) {
+		t.Errorf("got %q %v, wants the large value", got, ok)
+	}
+	if got, _ := s.Get("small"); string(got) != "value" {
+		t.Errorf("got %q, wants: %q", got, "value")
+	}
+
+	stats := s.CompressionStats()
+	if stats.Values != 1 || stats.RawBytes != int64(len(large)) {
+		t.Errorf("got stats %+v, wants one value of %d bytes", stats, len(large))
+	}
+	if stats.Ratio() <= 1 {
+		t.Errorf("got ratio %v, wants more than 1", stats.Ratio())
+	}
+	if got, wants := s.Cap(), 1000-int(stats.StoredBytes)-len("value"); got != wants {
+		t.Errorf("got capacity %d, wants: %d", got, wants)
+	}
+
+	// Overwriting and deleting remove the value from the totals.
+	s.Set("large", large[:10])
+	if stats := s.CompressionStats(); stats.Values != 0 || stats.StoredBytes != 0 {
+		t.Errorf("got stats %+v after overwrite, wants none", stats)
+	}
+	s.Set("large", large)
+	s.Delete("large")
+	if stats := s.CompressionStats(); stats.Values != 0 || stats.Ratio() != 1 {
+		t.Errorf("got stats %+v after delete, wants none", stats)
+	}
+	if got, wants := s.Cap(), 1000-len("value"); got != wants {
+		t.Errorf("got capacity %d, wants: %d", got, wants)
+	}
+}
+
+func TestCompressionIncompressible(t *testing.T) {
+	s := NewMemoryStore(1000, WithCompression(4, 9))
+
+	// Integers are kept as numbers and values that do not shrink as is.
+	s.Set("n", []byte("1234567890"))
+	s.Set("noise", []byte("a8Zq"))
+
+	if stats := s.CompressionStats(); stats.Values != 0 {
+		t.Errorf("got stats %+v, wants none", stats)
+	}
+	if got, _ := s.Get("n"); string(got) != "1234567890" {
+		t.Errorf("got %q, wants: %q", got, "1234567890")
+	}
+}
+
+func TestCompressionView(t *testing.T) {
+	s := NewShardedStore(2, 1000, func(cap int) *MemoryStore {
+		return NewMemoryStore(cap, WithCompression(16, -1))
+	})
+	defer s.Close()
+
+	large := bytes.Repeat([]byte("a"), 200)
+	s.Set("a", large)
+	s.Set("b", large)
+
+	if got, _ := s.View().Get("a"); !bytes.Equal(got, large) {
+		t.Errorf("got %q from the view, wants the large value", got)
+	}
+	if stats := s.CompressionStats(); stats.Values != 2 || stats.RawBytes != 400 {
+		t.Errorf("got stats %+v, wants two values of 200 bytes", stats)
+	}
+}
+
+func TestCompressionConcurrent(t *testing.T) {
+	s := NewMemoryStore(1<<20, WithCompression(16, 1))
+	value := bytes.Repeat([]byte("abcd"), 64)
+
+	// Values are compressed and decompressed outside the store lock.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprint(i)
+			for j := 0; j < 50; j++ {
+				s.Set(key, value)
+				if got, _ := s.Get(key); !bytes.Equal(got, value) {
+					t.Errorf("got %d bytes, wants: %d", len(got), len(value))
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if c := s.CompressionStats(); c.Values != 8 || c.RawBytes != int64(8*len(value)) {
+		t.Errorf("got %+v, wants 8 values of %d bytes", c, len(value))
+	}
+}
@@ -0,0 +1,33 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/rsampaio/kvstore/store"
+	"github.com/rsampaio/kvstore/store/storetest"
+)
+
+func TestMemoryStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s := store.NewMemoryStore(10000)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestShardedStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s := store.NewShardedStore(4, 10000, nil)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestTieredStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		// The hot store is small so most keys are demoted.
+		s := store.NewTieredStore(10, store.NewMemoryStore(10000))
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
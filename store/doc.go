@@ -1,5 +1,6 @@
 // Package store define the Store interface with basic operations of a key value store.
-// The store package also defines a MemoryStore with fields to track access and modify time
-// with their respective mutexes so that access can be used to clean keys with low rate of
-// use and modify time is used to stream keys in last modified order.
+// The store package also defines a MemoryStore that keeps its entries in a map and links
+// each entry into an intrusive list in modify order used to stream keys in last modified
+// order, keys are evicted when the capacity runs out by a pluggable EvictionPolicy with
+// LRU, LFU, FIFO, random and ARC implementations.
 package store
@@ -0,0 +1,63 @@
+package store
+
+// EventType is the kind of change of a key reported to observers.
+type EventType int
+
+// Event types, EventSet is reported for every write of a string or a
+// collection and EventDelete when a key is deleted or the last element of
+// a collection is removed.
+const (
+	EventSet EventType = iota + 1
+	EventDelete
+	EventEvict
+	EventExpire
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventDelete:
+		return "del"
+	case EventEvict:
+		return "evicted"
+	case EventExpire:
+		return "expired"
+	}
+	return "unknown"
+}
+
+// Event is a change of a key.
+type Event struct {
+	Type EventType
+	Key  string
+}
+
+// Observable is implemented by stores that report the changes of their keys.
+type Observable interface {
+	// Observe registers fn to be called for every change, fn is called
+	// with the store lock held in the order of the changes so it must
+	// not block or call back into the store.
+	Observe(fn func(Event))
+}
+
+// Observe registers fn to be called for every change.
+func (m *MemoryStore) Observe(fn func(Event)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observers = append(m.observers, fn)
+}
+
+// Observe registers fn to be called for the changes of every shard.
+func (s *ShardedStore) Observe(fn func(Event)) {
+	for _, shard := range s.shards {
+		shard.Observe(fn)
+	}
+}
+
+// notify calls the observers, m.mu must be held.
+func (m *MemoryStore) notify(t EventType, key string) {
+	for _, fn := range m.observers {
+		fn(Event{Type: t, Key: key})
+	}
+}
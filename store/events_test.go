@@ -0,0 +1,97 @@
+package store
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestObserve(t *testing.T) {
+	s := NewMemoryStore(3)
+	defer s.Close()
+
+	var (
+		mu     sync.Mutex
+		events []Event
+	)
+	s.Observe(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})
+
+	s.Set("a", []byte("1"))
+	s.Set("b", []byte("2"))
+	s.Delete("b")
+	s.Delete("missing")
+	s.Set("c", []byte("345"))
+	s.Set("d", []byte("5"))
+	s.Expire("d", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	s.Get("d")
+
+	wants := []Event{
+		{EventSet, "a"},
+		{EventSet, "b"},
+		{EventDelete, "b"},
+		{EventEvict, "a"},
+		{EventSet, "c"},
+		{EventEvict, "c"},
+		{EventSet, "d"},
+		{EventExpire, "d"},
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(events, wants) {
+		t.Errorf("got %v, wants: %v", events, wants)
+	}
+}
+
+func TestObserveCollections(t *testing.T) {
+	s := NewMemoryStore(100)
+	var events []Event
+	s.Observe(func(e Event) {
+		events = append(events, e)
+	})
+
+	s.LPush("l", []byte("a"))
+	s.HSet("h", "f", []byte("v"))
+	s.RPop("l")
+	s.RPop("l")
+
+	wants := []Event{
+		{EventSet, "l"},
+		{EventSet, "h"},
+		{EventDelete, "l"},
+	}
+	if !reflect.DeepEqual(events, wants) {
+		t.Errorf("got %v, wants: %v", events, wants)
+	}
+}
+
+func TestObserveSharded(t *testing.T) {
+	s := NewShardedStore(4, 100, nil)
+	defer s.Close()
+
+	var mu sync.Mutex
+	keys := map[string]EventType{}
+	s.Observe(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		keys[e.Key] = e.Type
+	})
+
+	for _, k := range []string{"a", "b", "c", "d"} {
+		s.Set(k, []byte(k))
+	}
+	s.Expire("a", 0)
+
+	mu.Lock()
+	defer mu.Unlock()
+	wants := map[string]EventType{"a": EventDelete, "b": EventSet, "c": EventSet, "d": EventSet}
+	if !reflect.DeepEqual(keys, wants) {
+		t.Errorf("got %v, wants: %v", keys, wants)
+	}
+}
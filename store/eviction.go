@@ -0,0 +1,269 @@
+package store
+
+import (
+	"container/list"
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// EvictionPolicy decides which key is evicted when a MemoryStore runs out of capacity.
+//
+// The MemoryStore calls the policy while holding its lock so implementations
+// do not need to be safe for concurrent use.
+type EvictionPolicy interface {
+	// Added is called when a new key is stored.
+	Added(key string)
+	// Accessed is called when a stored key is read or overwritten.
+	Accessed(key string)
+	// Removed is called when a key is deleted from the store.
+	Removed(key string)
+	// Victim selects the next key to be evicted and stops tracking it,
+	// it returns false when there are no keys left to evict.
+	Victim() (string, bool)
+}
+
+// NonEvicting is implemented by policies that may never evict keys, writes
+// that do not fit in the available capacity then fail with ErrOutOfCapacity
+// instead of evicting other keys. Policies wrapping another policy forward
+// the method so the store sees the behaviour of the wrapped policy.
+type NonEvicting interface {
+	// NeverEvicts reports whether the policy never evicts keys.
+	NeverEvicts() bool
+}
+
+// Sparing is implemented by policies that can choose a victim other than a
+// given key without changing its place in the eviction order, the store
+// spares the key being written while it evicts other keys to make room for
+// it so the key keeps its history. Policies that do not implement it stop
+// tracking the key meanwhile and track it again as a new key.
+type Sparing interface {
+	// VictimExcept is Victim choosing any key but except.
+	VictimExcept(except string) (string, bool)
+}
+
+// evicts reports whether p may evict keys to make room for a write.
+func evicts(p EvictionPolicy) bool {
+	n, ok := p.(NonEvicting)
+	return !ok || !n.NeverEvicts()
+}
+
+// evictionPolicies maps the names accepted by NewEvictionPolicy to their constructors.
+var evictionPolicies = map[string]func() EvictionPolicy{
+	"lru":    func() EvictionPolicy { return NewLRUPolicy() },
+	"lfu":    func() EvictionPolicy { return NewLFUPolicy() },
+	"fifo":   func() EvictionPolicy { return NewFIFOPolicy() },
+	"random": func() EvictionPolicy { return NewRandomPolicy() },
+	"arc":    func() EvictionPolicy { return NewARCPolicy() },
+
+	"noeviction": func() EvictionPolicy { return NewNoEvictionPolicy() },
+}
+
+// EvictionPolicies returns the names accepted by NewEvictionPolicy.
+func EvictionPolicies() []string {
+	names := make([]string, 0, len(evictionPolicies))
+	for name := range evictionPolicies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewEvictionPolicy returns a new policy by its name.
+func NewEvictionPolicy(name string) (EvictionPolicy, error) {
+	newPolicy, ok := evictionPolicies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown eviction policy %q", name)
+	}
+	return newPolicy(), nil
+}
+
+// keyList is a list of keys with an index to find their elements in O(1).
+type keyList struct {
+	l     *list.List
+	index map[string]*list.Element
+}
+
+func newKeyList() *keyList {
+	return &keyList{l: list.New(), index: make(map[string]*list.Element)}
+}
+
+func (k *keyList) Len() int {
+	return k.l.Len()
+}
+
+func (k *keyList) contains(key string) bool {
+	_, ok := k.index[key]
+	return ok
+}
+
+func (k *keyList) pushFront(key string) {
+	k.index[key] = k.l.PushFront(key)
+}
+
+func (k *keyList) moveToFront(key string) bool {
+	el, ok := k.index[key]
+	if ok {
+		k.l.MoveToFront(el)
+	}
+	return ok
+}
+
+func (k *keyList) remove(key string) bool {
+	el, ok := k.index[key]
+	if ok {
+		k.l.Remove(el)
+		delete(k.index, key)
+	}
+	return ok
+}
+
+// backExcept returns the last key other than except.
+func (k *keyList) backExcept(except string) (string, bool) {
+	el := k.l.Back()
+	if el != nil && el.Value.(string) == except {
+		el = el.Prev()
+	}
+	if el == nil {
+		return "", false
+	}
+	return el.Value.(string), true
+}
+
+func (k *keyList) popBack() (string, bool) {
+	el := k.l.Back()
+	if el == nil {
+		return "", false
+	}
+	key := el.Value.(string)
+	k.l.Remove(el)
+	delete(k.index, key)
+	return key, true
+}
+
+// LRUPolicy evicts the least recently used key.
+type LRUPolicy struct {
+	keys *keyList
+}
+
+// NewLRUPolicy creates a least-recently-used eviction policy.
+func NewLRUPolicy() *LRUPolicy {
+	return &LRUPolicy{keys: newKeyList()}
+}
+
+// Added tracks key as the most recently used.
+func (p *LRUPolicy) Added(key string) { p.keys.pushFront(key) }
+
+// Accessed marks key as the most recently used.
+func (p *LRUPolicy) Accessed(key string) { p.keys.moveToFront(key) }
+
+// Removed stops tracking key.
+func (p *LRUPolicy) Removed(key string) { p.keys.remove(key) }
+
+// Victim returns the least recently used key.
+func (p *LRUPolicy) Victim() (string, bool) { return p.keys.popBack() }
+
+// VictimExcept returns the least recently used key other than except.
+func (p *LRUPolicy) VictimExcept(except string) (string, bool) {
+	key, ok := p.keys.backExcept(except)
+	p.keys.remove(key)
+	return key, ok
+}
+
+// FIFOPolicy evicts keys in the order they were added regardless of access.
+type FIFOPolicy struct {
+	keys *keyList
+}
+
+// NewFIFOPolicy creates a first-in-first-out eviction policy.
+func NewFIFOPolicy() *FIFOPolicy {
+	return &FIFOPolicy{keys: newKeyList()}
+}
+
+// Added queues key for eviction.
+func (p *FIFOPolicy) Added(key string) { p.keys.pushFront(key) }
+
+// Accessed does nothing, accesses do not change the eviction order.
+func (p *FIFOPolicy) Accessed(key string) {}
+
+// Removed stops tracking key.
+func (p *FIFOPolicy) Removed(key string) { p.keys.remove(key) }
+
+// Victim returns the oldest key.
+func (p *FIFOPolicy) Victim() (string, bool) { return p.keys.popBack() }
+
+// VictimExcept returns the oldest key other than except.
+func (p *FIFOPolicy) VictimExcept(except string) (string, bool) {
+	key, ok := p.keys.backExcept(except)
+	p.keys.remove(key)
+	return key, ok
+}
+
+// RandomPolicy evicts a random key.
+type RandomPolicy struct {
+	keys  []string
+	index map[string]int
+}
+
+// NewRandomPolicy creates a random eviction policy.
+func NewRandomPolicy() *RandomPolicy {
+	return &RandomPolicy{index: make(map[string]int)}
+}
+
+// Added tracks key.
+func (p *RandomPolicy) Added(key string) {
+	p.index[key] = len(p.keys)
+	p.keys = append(p.keys, key)
+}
+
+// Accessed does nothing, accesses do not change the eviction order.
+func (p *RandomPolicy) Accessed(key string) {}
+
+// Removed stops tracking key.
+func (p *RandomPolicy) Removed(key string) {
+	i, ok := p.index[key]
+	if !ok {
+		return
+	}
+
+	// Swap with the last key so removal is O(1).
+	last := len(p.keys) - 1
+	p.keys[i] = p.keys[last]
+	p.index[p.keys[i]] = i
+	p.keys = p.keys[:last]
+	delete(p.index, key)
+}
+
+// Victim returns a random key.
+func (p *RandomPolicy) Victim() (string, bool) {
+	if len(p.keys) == 0 {
+		return "", false
+	}
+	key := p.keys[rand.Intn(len(p.keys))]
+	p.Removed(key)
+	return key, true
+}
+
+// NoEvictionPolicy never evicts keys, writes that do not fit in the
+// available capacity fail with ErrOutOfCapacity instead.
+type NoEvictionPolicy struct{}
+
+// NewNoEvictionPolicy creates a policy that never evicts keys.
+func NewNoEvictionPolicy() *NoEvictionPolicy {
+	return &NoEvictionPolicy{}
+}
+
+// Added does nothing, keys are never evicted.
+func (p *NoEvictionPolicy) Added(key string) {}
+
+// Accessed does nothing, keys are never evicted.
+func (p *NoEvictionPolicy) Accessed(key string) {}
+
+// Removed does nothing, keys are never evicted.
+func (p *NoEvictionPolicy) Removed(key string) {}
+
+// Victim returns false, keys are never evicted.
+func (p *NoEvictionPolicy) Victim() (string, bool) { return "", false }
+
+// NeverEvicts returns true.
+func (p *NoEvictionPolicy) NeverEvicts() bool { return true }
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+// victims drains the policy and returns keys in eviction order.
+func victims(p EvictionPolicy) []string {
+	var r []string
+	for {
+		k, ok := p.Victim()
+		if !ok {
+			return r
+		}
+		r = append(r, k)
+	}
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	for _, tt := range []struct {
+		Name   string
+		Policy EvictionPolicy
+		Want   []string
+	}{
+		{
+			Name:   "LRU",
+			Policy: NewLRUPolicy(),
+			Want:   []string{"b", "a", "d", "c"},
+		},
+		{
+			Name:   "FIFO",
+			Policy: NewFIFOPolicy(),
+			Want:   []string{"a", "b", "d"},
+		},
+		{
+			Name:   "LFU",
+			Policy: NewLFUPolicy(),
+			Want:   []string{"b", "d", "c", "a"},
+		},
+		{
+			Name:   "ARC",
+			Policy: NewARCPolicy(),
+			Want:   []string{"b", "d", "c", "a"},
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			p := tt.Policy
+			p.Added("a")
+			p.Added("b")
+			p.Added("c")
+			p.Accessed("a")
+			p.Accessed("a")
+			p.Accessed("c")
+			p.Removed("c")
+			p.Added("d")
+			if tt.Name != "FIFO" {
+				p.Added("c")
+			}
+
+			if got := victims(p); !reflect.DeepEqual(got, tt.Want) {
+				t.Errorf("got %v, expected %v", got, tt.Want)
+			}
+		})
+	}
+}
+
+func TestVictimExcept(t *testing.T) {
+	for _, p := range []EvictionPolicy{NewLRUPolicy(), NewFIFOPolicy(), NewLFUPolicy(), NewARCPolicy()} {
+		for _, k := range []string{"a", "b", "c"} {
+			p.Added(k)
+		}
+
+		// a is spared and keeps its place as the next victim.
+		k, ok := p.(Sparing).VictimExcept("a")
+		if got := append([]string{k}, victims(p)...); !ok || !reflect.DeepEqual(got, []string{"b", "a", "c"}) {
+			t.Errorf("%T: got %v, wants: %v", p, got, []string{"b", "a", "c"})
+		}
+		if _, ok := p.(Sparing).VictimExcept("a"); ok {
+			t.Errorf("%T: expected no victim", p)
+		}
+	}
+}
+
+func TestRandomPolicy(t *testing.T) {
+	p := NewRandomPolicy()
+	for _, k := range []string{"a", "b", "c", "d"} {
+		p.Added(k)
+	}
+	p.Removed("b")
+
+	seen := map[string]bool{}
+	for _, k := range victims(p) {
+		seen[k] = true
+	}
+
+	want := map[string]bool{"a": true, "c": true, "d": true}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("got %v, expected %v", seen, want)
+	}
+}
+
+func TestARCGhostHit(t *testing.T) {
+	p := NewARCPolicy()
+	p.Added("a")
+	p.Added("b")
+	p.Victim()
+
+	// a was evicted from t1 and is remembered in b1, adding it again
+	// grows the target size of t1 and stores a as a frequent key.
+	p.Added("a")
+	if p.p != 1 || !p.t2.contains("a") {
+		t.Errorf("unexpected state after ghost hit p=%d t2=%v", p.p, p.t2.contains("a"))
+	}
+}
+
+func TestNewEvictionPolicy(t *testing.T) {
+	for _, name := range EvictionPolicies() {
+		if _, err := NewEvictionPolicy(name); err != nil {
+			t.Errorf("unexpected error for %v: %v", name, err)
+		}
+	}
+
+	if _, err := NewEvictionPolicy("none"); err == nil {
+		t.Errorf("expected error for unknown policy")
+	}
+}
+
+func TestMemoryStoreEvictionPolicy(t *testing.T) {
+	s := NewMemoryStore(3, WithEvictionPolicy(NewFIFOPolicy()))
+	s.Set("a", []byte("1"))
+	s.Set("b", []byte("2"))
+	s.Set("c", []byte("3"))
+	s.Get("a")
+	s.Set("d", []byte("4"))
+
+	if _, ok := s.Get("a"); ok {
+		t.Errorf("expected a to be evicted")
+	}
+}
+
+func TestNoEvictionPolicy(t *testing.T) {
+	s := NewMemoryStore(4, WithEvictionPolicy(NewNoEvictionPolicy()))
+	if err := s.Set("a", []byte("ab")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Set("b", []byte("cd")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := s.Set("c", []byte("e")); err != ErrOutOfCapacity {
+		t.Errorf("got %v, wants: %v", err, ErrOutOfCapacity)
+	}
+	if _, ok := s.Get("c"); ok {
+		t.Error("expected c not to be stored")
+	}
+
+	// Overwriting with a value of the same size fits, a larger one keeps
+	// the old value.
+	if err := s.Set("a", []byte("xy")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := s.Set("a", []byte("xyz")); err != ErrOutOfCapacity {
+		t.Errorf("got %v, wants: %v", err, ErrOutOfCapacity)
+	}
+	if got, _ := s.Get("a"); string(got) != "xy" {
+		t.Errorf("got %q, wants: %q", got, "xy")
+	}
+	if _, err := s.CompareAndSwap("b", []byte("long"), s.Revision("b")); err != ErrOutOfCapacity {
+		t.Errorf("got %v, wants: %v", err, ErrOutOfCapacity)
+	}
+	if got := s.Cap(); got != 0 {
+		t.Errorf("got capacity %d, wants: 0", got)
+	}
+
+	// Collections are refused before they change.
+	if _, err := s.LPush("l", []byte("x")); err != ErrOutOfCapacity || s.Type("l") != TypeNone {
+		t.Errorf("got %v type %v, wants: %v", err, s.Type("l"), ErrOutOfCapacity)
+	}
+}
+
+// wrappedPolicy forwards to the wrapped policy like a custom policy adding
+// instrumentation would.
+type wrappedPolicy struct {
+	EvictionPolicy
+}
+
+func (p wrappedPolicy) NeverEvicts() bool { return !evicts(p.EvictionPolicy) }
+
+func TestNoEvictionPolicyWrapped(t *testing.T) {
+	s := NewMemoryStore(4, WithEvictionPolicy(wrappedPolicy{NewNoEvictionPolicy()}))
+	s.HSet("h", "f", []byte("ab"))
+	if _, err := s.HSet("h", "g", []byte("c")); err != ErrOutOfCapacity {
+		t.Errorf("got %v, wants: %v", err, ErrOutOfCapacity)
+	}
+	if err := s.Set("a", []byte("abcde")); err != ErrOutOfCapacity {
+		t.Errorf("got %v, wants: %v", err, ErrOutOfCapacity)
+	}
+	if v, ok, _ := s.HGet("h", "f"); !ok || string(v) != "ab" {
+		t.Errorf("got %q %v, wants: %q", v, ok, "ab")
+	}
+}
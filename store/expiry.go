@@ -0,0 +1,233 @@
+package store
+
+import (
+	"container/heap"
+	"sync/atomic"
+	"time"
+)
+
+// NoExpiry is returned by TTL for keys without an expiry deadline.
+const NoExpiry time.Duration = -1
+
+// DefaultReapInterval is how often the MemoryStore reaper removes expired keys.
+const DefaultReapInterval = 100 * time.Millisecond
+
+// Expirer is implemented by stores that support expiry deadlines on keys.
+type Expirer interface {
+	// Expire sets the time to live of key and returns false if key does not exist,
+	// a ttl less or equal to zero deletes the key.
+	Expire(key string, ttl time.Duration) bool
+	// TTL returns the time to live of key or NoExpiry if key has no deadline,
+	// it returns false if key does not exist.
+	TTL(key string) (time.Duration, bool)
+	// Persist removes the deadline of key and returns false if key does not
+	// exist or had no deadline.
+	Persist(key string) bool
+	// SetExpire sets the value and the time to live of key in one operation
+	// so the key is never seen without its deadline, a ttl less or equal to
+	// zero deletes the key.
+	SetExpire(key string, value []byte, ttl time.Duration) error
+}
+
+// expiryHeap is a min-heap of entries ordered by their expiry deadline,
+// each entry keeps its position in the heap so it can be removed in O(log n).
+type expiryHeap []*entry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].expiryIndex = i
+	h[j].expiryIndex = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.expiryIndex = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.expiryIndex = -1
+	*h = old[:n-1]
+	return e
+}
+
+// WithReapInterval sets how often expired keys are removed in the background,
+// the default is DefaultReapInterval.
+func WithReapInterval(d time.Duration) Option {
+	return func(m *MemoryStore) {
+		m.reapInterval = d
+	}
+}
+
+// Expire sets the time to live of key, the reaper goroutine is started
+// the first time a deadline is set.
+func (m *MemoryStore) Expire(key string, ttl time.Duration) bool {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.expire(key, ttl)
+}
+
+// TTL returns the time to live of key.
+func (m *MemoryStore) TTL(key string) (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.ttl(key)
+}
+
+// Persist removes the deadline of key.
+func (m *MemoryStore) Persist(key string) bool {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.persist(key)
+}
+
+// SetExpire sets the value and the time to live of key.
+func (m *MemoryStore) SetExpire(key string, value []byte, ttl time.Duration) error {
+	v := m.encode(value)
+	m.mu.Lock()
+	defer m.unlock()
+	return m.setExpire(key, v, ttl)
+}
+
+// Close stops the reaper goroutine.
+func (m *MemoryStore) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.done)
+	})
+	return nil
+}
+
+// reap periodically removes expired keys until the store is closed.
+func (m *MemoryStore) reap() {
+	t := time.NewTicker(m.reapInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-t.C:
+			m.mu.Lock()
+			for len(m.expiring) > 0 && !m.expiring[0].expires.After(now) {
+				e := m.expiring[0]
+				m.remove(e)
+				m.policy.Removed(e.key)
+				m.removed(e, ReasonExpired)
+				m.notify(EventExpire, e.key)
+			}
+			m.unlock()
+		}
+	}
+}
+
+// expire sets the time to live of key, m.mu must be held.
+func (m *MemoryStore) expire(key string, ttl time.Duration) bool {
+	e, ok := m.lookup(key)
+	if !ok {
+		return false
+	}
+
+	if ttl <= 0 {
+		m.remove(e)
+		m.policy.Removed(key)
+		m.removed(e, ReasonDeleted)
+		m.notify(EventDelete, key)
+		return true
+	}
+
+	m.setExpiry(e, time.Now().Add(ttl))
+	m.touch(e)
+	if !m.reaping {
+		m.reaping = true
+		go m.reap()
+	}
+	return true
+}
+
+// setExpire sets the encoded value v and the time to live of key, m.mu must be held.
+func (m *MemoryStore) setExpire(key string, v stringValue, ttl time.Duration) error {
+	if err := m.set(key, v); err != nil {
+		return err
+	}
+	m.expire(key, ttl)
+	return nil
+}
+
+// ttl returns the time to live of key, m.mu must be held.
+func (m *MemoryStore) ttl(key string) (time.Duration, bool) {
+	e, ok := m.lookup(key)
+	if !ok {
+		return 0, false
+	}
+
+	if e.expires.IsZero() {
+		return NoExpiry, true
+	}
+	return time.Until(e.expires), true
+}
+
+// persist removes the deadline of key, m.mu must be held.
+func (m *MemoryStore) persist(key string) bool {
+	e, ok := m.lookup(key)
+	if !ok || e.expires.IsZero() {
+		return false
+	}
+
+	m.clearExpiry(e)
+	m.touch(e)
+	return true
+}
+
+// lookup returns the entry for key removing it first if it is expired, m.mu must be held.
+func (m *MemoryStore) lookup(key string) (*entry, bool) {
+	e, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	if e.expired(time.Now()) {
+		m.remove(e)
+		m.policy.Removed(key)
+		m.removed(e, ReasonExpired)
+		m.notify(EventExpire, key)
+		return nil, false
+	}
+	return e, true
+}
+
+// touch gives e a new revision after its deadline changed, m.mu must be held.
+func (m *MemoryStore) touch(e *entry) {
+	m.modified.moveToFront(e)
+	e.rev = atomic.AddUint64(m.rev, 1)
+}
+
+// setExpiry sets or updates the deadline of e, m.mu must be held.
+func (m *MemoryStore) setExpiry(e *entry, deadline time.Time) {
+	m.preserve(e)
+	e.expires = deadline
+	if e.expiryIndex < 0 {
+		heap.Push(&m.expiring, e)
+		return
+	}
+	heap.Fix(&m.expiring, e.expiryIndex)
+}
+
+// clearExpiry removes the deadline of e, m.mu must be held.
+func (m *MemoryStore) clearExpiry(e *entry) {
+	m.preserve(e)
+	if e.expiryIndex >= 0 {
+		heap.Remove(&m.expiring, e.expiryIndex)
+	}
+	e.expires = time.Time{}
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !e.expires.After(now)
+}
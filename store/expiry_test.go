@@ -0,0 +1,85 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpire(t *testing.T) {
+	s := NewMemoryStore(100)
+	defer s.Close()
+
+	s.Set("foo", []byte("bar"))
+	if !s.Expire("foo", time.Minute) {
+		t.Fatal("expected expire to find key")
+	}
+
+	if ttl, ok := s.TTL("foo"); !ok || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("unexpected ttl %v %v", ttl, ok)
+	}
+
+	if s.Expire("baz", time.Minute) {
+		t.Errorf("unexpected expire of missing key")
+	}
+
+	if !s.Persist("foo") || s.Persist("foo") {
+		t.Errorf("expected persist to succeed once")
+	}
+
+	if ttl, ok := s.TTL("foo"); !ok || ttl != NoExpiry {
+		t.Errorf("got ttl %v, wants: %v", ttl, NoExpiry)
+	}
+}
+
+func TestExpireLazy(t *testing.T) {
+	s := NewMemoryStore(100, WithReapInterval(time.Hour))
+	defer s.Close()
+
+	s.Set("foo", []byte("bar"))
+	s.Expire("foo", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := s.Get("foo"); ok {
+		t.Errorf("unexpected expired key found")
+	}
+
+	if s.Cap() != 100 {
+		t.Errorf("got cap %d, wants: %d", s.Cap(), 100)
+	}
+}
+
+func TestExpireReaper(t *testing.T) {
+	s := NewMemoryStore(100, WithReapInterval(time.Millisecond))
+	defer s.Close()
+
+	s.Set("foo", []byte("bar"))
+	s.Set("baz", []byte("qux"))
+	s.Expire("foo", time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	s.mu.Lock()
+	_, ok := s.items["foo"]
+	n := len(s.expiring)
+	s.mu.Unlock()
+
+	if ok || n != 0 {
+		t.Errorf("expected reaper to remove expired key")
+	}
+
+	if s.Cap() != 97 {
+		t.Errorf("got cap %d, wants: %d", s.Cap(), 97)
+	}
+}
+
+func TestSetClearsExpiry(t *testing.T) {
+	s := NewMemoryStore(100)
+	defer s.Close()
+
+	s.Set("foo", []byte("bar"))
+	s.Expire("foo", time.Minute)
+	s.Set("foo", []byte("baz"))
+
+	if ttl, _ := s.TTL("foo"); ttl != NoExpiry {
+		t.Errorf("got ttl %v, wants: %v", ttl, NoExpiry)
+	}
+}
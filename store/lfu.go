@@ -0,0 +1,96 @@
+package store
+
+import "container/list"
+
+// lfuBucket holds the keys accessed freq times in least recently used order.
+type lfuBucket struct {
+	freq int
+	keys *keyList
+}
+
+// LFUPolicy evicts the least frequently used key, ties are broken by
+// evicting the least recently used key among them.
+//
+// Keys are kept in buckets ordered by frequency so every operation is O(1).
+type LFUPolicy struct {
+	buckets *list.List
+	index   map[string]*list.Element
+}
+
+// NewLFUPolicy creates a least-frequently-used eviction policy.
+func NewLFUPolicy() *LFUPolicy {
+	return &LFUPolicy{
+		buckets: list.New(),
+		index:   make(map[string]*list.Element),
+	}
+}
+
+// Added tracks key with a frequency of one.
+func (p *LFUPolicy) Added(key string) {
+	front := p.buckets.Front()
+	if front == nil || front.Value.(*lfuBucket).freq != 1 {
+		front = p.buckets.PushFront(&lfuBucket{freq: 1, keys: newKeyList()})
+	}
+	front.Value.(*lfuBucket).keys.pushFront(key)
+	p.index[key] = front
+}
+
+// Accessed increments the frequency of key.
+func (p *LFUPolicy) Accessed(key string) {
+	el, ok := p.index[key]
+	if !ok {
+		return
+	}
+	b := el.Value.(*lfuBucket)
+
+	next := el.Next()
+	if next == nil || next.Value.(*lfuBucket).freq != b.freq+1 {
+		next = p.buckets.InsertAfter(&lfuBucket{freq: b.freq + 1, keys: newKeyList()}, el)
+	}
+	next.Value.(*lfuBucket).keys.pushFront(key)
+	p.index[key] = next
+
+	b.keys.remove(key)
+	if b.keys.Len() == 0 {
+		p.buckets.Remove(el)
+	}
+}
+
+// Removed stops tracking key.
+func (p *LFUPolicy) Removed(key string) {
+	el, ok := p.index[key]
+	if !ok {
+		return
+	}
+	delete(p.index, key)
+
+	b := el.Value.(*lfuBucket)
+	b.keys.remove(key)
+	if b.keys.Len() == 0 {
+		p.buckets.Remove(el)
+	}
+}
+
+// Victim returns the least frequently used key.
+func (p *LFUPolicy) Victim() (string, bool) {
+	el := p.buckets.Front()
+	if el == nil {
+		return "", false
+	}
+
+	key, _ := el.Value.(*lfuBucket).keys.popBack()
+	p.Removed(key)
+	return key, true
+}
+
+// VictimExcept returns the least frequently used key other than except.
+func (p *LFUPolicy) VictimExcept(except string) (string, bool) {
+	// Only the bucket holding nothing but except is skipped.
+	for el := p.buckets.Front(); el != nil; el = el.Next() {
+		if key, ok := el.Value.(*lfuBucket).keys.backExcept(except); ok {
+			p.Removed(key)
+			return key, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,55 @@
+package store
+
+// link holds the neighbours of an entry in one of the intrusive lists.
+type link struct {
+	prev, next *entry
+}
+
+// entryList is an intrusive doubly-linked list of entries, the links are
+// embedded in the entry itself so insertion, removal and moving an entry to
+// the front are O(1) and do not allocate.
+type entryList struct {
+	head, tail *entry
+	len        int
+
+	// link returns the links used by this list on the given entry.
+	link func(*entry) *link
+}
+
+func (l *entryList) pushFront(e *entry) {
+	el := l.link(e)
+	el.prev = nil
+	el.next = l.head
+	if l.head != nil {
+		l.link(l.head).prev = e
+	}
+	l.head = e
+	if l.tail == nil {
+		l.tail = e
+	}
+	l.len++
+}
+
+func (l *entryList) remove(e *entry) {
+	el := l.link(e)
+	if el.prev != nil {
+		l.link(el.prev).next = el.next
+	} else {
+		l.head = el.next
+	}
+	if el.next != nil {
+		l.link(el.next).prev = el.prev
+	} else {
+		l.tail = el.prev
+	}
+	el.prev, el.next = nil, nil
+	l.len--
+}
+
+func (l *entryList) moveToFront(e *entry) {
+	if l.head == e {
+		return
+	}
+	l.remove(e)
+	l.pushFront(e)
+}
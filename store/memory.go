@@ -0,0 +1,167 @@
+package store
+
+import "unsafe"
+
+// MemoryReporter is implemented by stores that estimate the memory used by
+// their keys.
+type MemoryReporter interface {
+	// MemoryUsage returns the estimated bytes used by key and its value,
+	// it returns false if key does not exist.
+	MemoryUsage(key string) (int, bool)
+	// MemoryStats returns the estimated memory used by the store.
+	MemoryStats() MemoryStats
+}
+
+// MemoryStats is the estimated memory used by a store by category.
+type MemoryStats struct {
+	// Keys is the number of keys.
+	Keys int
+	// KeyBytes is the length of the keys and ValueBytes the length of the
+	// values, compressed values count their compressed length.
+	KeyBytes   int64
+	ValueBytes int64
+	// OverheadBytes is the estimated cost of the entries, the map and the
+	// tracking of the keys by the eviction policy and the ordered index.
+	OverheadBytes int64
+}
+
+// Total returns the estimated bytes used by the store.
+func (s MemoryStats) Total() int64 {
+	return s.KeyBytes + s.ValueBytes + s.OverheadBytes
+}
+
+// The overheads are estimates of the memory used per key by the Go runtime
+// on 64-bit platforms.
+const (
+	// mapOverhead is a slot of the items map with the unused slots kept
+	// by the load factor.
+	mapOverhead = 40
+	// policyOverhead is a list element and a map slot tracking the key
+	// in the eviction policy.
+	policyOverhead = 96
+	// indexOverhead is a node of the ordered index with its level pointers.
+	indexOverhead = 64
+)
+
+// entryOverhead is the estimated memory used by a key besides its bytes
+// and its value, it includes the node of the scan index.
+var entryOverhead = int(unsafe.Sizeof(entry{})) + mapOverhead + policyOverhead + indexOverhead
+
+// WithOverheadAccounting counts the bytes of the keys and the estimated
+// overhead of every entry against the capacity besides the values, so the
+// capacity is closer to the memory used by the store.
+func WithOverheadAccounting() Option {
+	return func(m *MemoryStore) {
+		m.countOverhead = true
+	}
+}
+
+// MemoryUsage returns the estimated bytes used by key and its value.
+func (m *MemoryStore) MemoryUsage(key string) (int, bool) {
+	m.mu.Lock()
+	defer m.unlock()
+	return m.memoryUsage(key)
+}
+
+// MemoryStats returns the estimated memory used by the store.
+func (m *MemoryStore) MemoryStats() MemoryStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.memoryStats()
+}
+
+// memoryUsage returns the estimated bytes used by key and its value, m.mu
+// must be held.
+func (m *MemoryStore) memoryUsage(key string) (int, bool) {
+	e, ok := m.lookup(key)
+	if !ok {
+		return 0, false
+	}
+	return len(key) + e.size() + m.perEntry(), true
+}
+
+// memoryStats returns the estimated memory used by the store, m.mu must be held.
+func (m *MemoryStore) memoryStats() MemoryStats {
+	s := MemoryStats{
+		Keys:          len(m.items),
+		KeyBytes:      m.keyBytes,
+		OverheadBytes: int64(len(m.items) * m.perEntry()),
+	}
+
+	// The capacity counts the values and, with WithOverheadAccounting, the
+	// keys and the overhead.
+	s.ValueBytes = int64(m.limit - m.cap)
+	if m.countOverhead {
+		s.ValueBytes -= s.KeyBytes + s.OverheadBytes
+	}
+	return s
+}
+
+// MemoryUsage returns the estimated bytes used by key from its shard.
+func (s *ShardedStore) MemoryUsage(key string) (int, bool) {
+	return s.shard(key).MemoryUsage(key)
+}
+
+// MemoryStats returns the estimated memory used by all the shards.
+func (s *ShardedStore) MemoryStats() MemoryStats {
+	var ms MemoryStats
+	for _, shard := range s.shards {
+		ss := shard.MemoryStats()
+		ms.Keys += ss.Keys
+		ms.KeyBytes += ss.KeyBytes
+		ms.ValueBytes += ss.ValueBytes
+		ms.OverheadBytes += ss.OverheadBytes
+	}
+	return ms
+}
+
+// MemoryUsage returns the estimated bytes used by key in the hot store.
+func (t *TieredStore) MemoryUsage(key string) (int, bool) {
+	return t.hot.MemoryUsage(key)
+}
+
+// MemoryStats returns the estimated memory used by the hot store.
+func (t *TieredStore) MemoryStats() MemoryStats {
+	return t.hot.MemoryStats()
+}
+
+func (t *memoryTx) MemoryUsage(key string) (int, bool) {
+	return t.m.memoryUsage(key)
+}
+
+func (t *memoryTx) MemoryStats() MemoryStats {
+	return t.m.memoryStats()
+}
+
+func (t *shardedTx) MemoryUsage(key string) (int, bool) {
+	return t.tx(key).MemoryUsage(key)
+}
+
+func (t *shardedTx) MemoryStats() MemoryStats {
+	var ms MemoryStats
+	for _, tx := range t.txs {
+		ts := tx.MemoryStats()
+		ms.Keys += ts.Keys
+		ms.KeyBytes += ts.KeyBytes
+		ms.ValueBytes += ts.ValueBytes
+		ms.OverheadBytes += ts.OverheadBytes
+	}
+	return ms
+}
+
+// perEntry returns the estimated overhead of each entry, m.mu must be held.
+func (m *MemoryStore) perEntry() int {
+	if m.index != nil {
+		return entryOverhead + indexOverhead
+	}
+	return entryOverhead
+}
+
+// overhead returns the bytes counted against the capacity for key besides
+// its value, m.mu must be held.
+func (m *MemoryStore) overhead(key string) int {
+	if !m.countOverhead {
+		return 0
+	}
+	return len(key) + m.perEntry()
+}
@@ -0,0 +1,70 @@
+package store
+
+import "testing"
+
+func TestOverheadAccounting(t *testing.T) {
+	s := NewMemoryStore(10000, WithOverheadAccounting())
+	s.Set("key", []byte("value"))
+
+	if got, wants := s.Cap(), 10000-len("key")-len("value")-entryOverhead; got != wants {
+		t.Errorf("got capacity %d, wants: %d", got, wants)
+	}
+	if got, _ := s.MemoryUsage("key"); got != 10000-s.Cap() {
+		t.Errorf("got usage %d, wants: %d", got, 10000-s.Cap())
+	}
+
+	// Overwriting only changes the value bytes.
+	s.Set("key", []byte("v"))
+	if got, wants := s.Cap(), 10000-len("key")-len("v")-entryOverhead; got != wants {
+		t.Errorf("got capacity %d after overwrite, wants: %d", got, wants)
+	}
+
+	s.Delete("key")
+	if got := s.Cap(); got != 10000 {
+		t.Errorf("got capacity %d after delete, wants: 10000", got)
+	}
+}
+
+func TestOverheadAccountingEviction(t *testing.T) {
+	// Room for two entries with one byte keys and values.
+	s := NewMemoryStore(2*(2+entryOverhead), WithOverheadAccounting())
+	s.Set("a", []byte("1"))
+	s.Set("b", []byte("2"))
+	s.Set("c", []byte("3"))
+
+	if _, ok := s.Get("a"); ok {
+		t.Error("expected a to be evicted")
+	}
+	if got := s.Cap(); got != 0 {
+		t.Errorf("got capacity %d, wants: 0", got)
+	}
+
+	n := NewMemoryStore(2+entryOverhead, WithOverheadAccounting(), WithEvictionPolicy(NewNoEvictionPolicy()))
+	if err := n.Set("a", []byte("1")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := n.Set("b", []byte("2")); err != ErrOutOfCapacity {
+		t.Errorf("got %v, wants: %v", err, ErrOutOfCapacity)
+	}
+}
+
+func TestMemoryStats(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithOverheadAccounting()}} {
+		s := NewMemoryStore(10000, opts...)
+		s.Set("a", []byte("12345"))
+		s.Set("bb", []byte("xyz"))
+		s.LPush("list", []byte("x"))
+
+		stats := s.MemoryStats()
+		if stats.Keys != 3 || stats.KeyBytes != 7 || stats.ValueBytes != 9 {
+			t.Errorf("got stats %+v, wants 3 keys of 7 bytes and 9 value bytes", stats)
+		}
+		if stats.OverheadBytes != int64(3*entryOverhead) {
+			t.Errorf("got overhead %d, wants: %d", stats.OverheadBytes, 3*entryOverhead)
+		}
+	}
+
+	if _, ok := NewMemoryStore(10).MemoryUsage("missing"); ok {
+		t.Error("expected no usage for a missing key")
+	}
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// KeyValue is a key with its value.
+type KeyValue struct {
+	Key   string
+	Value []byte
+}
+
+// Ranger is implemented by stores that return keys in lexicographic order.
+type Ranger interface {
+	// Range returns the keys between start and end inclusive with their values
+	// in lexicographic order or in reverse order, at most limit pairs are
+	// returned unless limit is less or equal to zero.
+	Range(start, end string, limit int, reverse bool) []KeyValue
+}
+
+// WithOrderedIndex keeps the keys in a skiplist so Range takes O(log n + k),
+// adding and deleting keys updates a second skiplist besides the scan index. Range sorts all
+// the keys of stores without the index.
+func WithOrderedIndex() Option {
+	return func(m *MemoryStore) {
+		m.index = newSkiplist()
+	}
+}
+
+// Range returns the string keys between start and end with their values,
+// ranges do not count as accesses for the eviction policy.
+func (m *MemoryStore) Range(start, end string, limit int, reverse bool) []KeyValue {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rangeKeys(start, end, limit, reverse)
+}
+
+// rangeKeys returns the keys between start and end, m.mu must be held.
+func (m *MemoryStore) rangeKeys(start, end string, limit int, reverse bool) []KeyValue {
+	if start > end {
+		return nil
+	}
+
+	if m.index == nil {
+		return m.rangeUnindexed(start, end, limit, reverse)
+	}
+
+	now := time.Now()
+
+	var r []KeyValue
+	add := func(key string) bool {
+		if e := m.items[key]; e.coll == nil && !e.expired(now) {
+			r = append(r, KeyValue{Key: key, Value: e.bytes()})
+		}
+		return limit <= 0 || len(r) < limit
+	}
+
+	if reverse {
+		for n := m.index.seekLast(end); n != nil && n.key >= start && add(n.key); n = n.Prev() {
+		}
+	} else {
+		for n := m.index.seek(start); n != nil && n.key <= end && add(n.key); n = n.Next() {
+		}
+	}
+	return r
+}
+
+// rangeUnindexed sorts the keys between start and end, m.mu must be held.
+func (m *MemoryStore) rangeUnindexed(start, end string, limit int, reverse bool) []KeyValue {
+	now := time.Now()
+
+	var r []KeyValue
+	for key, e := range m.items {
+		if key >= start && key <= end && e.coll == nil && !e.expired(now) {
+			r = append(r, KeyValue{Key: key, Value: e.bytes()})
+		}
+	}
+	return sortRange(r, limit, reverse)
+}
+
+// sortRange sorts pairs in lexicographic or reverse order and truncates them to limit.
+func sortRange(r []KeyValue, limit int, reverse bool) []KeyValue {
+	sort.Slice(r, func(i, j int) bool {
+		if reverse {
+			return r[i].Key > r[j].Key
+		}
+		return r[i].Key < r[j].Key
+	})
+
+	if limit > 0 && len(r) > limit {
+		r = r[:limit]
+	}
+	return r
+}
+
+// Range merges the keys between start and end of every shard.
+func (s *ShardedStore) Range(start, end string, limit int, reverse bool) []KeyValue {
+	var r []KeyValue
+	for _, m := range s.shards {
+		r = append(r, m.Range(start, end, limit, reverse)...)
+	}
+	return sortRange(r, limit, reverse)
+}
+
+func (t *memoryTx) Range(start, end string, limit int, reverse bool) []KeyValue {
+	return t.m.rangeKeys(start, end, limit, reverse)
+}
+
+func (t *shardedTx) Range(start, end string, limit int, reverse bool) []KeyValue {
+	var r []KeyValue
+	for _, tx := range t.txs {
+		r = append(r, tx.Range(start, end, limit, reverse)...)
+	}
+	return sortRange(r, limit, reverse)
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestRange(t *testing.T) {
+	for name, s := range map[string]interface {
+		Store
+		Ranger
+	}{
+		"indexed":   NewMemoryStore(1000, WithOrderedIndex()),
+		"unindexed": NewMemoryStore(1000),
+		"sharded": NewShardedStore(4, 1000, func(cap int) *MemoryStore {
+			return NewMemoryStore(cap, WithOrderedIndex())
+		}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				s.Set(fmt.Sprintf("user:%02d", i), []byte(fmt.Sprint(i)))
+			}
+			s.Set("other", []byte("x"))
+			s.Delete("user:12")
+
+			keys := func(r []KeyValue) []string {
+				var k []string
+				for _, kv := range r {
+					k = append(k, kv.Key)
+				}
+				return k
+			}
+
+			for _, tt := range []struct {
+				Start, End string
+				Limit      int
+				Reverse    bool
+				Want       []string
+			}{
+				{"user:10", "user:14", 0, false, []string{"user:10", "user:11", "user:13", "user:14"}},
+				{"user:10", "user:14", 2, true, []string{"user:14", "user:13"}},
+				{"user:175", "user:2", 0, false, []string{"user:18", "user:19"}},
+				{"user:2", "user:1", 0, false, nil},
+			} {
+				got := keys(s.Range(tt.Start, tt.End, tt.Limit, tt.Reverse))
+				if !reflect.DeepEqual(got, tt.Want) {
+					t.Errorf("range %v %v: got %v, wants: %v", tt.Start, tt.End, got, tt.Want)
+				}
+			}
+
+			if r := s.Range("user:05", "user:05", 0, false); len(r) != 1 || string(r[0].Value) != "5" {
+				t.Errorf("unexpected value %v", r)
+			}
+		})
+	}
+}
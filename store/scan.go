@@ -0,0 +1,195 @@
+package store
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"github.com/rsampaio/kvstore/glob"
+)
+
+// Scanner is implemented by stores that iterate their keys incrementally.
+//
+// Keys are returned in the order of a 64-bit hash of the key and the cursor
+// is the hash to continue from, so the cursor stays valid while the store is
+// modified: keys present during the whole iteration are returned exactly once
+// and keys added or deleted meanwhile may or may not be returned.
+type Scanner interface {
+	// Scan returns the keys matching the glob pattern among the next count
+	// keys after cursor and the cursor of the next call, the iteration
+	// starts and ends with a zero cursor. A call may return fewer keys than
+	// count, even none, before the end of the iteration. Keys with the same
+	// hash are always returned together so a call may return more than count keys.
+	Scan(cursor uint64, pattern string, count int) ([]string, uint64)
+}
+
+// hashedKey is a key with its scan hash.
+type hashedKey struct {
+	key  string
+	hash uint64
+}
+
+// scanKey is the key of the scan index, the big-endian hash followed by the
+// key sorts the keys by hash.
+func scanKey(hash uint64, key string) string {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], hash)
+	return string(b[:]) + key
+}
+
+func scanHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// scanPage keeps the count keys with the smallest hashes in a max-heap, the
+// keys with the same hash as the largest kept hash are kept together.
+type scanPage struct {
+	keys  hashHeap
+	count int
+	// more is set once a key after the kept keys was dropped.
+	more bool
+	// limit is the hash where the walk of a shard stopped, keys from limit
+	// on are left for the next call.
+	limit   uint64
+	limited bool
+}
+
+func newScanPage(count int) *scanPage {
+	if count < 1 {
+		count = 1
+	}
+	return &scanPage{count: count}
+}
+
+// add keeps k if its hash is among the count smallest hashes.
+func (p *scanPage) add(k hashedKey) {
+	if len(p.keys) >= p.count && k.hash > p.keys[0].hash {
+		p.more = true
+		return
+	}
+	heap.Push(&p.keys, k)
+	if len(p.keys) <= p.count {
+		return
+	}
+
+	// The keys with the largest hash are dropped if count keys are left.
+	var last []hashedKey
+	for top := p.keys[0].hash; len(p.keys) > 0 && p.keys[0].hash == top; {
+		last = append(last, heap.Pop(&p.keys).(hashedKey))
+	}
+	if len(p.keys) < p.count {
+		for _, k := range last {
+			heap.Push(&p.keys, k)
+		}
+		return
+	}
+	p.more = true
+}
+
+// stop records that a walk stopped before the keys from hash on.
+func (p *scanPage) stop(hash uint64) {
+	if !p.limited || hash < p.limit {
+		p.limit, p.limited = hash, true
+	}
+}
+
+// result returns the kept keys before the limit ordered by hash and the
+// cursor after them, or a zero cursor when no key is left.
+func (p *scanPage) result() ([]string, uint64) {
+	keys := p.keys
+	sort.Slice(keys, func(i, j int) bool { return keys[i].hash < keys[j].hash })
+
+	var cursor uint64
+	if p.limited {
+		cursor = p.limit
+		for len(keys) > 0 && keys[len(keys)-1].hash >= p.limit {
+			keys = keys[:len(keys)-1]
+		}
+	}
+	// Wraps to zero after the last possible hash.
+	if p.more && len(keys) > 0 && (!p.limited || keys[len(keys)-1].hash+1 < cursor) {
+		cursor = keys[len(keys)-1].hash + 1
+	}
+
+	r := make([]string, len(keys))
+	for i := range r {
+		r[i] = keys[i].key
+	}
+	return r, cursor
+}
+
+// hashHeap is a max-heap of keys ordered by hash.
+type hashHeap []hashedKey
+
+func (h hashHeap) Len() int            { return len(h) }
+func (h hashHeap) Less(i, j int) bool  { return h[i].hash > h[j].hash }
+func (h hashHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *hashHeap) Push(x interface{}) { *h = append(*h, x.(hashedKey)) }
+
+func (h *hashHeap) Pop() interface{} {
+	old := *h
+	k := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return k
+}
+
+// Scan returns the keys matching pattern among the count keys after cursor,
+// the keys are kept ordered by hash so a call takes O(log n + count).
+func (m *MemoryStore) Scan(cursor uint64, pattern string, count int) ([]string, uint64) {
+	p := newScanPage(count)
+	m.mu.Lock()
+	m.scan(p, cursor, pattern)
+	m.mu.Unlock()
+	return p.result()
+}
+
+// scan walks the count keys from cursor in hash order and adds those
+// matching pattern to p, m.mu must be held.
+func (m *MemoryStore) scan(p *scanPage, cursor uint64, pattern string) {
+	now := time.Now()
+	visited := 0
+	var last uint64
+	for n := m.hashes.seek(scanKey(cursor, "")); n != nil; n = n.Next() {
+		e := m.items[n.key[8:]]
+		if visited >= p.count && e.hash != last {
+			p.stop(e.hash)
+			return
+		}
+		visited++
+		last = e.hash
+
+		if !e.expired(now) && glob.Match(pattern, e.key) {
+			p.add(hashedKey{key: e.key, hash: e.hash})
+		}
+	}
+}
+
+// Scan returns the keys of every shard matching pattern among the count
+// keys after cursor.
+func (s *ShardedStore) Scan(cursor uint64, pattern string, count int) ([]string, uint64) {
+	p := newScanPage(count)
+	for _, m := range s.shards {
+		m.mu.Lock()
+		m.scan(p, cursor, pattern)
+		m.mu.Unlock()
+	}
+	return p.result()
+}
+
+func (t *memoryTx) Scan(cursor uint64, pattern string, count int) ([]string, uint64) {
+	p := newScanPage(count)
+	t.m.scan(p, cursor, pattern)
+	return p.result()
+}
+
+func (t *shardedTx) Scan(cursor uint64, pattern string, count int) ([]string, uint64) {
+	p := newScanPage(count)
+	for _, tx := range t.txs {
+		tx.m.scan(p, cursor, pattern)
+	}
+	return p.result()
+}
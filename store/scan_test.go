@@ -0,0 +1,106 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	for name, s := range map[string]interface {
+		Store
+		Scanner
+	}{
+		"memory":  NewMemoryStore(1000),
+		"sharded": NewShardedStore(4, 1000, nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 50; i++ {
+				s.Set(fmt.Sprintf("key:%d", i), []byte("v"))
+			}
+			s.Set("other", []byte("v"))
+
+			seen := make(map[string]int)
+			var cursor uint64
+			for calls := 0; ; calls++ {
+				var keys []string
+				keys, cursor = s.Scan(cursor, "key:*", 7)
+				if len(keys) > 7 {
+					t.Errorf("got %d keys, wants at most 7", len(keys))
+				}
+				for _, k := range keys {
+					seen[k]++
+				}
+
+				// Writes between calls must not invalidate the cursor.
+				s.Set("new:"+fmt.Sprint(calls), []byte("v"))
+				if cursor == 0 {
+					break
+				}
+			}
+
+			var dup []string
+			for k, n := range seen {
+				if n != 1 {
+					dup = append(dup, k)
+				}
+			}
+			sort.Strings(dup)
+			if len(seen) != 50 || len(dup) != 0 {
+				t.Errorf("got %d keys with duplicates %v, wants 50", len(seen), dup)
+			}
+		})
+	}
+}
+
+func TestScanPage(t *testing.T) {
+	p := newScanPage(2)
+	for _, k := range []hashedKey{{"e", 5}, {"c", 3}, {"d", 3}, {"a", 1}, {"f", 6}} {
+		p.add(k)
+	}
+
+	// The keys with hash 3 are kept together past the count.
+	keys, cursor := p.result()
+	sort.Strings(keys)
+	if want := []string{"a", "c", "d"}; !reflect.DeepEqual(keys, want) || cursor != 4 {
+		t.Errorf("got %v %d, wants: %v %d", keys, cursor, want, 4)
+	}
+
+	// Keys after the hash where a shard stopped are left for the next call.
+	p = newScanPage(2)
+	p.add(hashedKey{"a", 1})
+	p.add(hashedKey{"b", 7})
+	p.stop(5)
+	if keys, cursor := p.result(); !reflect.DeepEqual(keys, []string{"a"}) || cursor != 5 {
+		t.Errorf("got %v %d, wants: [a] 5", keys, cursor)
+	}
+
+	p = newScanPage(2)
+	p.add(hashedKey{"a", 1})
+	p.add(hashedKey{"b", 2})
+	if keys, cursor := p.result(); len(keys) != 2 || cursor != 0 {
+		t.Errorf("got %v %d, wants the last page", keys, cursor)
+	}
+}
+
+func TestScanPageBounded(t *testing.T) {
+	s := NewMemoryStore(100000)
+	for i := 0; i < 1000; i++ {
+		s.Set(fmt.Sprintf("key:%d", i), []byte("v"))
+	}
+
+	// A page looks at count keys instead of the whole keyspace.
+	p := newScanPage(5)
+	var visited int
+	s.mu.Lock()
+	s.scan(p, 0, "key:*")
+	for n := s.hashes.seek(scanKey(0, "")); n != nil && s.items[n.key[8:]].hash < p.limit; n = n.Next() {
+		visited++
+	}
+	s.mu.Unlock()
+
+	if !p.limited || visited != 5 || len(p.keys) != 5 {
+		t.Errorf("got %d keys looked at and %d kept, wants: 5", visited, len(p.keys))
+	}
+}
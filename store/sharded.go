@@ -0,0 +1,158 @@
+package store
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"time"
+)
+
+// ShardedStore implements the Store interface by hashing keys across
+// independent MemoryStore shards, each shard has its own lock, capacity
+// and eviction policy so operations on different shards do not contend.
+type ShardedStore struct {
+	shards []*MemoryStore
+
+	// rev is the revision counter shared by all shards so modifications
+	// can be ordered across shards.
+	rev uint64
+}
+
+// NewShardedStore creates a store with n shards splitting cap between them,
+// newShard is called to create each shard with its share of the capacity and
+// defaults to NewMemoryStore with the default options.
+func NewShardedStore(n, cap int, newShard func(cap int) *MemoryStore) *ShardedStore {
+	if n < 1 {
+		n = 1
+	}
+
+	if newShard == nil {
+		newShard = func(cap int) *MemoryStore { return NewMemoryStore(cap) }
+	}
+
+	s := &ShardedStore{shards: make([]*MemoryStore, n)}
+	for i := range s.shards {
+		shardCap := cap / n
+		if i < cap%n {
+			shardCap++
+		}
+
+		s.shards[i] = newShard(shardCap)
+		s.shards[i].rev = &s.rev
+	}
+	return s
+}
+
+// shard returns the shard responsible for key.
+func (s *ShardedStore) shard(key string) *MemoryStore {
+	return s.shards[s.index(key)]
+}
+
+// index returns the position of the shard responsible for key.
+func (s *ShardedStore) index(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(s.shards)))
+}
+
+// Cap returns the available capacity of all shards.
+func (s *ShardedStore) Cap() int {
+	var c int
+	for _, m := range s.shards {
+		c += m.Cap()
+	}
+	return c
+}
+
+// Set saves the key/value in the shard responsible for key.
+func (s *ShardedStore) Set(key string, value []byte) error {
+	return s.shard(key).Set(key, value)
+}
+
+// Get returns the value of key from its shard.
+func (s *ShardedStore) Get(key string) ([]byte, bool) {
+	return s.shard(key).Get(key)
+}
+
+// Delete deletes key from its shard.
+func (s *ShardedStore) Delete(key string) error {
+	return s.shard(key).Delete(key)
+}
+
+// Expire sets the time to live of key.
+func (s *ShardedStore) Expire(key string, ttl time.Duration) bool {
+	return s.shard(key).Expire(key, ttl)
+}
+
+// TTL returns the time to live of key.
+func (s *ShardedStore) TTL(key string) (time.Duration, bool) {
+	return s.shard(key).TTL(key)
+}
+
+// Persist removes the deadline of key.
+func (s *ShardedStore) Persist(key string) bool {
+	return s.shard(key).Persist(key)
+}
+
+// SetExpire sets the value and the time to live of key in its shard.
+func (s *ShardedStore) SetExpire(key string, value []byte, ttl time.Duration) error {
+	return s.shard(key).SetExpire(key, value, ttl)
+}
+
+// Close stops the reaper of every shard.
+func (s *ShardedStore) Close() error {
+	for _, m := range s.shards {
+		m.Close()
+	}
+	return nil
+}
+
+// GetLastModifiedKeys merges the keys of every shard ordered from the
+// most to the least recently modified.
+func (s *ShardedStore) GetLastModifiedKeys() []string {
+	lists := make([][]keyRev, len(s.shards))
+	for i, m := range s.shards {
+		lists[i] = m.lastModified()
+	}
+	return mergeRevisions(lists)
+}
+
+// mergeRevisions merges lists of keys ordered from the most to the least
+// recently modified into a single list of keys in the same order.
+func mergeRevisions(lists [][]keyRev) []string {
+	h := make(revHeap, 0, len(lists))
+	n := 0
+	for _, revs := range lists {
+		if len(revs) > 0 {
+			h = append(h, revs)
+			n += len(revs)
+		}
+	}
+	heap.Init(&h)
+
+	r := make([]string, 0, n)
+	for len(h) > 0 {
+		r = append(r, h[0][0].key)
+		if h[0] = h[0][1:]; len(h[0]) == 0 {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+	return r
+}
+
+// revHeap is a max-heap of per shard key lists ordered by the revision
+// of their first key.
+type revHeap [][]keyRev
+
+func (h revHeap) Len() int            { return len(h) }
+func (h revHeap) Less(i, j int) bool  { return h[i][0].rev > h[j][0].rev }
+func (h revHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *revHeap) Push(x interface{}) { *h = append(*h, x.([]keyRev)) }
+
+func (h *revHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestShardedStore(t *testing.T) {
+	s := NewShardedStore(4, 102, nil)
+	defer s.Close()
+
+	if s.Cap() != 102 {
+		t.Errorf("got cap %d, wants: %d", s.Cap(), 102)
+	}
+
+	var want []string
+	for i := 0; i < 10; i++ {
+		k := fmt.Sprintf("key%d", i)
+		if err := s.Set(k, []byte("v")); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		want = append([]string{k}, want...)
+	}
+
+	if v, ok := s.Get("key3"); !ok || string(v) != "v" {
+		t.Errorf("got %v, wants: %v", v, "v")
+	}
+
+	s.Delete("key3")
+	if _, ok := s.Get("key3"); ok {
+		t.Errorf("unexpected key found")
+	}
+	want = append(want[:6], want[7:]...)
+
+	if got := s.GetLastModifiedKeys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wants: %v", got, want)
+	}
+
+	if s.Cap() != 93 {
+		t.Errorf("got cap %d, wants: %d", s.Cap(), 93)
+	}
+}
+
+func TestShardedStoreEviction(t *testing.T) {
+	s := NewShardedStore(2, 2, func(cap int) *MemoryStore {
+		return NewMemoryStore(cap, WithEvictionPolicy(NewFIFOPolicy()))
+	})
+	defer s.Close()
+
+	// Every shard evicts on its own so the store never exceeds its capacity.
+	for i := 0; i < 10; i++ {
+		s.Set(fmt.Sprintf("key%d", i), []byte("v"))
+	}
+
+	if s.Cap() < 0 || len(s.GetLastModifiedKeys()) > 2 {
+		t.Errorf("unexpected cap %d and keys %v", s.Cap(), s.GetLastModifiedKeys())
+	}
+}
@@ -0,0 +1,141 @@
+package store
+
+import "math/rand"
+
+const (
+	skiplistMaxLevel = 32
+	// skiplistP is the probability of a node reaching the next level.
+	skiplistP = 0.25
+)
+
+// skipNode is a key in a skiplist, next has one pointer per level of the node.
+type skipNode struct {
+	key  string
+	prev *skipNode
+	next []*skipNode
+}
+
+// Next returns the following node or nil.
+func (n *skipNode) Next() *skipNode {
+	return n.next[0]
+}
+
+// Prev returns the preceding node or nil.
+func (n *skipNode) Prev() *skipNode {
+	return n.prev
+}
+
+// skiplist is an ordered set of strings with expected O(log n) insert,
+// delete and seek, the bottom level is doubly linked so it can be
+// iterated in both directions.
+type skiplist struct {
+	head  *skipNode
+	tail  *skipNode
+	level int
+	len   int
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{
+		head:  &skipNode{next: make([]*skipNode, skiplistMaxLevel)},
+		level: 1,
+	}
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Float64() < skiplistP {
+		level++
+	}
+	return level
+}
+
+// path fills update with the last node before key on every level.
+func (s *skiplist) path(key string, update []*skipNode) *skipNode {
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+		if update != nil {
+			update[i] = x
+		}
+	}
+	return x
+}
+
+// insert adds key to the set and returns false if it was already present.
+func (s *skiplist) insert(key string) bool {
+	var update [skiplistMaxLevel]*skipNode
+	x := s.path(key, update[:])
+	if n := x.next[0]; n != nil && n.key == key {
+		return false
+	}
+
+	level := randomLevel()
+	if level > s.level {
+		for i := s.level; i < level; i++ {
+			update[i] = s.head
+		}
+		s.level = level
+	}
+
+	n := &skipNode{key: key, next: make([]*skipNode, level)}
+	for i := 0; i < level; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+
+	if x != s.head {
+		n.prev = x
+	}
+	if n.next[0] != nil {
+		n.next[0].prev = n
+	} else {
+		s.tail = n
+	}
+	s.len++
+	return true
+}
+
+// delete removes key from the set and returns false if it was not present.
+func (s *skiplist) delete(key string) bool {
+	var update [skiplistMaxLevel]*skipNode
+	x := s.path(key, update[:]).next[0]
+	if x == nil || x.key != key {
+		return false
+	}
+
+	for i := 0; i < len(x.next); i++ {
+		update[i].next[i] = x.next[i]
+	}
+
+	if x.next[0] != nil {
+		x.next[0].prev = x.prev
+	} else {
+		s.tail = x.prev
+	}
+
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	s.len--
+	return true
+}
+
+// seek returns the first node with a key greater or equal to key or nil.
+func (s *skiplist) seek(key string) *skipNode {
+	return s.path(key, nil).next[0]
+}
+
+// seekLast returns the last node with a key less or equal to key or nil.
+func (s *skiplist) seekLast(key string) *skipNode {
+	x := s.path(key, nil)
+	if n := x.next[0]; n != nil && n.key == key {
+		return n
+	}
+	if x == s.head {
+		return nil
+	}
+	return x
+}
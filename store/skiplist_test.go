@@ -0,0 +1,61 @@
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSkiplist(t *testing.T) {
+	s := newSkiplist()
+	set := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("%04d", rand.Intn(500))
+		if rand.Intn(3) == 0 {
+			if s.delete(key) != set[key] {
+				t.Fatalf("delete %v: unexpected result", key)
+			}
+			delete(set, key)
+			continue
+		}
+
+		if s.insert(key) == set[key] {
+			t.Fatalf("insert %v: unexpected result", key)
+		}
+		set[key] = true
+	}
+
+	var want []string
+	for k := range set {
+		want = append(want, k)
+	}
+	sort.Strings(want)
+
+	if s.len != len(want) {
+		t.Fatalf("got len %d, wants: %d", s.len, len(want))
+	}
+
+	i := 0
+	for n := s.seek(""); n != nil; n = n.Next() {
+		if n.key != want[i] {
+			t.Fatalf("got %v at %d, wants: %v", n.key, i, want[i])
+		}
+		i++
+	}
+
+	i = len(want) - 1
+	for n := s.seekLast("9999"); n != nil; n = n.Prev() {
+		if n.key != want[i] {
+			t.Fatalf("got %v at %d reversed, wants: %v", n.key, i, want[i])
+		}
+		i--
+	}
+
+	if n := s.seek("0250"); n == nil || n.key < "0250" {
+		t.Errorf("unexpected seek result %v", n)
+	}
+	if n := s.seekLast("0250"); n == nil || n.key > "0250" {
+		t.Errorf("unexpected seekLast result %v", n)
+	}
+}
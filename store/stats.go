@@ -0,0 +1,85 @@
+package store
+
+import "sync/atomic"
+
+// Stats are the operation counters of a store since it was created.
+type Stats struct {
+	// Gets is the number of string reads, Hits found the key and Misses did not.
+	Gets   uint64
+	Hits   uint64
+	Misses uint64
+	// Sets is the number of string writes.
+	Sets uint64
+	// Deletes is the number of keys deleted.
+	Deletes uint64
+	// Evictions is the number of keys evicted for capacity and EvictedBytes
+	// the bytes of their values.
+	Evictions    uint64
+	EvictedBytes uint64
+}
+
+// HitRate returns the fraction of the reads that found the key, it is 0
+// before the first read.
+func (s Stats) HitRate() float64 {
+	if s.Gets == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Gets)
+}
+
+// Add returns the sum of the counters of s and o.
+func (s Stats) Add(o Stats) Stats {
+	return Stats{
+		Gets:         s.Gets + o.Gets,
+		Hits:         s.Hits + o.Hits,
+		Misses:       s.Misses + o.Misses,
+		Sets:         s.Sets + o.Sets,
+		Deletes:      s.Deletes + o.Deletes,
+		Evictions:    s.Evictions + o.Evictions,
+		EvictedBytes: s.EvictedBytes + o.EvictedBytes,
+	}
+}
+
+// counters are updated atomically so Stats does not take the store lock,
+// they are allocated on their own to be 64-bit aligned.
+type counters struct {
+	hits, misses, sets, deletes, evictions, evictedBytes uint64
+}
+
+// Stats returns the operation counters of the store.
+func (m *MemoryStore) Stats() Stats {
+	c := m.counters
+	s := Stats{
+		Hits:         atomic.LoadUint64(&c.hits),
+		Misses:       atomic.LoadUint64(&c.misses),
+		Sets:         atomic.LoadUint64(&c.sets),
+		Deletes:      atomic.LoadUint64(&c.deletes),
+		Evictions:    atomic.LoadUint64(&c.evictions),
+		EvictedBytes: atomic.LoadUint64(&c.evictedBytes),
+	}
+	s.Gets = s.Hits + s.Misses
+	return s
+}
+
+// Stats returns the sum of the operation counters of the shards.
+func (s *ShardedStore) Stats() Stats {
+	var st Stats
+	for _, shard := range s.shards {
+		st = st.Add(shard.Stats())
+	}
+	return st
+}
+
+func (t *memoryTx) Stats() Stats {
+	return t.m.Stats()
+}
+
+func (t *shardedTx) Stats() Stats {
+	return t.s.Stats()
+}
+
+// Stats returns the operation counters of the hot store, reads promoting
+// keys from the cold store are counted as misses.
+func (t *TieredStore) Stats() Stats {
+	return t.hot.Stats()
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	s := NewMemoryStore(2)
+	s.Set("a", []byte("1"))
+	s.Set("b", []byte("2"))
+	s.Get("a")
+	s.Get("missing")
+	s.Set("c", []byte("33"))
+	s.Delete("c")
+	s.Delete("missing")
+
+	wants := Stats{Gets: 2, Hits: 1, Misses: 1, Sets: 3, Deletes: 1, Evictions: 2, EvictedBytes: 2}
+	if got := s.Stats(); !reflect.DeepEqual(got, wants) {
+		t.Errorf("got %+v, wants: %+v", got, wants)
+	}
+	if got := s.Stats().HitRate(); got != 0.5 {
+		t.Errorf("got hit rate %v, wants: 0.5", got)
+	}
+
+	// Reads from a view are not counted by the store.
+	s.Set("d", []byte("4"))
+	s.View().Get("d")
+	if got := s.Stats().Gets; got != 2 {
+		t.Errorf("got %d gets after reading a view, wants: 2", got)
+	}
+}
+
+func TestStatsSharded(t *testing.T) {
+	s := NewShardedStore(4, 100, nil)
+	defer s.Close()
+
+	for _, k := range []string{"a", "b", "c", "d"} {
+		s.Set(k, []byte(k))
+		s.Get(k)
+	}
+	if got := s.Stats(); got.Sets != 4 || got.Hits != 4 {
+		t.Errorf("got %+v, wants 4 sets and 4 hits", got)
+	}
+}
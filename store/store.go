@@ -1,154 +1,411 @@
 package store
 
 import (
-	"sort"
+	"errors"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Store defines requirements for an store implementation
+// Store defines requirements for an store implementation.
+//
+// Values are arbitrary bytes, the store keeps the slice passed to Set and
+// Get returns the stored slice without copying, so callers must not modify
+// a value after it is set or returned.
 type Store interface {
-	Set(key, value string) error
-	Get(key string) (string, bool)
+	Set(key string, value []byte) error
+	Get(key string) ([]byte, bool)
 	Delete(key string) error
 	Cap() int
 	GetLastModifiedKeys() []string
 }
 
-// MemoryStore uses a sync.Map to implement the Store interface.
+// StatsReporter is implemented by stores that count their operations.
+type StatsReporter interface {
+	// Stats returns the counters since the store was created.
+	Stats() Stats
+}
+
+// ErrOutOfCapacity is returned by the writes of a store using the
+// noeviction policy when the value does not fit in the available capacity.
+var ErrOutOfCapacity = errors.New("OOM not enough capacity for the value")
+
+// entry is a key/value pair linked into the modification list of a MemoryStore.
+type entry struct {
+	key string
+	// hash is the scan hash of the key.
+	hash uint64
+	stringValue
+	// coll is the value of lists, hashes, sets and sorted sets, shared is
+	// set while a View references it.
+	coll   collection
+	shared bool
+
+	// rev is the store revision of the last modification of the entry.
+	rev uint64
+	mod link
+
+	// expires is zero for keys without a deadline, expiryIndex is the
+	// position of the entry in the expiry heap or -1.
+	expires     time.Time
+	expiryIndex int
+}
+
+// MemoryStore uses a map and an intrusive doubly-linked list to implement
+// the Store interface, the modify list keeps entries in last modified order
+// for GetLastModifiedKeys and an EvictionPolicy chooses the keys to evict
+// when the capacity runs out.
 type MemoryStore struct {
-	s sync.Map
+	mu sync.Mutex
+
+	items map[string]*entry
+
+	// Most recently modified entries are at the head.
+	modified entryList
+	policy   EvictionPolicy
 
-	lastMod sync.Map
-	lastAcc sync.Map
+	// index keeps the keys ordered when WithOrderedIndex is set, hashes
+	// keeps them ordered by scan hash for Scan.
+	index  *skiplist
+	hashes *skiplist
 
-	// TODO: This could be a circular buff
-	cachedAcc sort.IntSlice
-	cachedMod sort.IntSlice
+	// rev is incremented on every modification, it points to a counter
+	// shared by all the shards of a ShardedStore. removedRev is the
+	// revision of the last removal of an entry.
+	rev        *uint64
+	removedRev uint64
+
+	// onEvict and onDelete are called for the removed entries once m.mu
+	// is released by unlock.
+	onEvict  func(key string, value []byte)
+	onDelete func(key string, value []byte, reason DeleteReason)
+	pending  []removal
+
+	// observers are called for every change while m.mu is held.
+	observers []func(Event)
+
+	// pins are the open views of the store.
+	pins []*pin
+
+	// Values of at least compressAbove bytes are compressed with the
+	// flate writers of the pool when WithCompression is set.
+	compressAbove int
+	writers       sync.Pool
+	compression   CompressionStats
+
+	// countOverhead is set by WithOverheadAccounting, keyBytes is the
+	// length of all the keys and limit the capacity of the empty store.
+	countOverhead bool
+	keyBytes      int64
+	limit         int
+
+	// Entries with a deadline, the earliest deadline is at the top.
+	expiring     expiryHeap
+	reapInterval time.Duration
+	reaping      bool
+	done         chan struct{}
+	closeOnce    sync.Once
+
+	counters *counters
 
 	cap int
-	mc  sync.Mutex
+}
+
+// Option configures optional behaviour of a MemoryStore.
+type Option func(*MemoryStore)
+
+// WithEvictionPolicy sets the policy used to evict keys when the store is full,
+// the default policy is LRU.
+func WithEvictionPolicy(p EvictionPolicy) Option {
+	return func(m *MemoryStore) {
+		m.policy = p
+	}
+}
+
+// WithOnEvict sets a function called with the key and value of every string
+// evicted to make room for a new value, it is called after the store lock is
+// released so it may call back into the store.
+func WithOnEvict(fn func(key string, value []byte)) Option {
+	return func(m *MemoryStore) {
+		m.onEvict = fn
+	}
 }
 
 // NewMemoryStore creates a new instance of memoryStore
 // with the internal map initialized.
-func NewMemoryStore(cap int) *MemoryStore {
-	return &MemoryStore{
-		cap: cap,
+func NewMemoryStore(cap int, opts ...Option) *MemoryStore {
+	m := &MemoryStore{
+		items:    make(map[string]*entry),
+		modified: entryList{link: func(e *entry) *link { return &e.mod }},
+		policy:   NewLRUPolicy(),
+		hashes:   newSkiplist(),
+		rev:      new(uint64),
+		cap:      cap,
+		limit:    cap,
+		counters: new(counters),
+
+		reapInterval: DefaultReapInterval,
+		done:         make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(m)
 	}
+	return m
 }
 
 // Cap returns available capacity
 func (m *MemoryStore) Cap() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	return m.cap
 }
 
-// Set receives key and value strings and saves the key/value in the internal map.
-func (m *MemoryStore) Set(key, value string) error {
-	if m.cap < len(value) {
-		m.clean(len(value))
+// Set receives a key string and a value and saves the key/value in the internal map,
+// keys chosen by the eviction policy are evicted until the value fits in the available capacity.
+// With the noeviction policy ErrOutOfCapacity is returned instead.
+// Setting a key removes its expiry deadline.
+func (m *MemoryStore) Set(key string, value []byte) error {
+	v := m.encode(value)
+	m.mu.Lock()
+	defer m.unlock()
+	return m.set(key, v)
+}
+
+// Get receives a key string and return the value and a boolean, compressed
+// values are decompressed after the lock is released.
+func (m *MemoryStore) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	v, ok := m.get(key)
+	m.unlock()
+	if !ok {
+		return nil, false
 	}
+	return v.bytes(), true
+}
 
-	m.s.Store(key, value)
+// Delete receives a key string and deletes its value from the internal map.
+func (m *MemoryStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.unlock()
+	m.delete(key)
+	return nil
+}
+
+// GetLastModifiedKeys returns all keys ordered from the most to the least recently modified.
+func (m *MemoryStore) GetLastModifiedKeys() []string {
+	revs := m.lastModified()
+	r := make([]string, len(revs))
+	for i, kr := range revs {
+		r[i] = kr.key
+	}
+	return r
+}
 
-	// Increase num
-	m.trackModifield(key)
+// keyRev is a key with the revision of its last modification.
+type keyRev struct {
+	key string
+	rev uint64
+}
 
-	// Reduce capacity
-	m.mc.Lock()
-	defer m.mc.Unlock()
-	m.cap -= len(value)
+// lastModified returns the keys and their revisions ordered from the most to the least recently modified.
+func (m *MemoryStore) lastModified() []keyRev {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.revisions()
+}
 
-	return nil
+// revisions returns the keys and their revisions ordered from the most to the
+// least recently modified, m.mu must be held.
+func (m *MemoryStore) revisions() []keyRev {
+	now := time.Now()
+	r := make([]keyRev, 0, m.modified.len)
+	for e := m.modified.head; e != nil; e = e.mod.next {
+		if !e.expired(now) {
+			r = append(r, keyRev{key: e.key, rev: e.rev})
+		}
+	}
+	return r
 }
 
-// Get receives a key string and return the value and a boolean.
-func (m *MemoryStore) Get(key string) (string, bool) {
-	v, ok := m.s.Load(key)
+// set stores the encoded value v under key evicting entries to make room for
+// it, with the noeviction policy it returns ErrOutOfCapacity and keeps the
+// old value if the value does not fit, m.mu must be held.
+func (m *MemoryStore) set(key string, v stringValue) error {
+	e, ok := m.lookup(key)
+	// A new key also needs room for its overhead.
+	need := v.size()
 	if !ok {
-		return "", false
+		need += m.overhead(key)
+	}
+	if !evicts(m.policy) {
+		available := m.cap
+		if ok {
+			available += e.size()
+		}
+		if need > available {
+			return ErrOutOfCapacity
+		}
 	}
 
-	// Push last accessed item
-	m.trackAccess(key)
+	// The old value no longer counts against the capacity, it is emptied
+	// so the entry gives nothing back if the policy evicts it while cleaning.
+	if ok {
+		m.preserve(e)
+		m.cap += e.size()
+		m.compressed(&e.stringValue, -1)
+		e.stringValue = stringValue{}
+		e.coll, e.shared = nil, false
+		m.clearExpiry(e)
+	}
 
-	return v.(string), ok
+	m.clean(need, key)
+	if ok && m.items[key] != e {
+		// The policy evicted the key being set, it is added again.
+		m.clean(need+m.overhead(key), key)
+	}
+
+	if ok && m.items[key] == e {
+		e.stringValue = v
+		m.modified.moveToFront(e)
+		m.policy.Accessed(key)
+	} else {
+		e = &entry{key: key, stringValue: v, expiryIndex: -1}
+		m.add(e)
+	}
+	m.compressed(&v, 1)
+	e.rev = atomic.AddUint64(m.rev, 1)
+	m.cap -= v.size()
+	atomic.AddUint64(&m.counters.sets, 1)
+	m.notify(EventSet, key)
+	return nil
 }
 
-// Delete receives a key string and deletes its value from the internal map.
-func (m *MemoryStore) Delete(key string) error {
-	v, _ := m.Get(key)
-	m.s.Delete(key)
+// get returns the value of key if it is a string, the value is not modified
+// once stored so its bytes can be read without m.mu, m.mu must be held.
+func (m *MemoryStore) get(key string) (stringValue, bool) {
+	e, ok := m.lookup(key)
+	if !ok || e.coll != nil {
+		atomic.AddUint64(&m.counters.misses, 1)
+		return stringValue{}, false
+	}
 
-	m.cleanAccess(key)
+	atomic.AddUint64(&m.counters.hits, 1)
+	m.policy.Accessed(key)
+	return e.stringValue, true
+}
 
-	m.mc.Lock()
-	m.cap += len(v)
-	m.mc.Unlock()
-	return nil
+// delete removes key if it exists, m.mu must be held.
+func (m *MemoryStore) delete(key string) {
+	if e, ok := m.lookup(key); ok {
+		m.remove(e)
+		m.policy.Removed(key)
+		m.removed(e, ReasonDeleted)
+		m.notify(EventDelete, key)
+	}
 }
 
-func (m *MemoryStore) GetLastModifiedKeys() []string {
-	var (
-		r []string
-	)
-	if sort.IsSorted(m.cachedMod) {
-		m.lastAcc.Range(func(key interface{}, value interface{}) bool {
-			m.cachedMod = append(m.cachedMod, key.(int))
-			return true
-		})
-		sort.Sort(sort.Reverse(m.cachedMod))
+// add links a new entry, m.mu must be held.
+func (m *MemoryStore) add(e *entry) {
+	e.hash = scanHash(e.key)
+	m.items[e.key] = e
+	m.hashes.insert(scanKey(e.hash, e.key))
+	m.modified.pushFront(e)
+	m.policy.Added(e.key)
+	m.keyBytes += int64(len(e.key))
+	m.cap -= m.overhead(e.key)
+	if m.index != nil {
+		m.index.insert(e.key)
 	}
+}
 
-	for _, t := range m.cachedMod {
-		v, _ := m.lastMod.Load(t)
-		r = append(r, v.(string))
+// remove unlinks the entry and gives its bytes back, m.mu must be held.
+func (m *MemoryStore) remove(e *entry) {
+	m.preserve(e)
+	m.removedRev = atomic.AddUint64(m.rev, 1)
+	delete(m.items, e.key)
+	m.hashes.delete(scanKey(e.hash, e.key))
+	m.modified.remove(e)
+	if m.index != nil {
+		m.index.delete(e.key)
 	}
-	return r
+	m.clearExpiry(e)
+	m.cap += e.size() + m.overhead(e.key)
+	m.keyBytes -= int64(len(e.key))
+	m.compressed(&e.stringValue, -1)
 }
 
-func (m *MemoryStore) trackModifield(key string) {
-	t := int(time.Now().Unix())
-	m.lastMod.Store(t, key)
-	m.cachedMod = append(sort.IntSlice{t}, m.cachedMod...)
+// clean evicts the entries chosen by the eviction policy until size bytes
+// are available or the store is empty, the key being set is spared by
+// policies implementing Sparing and its entry is not reported otherwise,
+// m.mu must be held.
+func (m *MemoryStore) clean(size int, setting string) {
+	sparing, _ := m.policy.(Sparing)
+	for m.cap < size {
+		var key string
+		var ok bool
+		if sparing != nil {
+			key, ok = sparing.VictimExcept(setting)
+		} else {
+			key, ok = m.policy.Victim()
+		}
+		if !ok {
+			break
+		}
+		if e, ok := m.items[key]; ok {
+			m.remove(e)
+			if key != setting {
+				m.removed(e, ReasonCapacity)
+				m.notify(EventEvict, key)
+			}
+		}
+	}
 }
 
-func (m *MemoryStore) trackAccess(key string) {
-	t := int(time.Now().Unix())
-	m.lastAcc.Store(t, key)
-	m.cachedAcc = append(m.cachedAcc, t)
+// size returns the number of bytes of the value counted against the capacity.
+func (e *entry) size() int {
+	if e.coll != nil {
+		return e.coll.size()
+	}
+	return e.stringValue.size()
 }
 
-func (m *MemoryStore) cleanAccess(key string) {
-	m.lastAcc.Range(func(t interface{}, value interface{}) bool {
-		if value.(string) == key {
-			m.lastAcc.Delete(key)
-			return false
-		}
-		return true
-	})
+// stringValue is the value of a string entry. Values that are canonical
+// 64-bit integers are kept in num instead of value and isInt is set for
+// them, compressed values keep their original length in raw.
+type stringValue struct {
+	value      []byte
+	num        int64
+	isInt      bool
+	compressed bool
+	raw        int
+}
 
-	m.lastMod.Range(func(t interface{}, value interface{}) bool {
-		if value.(string) == key {
-			m.lastMod.Delete(key)
-			return false
-		}
-		return true
-	})
+// size returns the number of bytes kept for the value.
+func (v *stringValue) size() int {
+	if v.isInt {
+		return intLen(v.num)
+	}
+	return len(v.value)
 }
 
-func (m *MemoryStore) clean(size int) {
-	if !sort.IsSorted(m.cachedAcc) {
-		m.lastAcc.Range(func(key interface{}, value interface{}) bool {
-			m.cachedAcc = append(m.cachedAcc, key.(int))
-			return true
-		})
-		sort.Sort(m.cachedAcc)
+// bytes returns the string value, integers are formatted and compressed
+// values are decompressed into a new slice.
+func (v *stringValue) bytes() []byte {
+	switch {
+	case v.isInt:
+		return strconv.AppendInt(nil, v.num, 10)
+	case v.compressed:
+		return inflate(v.value, v.raw)
 	}
+	return v.value
+}
 
-	for m.cap < size && len(m.cachedAcc) > 0 {
-		k, _ := m.lastAcc.Load(m.cachedAcc[0])
-		m.cachedAcc = append(m.cachedAcc[:0], m.cachedAcc[1:]...)
-		m.Delete(k.(string))
+// typ returns the type of the value.
+func (e *entry) typ() Type {
+	if e.coll != nil {
+		return e.coll.typ()
 	}
+	return TypeString
 }
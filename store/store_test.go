@@ -1,28 +1,32 @@
 package store
 
-import "testing"
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
 
 func TestSet(t *testing.T) {
 	s := NewMemoryStore(100)
 
 	for _, tt := range []struct {
 		K string
-		V string
+		V []byte
 	}{
 		{
 			K: "foo",
-			V: "value",
+			V: []byte("value"),
 		},
 		{
 			K: "bar",
-			V: "aaaa\r\nbbbbb",
+			V: []byte("aaaa\r\nbbbbb\x00"),
 		},
 	} {
 		if err := s.Set(tt.K, tt.V); err != nil {
 			t.Errorf("unexpected err: %v", err)
 		}
 
-		if v, _ := s.s.Load(tt.K); tt.V != v {
+		if e, ok := s.items[tt.K]; !ok || !bytes.Equal(tt.V, e.value) {
 			t.Errorf("key not stored")
 		}
 	}
@@ -30,13 +34,13 @@ func TestSet(t *testing.T) {
 
 func TestGet(t *testing.T) {
 	s := NewMemoryStore(100)
-	s.s.Store("foo", "bar")
+	s.Set("foo", []byte("bar"))
 	v, ok := s.Get("foo")
 	if !ok {
 		t.Error("unexpected false return")
 	}
 
-	if v != "bar" {
+	if string(v) != "bar" {
 		t.Errorf("got: %v, wants: %v", v, "bar")
 	}
 
@@ -48,9 +52,62 @@ func TestGet(t *testing.T) {
 
 func TestDelete(t *testing.T) {
 	s := NewMemoryStore(100)
-	s.s.Store("foo", "bar")
+	s.Set("foo", []byte("bar"))
 	s.Delete("foo")
-	if _, ok := s.s.Load("foo"); ok {
+	if _, ok := s.items["foo"]; ok {
 		t.Errorf("unexpected key found")
 	}
+
+	if s.Cap() != 100 {
+		t.Errorf("got cap %d, wants: %d", s.Cap(), 100)
+	}
+}
+
+func TestCap(t *testing.T) {
+	s := NewMemoryStore(10)
+	s.Set("foo", []byte("aaa"))
+	s.Set("foo", []byte("bbbbb"))
+	if s.Cap() != 5 {
+		t.Errorf("got cap %d, wants: %d", s.Cap(), 5)
+	}
+}
+
+func TestEvictLeastRecentlyUsed(t *testing.T) {
+	s := NewMemoryStore(3)
+	s.Set("a", []byte("1"))
+	s.Set("b", []byte("2"))
+	s.Set("c", []byte("3"))
+
+	// Keys touched within the same second must keep their exact order.
+	s.Get("a")
+	s.Set("d", []byte("4"))
+
+	if _, ok := s.Get("b"); ok {
+		t.Errorf("expected b to be evicted")
+	}
+
+	for _, k := range []string{"a", "c", "d"} {
+		if _, ok := s.Get(k); !ok {
+			t.Errorf("expected %v to be kept", k)
+		}
+	}
+
+	if s.Cap() != 0 {
+		t.Errorf("got cap %d, wants: %d", s.Cap(), 0)
+	}
+}
+
+func TestGetLastModifiedKeys(t *testing.T) {
+	s := NewMemoryStore(100)
+	s.Set("a", []byte("1"))
+	s.Set("b", []byte("2"))
+	s.Set("c", []byte("3"))
+	s.Set("a", []byte("4"))
+	s.Get("b")
+	s.Delete("c")
+
+	want := []string{"a", "b"}
+	if got := s.GetLastModifiedKeys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wants: %v", got, want)
+	}
 }
@@ -0,0 +1,119 @@
+// Package storetest provides tests shared by the store.Store implementations.
+package storetest
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/rsampaio/kvstore/store"
+)
+
+// Run runs the tests every store.Store implementation must pass, newStore
+// is called by each test to create an empty store with enough capacity
+// for a few hundred small keys.
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	for _, tt := range []struct {
+		Name string
+		Test func(*testing.T, store.Store)
+	}{
+		{"SetGet", testSetGet},
+		{"Overwrite", testOverwrite},
+		{"Delete", testDelete},
+		{"BinaryValues", testBinaryValues},
+		{"LastModifiedKeys", testLastModifiedKeys},
+		{"Cap", testCap},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.Test(t, newStore(t))
+		})
+	}
+}
+
+func testSetGet(t *testing.T, s store.Store) {
+	for i := 0; i < 100; i++ {
+		if err := s.Set(fmt.Sprintf("key%03d", i), []byte(fmt.Sprintf("value%d", i))); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		v, ok := s.Get(fmt.Sprintf("key%03d", i))
+		if want := fmt.Sprintf("value%d", i); !ok || string(v) != want {
+			t.Errorf("got %q %v, wants: %q", v, ok, want)
+		}
+	}
+
+	if _, ok := s.Get("missing"); ok {
+		t.Errorf("unexpected key found")
+	}
+}
+
+func testOverwrite(t *testing.T, s store.Store) {
+	s.Set("foo", []byte("bar"))
+	s.Set("foo", []byte("baz"))
+
+	if v, ok := s.Get("foo"); !ok || string(v) != "baz" {
+		t.Errorf("got %q %v, wants: %q", v, ok, "baz")
+	}
+}
+
+func testDelete(t *testing.T, s store.Store) {
+	s.Set("foo", []byte("bar"))
+	if err := s.Delete("foo"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if _, ok := s.Get("foo"); ok {
+		t.Errorf("unexpected key found")
+	}
+
+	if err := s.Delete("missing"); err != nil {
+		t.Errorf("unexpected err deleting missing key: %v", err)
+	}
+}
+
+func testBinaryValues(t *testing.T, s store.Store) {
+	want := []byte{0, '\r', '\n', 0xff, ' '}
+	s.Set("foo", want)
+
+	if v, ok := s.Get("foo"); !ok || !bytes.Equal(v, want) {
+		t.Errorf("got %q %v, wants: %q", v, ok, want)
+	}
+}
+
+func testLastModifiedKeys(t *testing.T, s store.Store) {
+	s.Set("a", []byte("1"))
+	s.Set("b", []byte("2"))
+	s.Set("c", []byte("3"))
+	s.Set("a", []byte("4"))
+	s.Get("b")
+	s.Delete("c")
+
+	want := []string{"a", "b"}
+	if got := s.GetLastModifiedKeys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wants: %v", got, want)
+	}
+}
+
+func testCap(t *testing.T, s store.Store) {
+	before := s.Cap()
+	s.Set("foo", []byte("bar"))
+
+	if s.Cap() >= before {
+		t.Errorf("expected cap %d to be lower than %d", s.Cap(), before)
+	}
+
+	// Writing twice the capacity evicts keys or fails with
+	// store.ErrOutOfCapacity, the capacity is never exceeded.
+	value := bytes.Repeat([]byte("v"), before/10)
+	for i := 0; i < 20; i++ {
+		if err := s.Set(fmt.Sprintf("big%d", i), value); err != nil && err != store.ErrOutOfCapacity {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if c := s.Cap(); c < 0 {
+			t.Fatalf("got cap %d after %d writes, wants at least 0", c, i+1)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// TieredStore implements the Store interface with a bounded MemoryStore
+// serving hot keys in front of a persistent cold store.
+//
+// Keys evicted from the hot store by the capacity limit are demoted to the
+// cold store instead of being lost and keys missing from the hot store are
+// promoted back on Get. The cold store may keep an outdated copy of a hot
+// key, the hot store always has precedence and the copy is replaced when
+// the key is demoted again.
+type TieredStore struct {
+	hot  *MemoryStore
+	cold Store
+
+	// mu serializes operations so demotions, which run inside the hot
+	// store Set, are applied to the cold store in the order of the evictions.
+	mu  sync.Mutex
+	err error
+}
+
+// NewTieredStore creates a store with a hot MemoryStore of capacity cap
+// configured with opts in front of cold.
+func NewTieredStore(cap int, cold Store, opts ...Option) *TieredStore {
+	t := &TieredStore{cold: cold}
+	t.hot = NewMemoryStore(cap, append(opts, WithOnEvict(t.demote))...)
+	return t
+}
+
+// demote writes an entry evicted from the hot store to the cold store,
+// it is called by the hot store while t.mu is held.
+func (t *TieredStore) demote(key string, value []byte) {
+	if err := t.cold.Set(key, value); err != nil && t.err == nil {
+		t.err = err
+	}
+}
+
+// Cap returns the available capacity of the hot store.
+func (t *TieredStore) Cap() int {
+	return t.hot.Cap()
+}
+
+// Set saves the key/value in the hot store demoting evicted keys to the cold store.
+func (t *TieredStore) Set(key string, value []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.set(key, value)
+}
+
+// set saves the key/value in the hot store and returns the first demotion error, t.mu must be held.
+func (t *TieredStore) set(key string, value []byte) error {
+	t.err = nil
+	if err := t.hot.Set(key, value); err != nil {
+		return err
+	}
+	return t.err
+}
+
+// Get returns the value of key from the hot store or promotes it from the cold store.
+func (t *TieredStore) Get(key string) ([]byte, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if v, ok := t.hot.Get(key); ok {
+		return v, true
+	}
+
+	v, ok := t.cold.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	if err := t.set(key, v); err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// Delete deletes key from both stores.
+func (t *TieredStore) Delete(key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.hot.Delete(key); err != nil {
+		return err
+	}
+	return t.cold.Delete(key)
+}
+
+// GetLastModifiedKeys returns the keys of the hot store ordered from the most
+// to the least recently modified followed by the keys only in the cold store.
+func (t *TieredStore) GetLastModifiedKeys() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys := t.hot.GetLastModifiedKeys()
+	hot := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		hot[k] = true
+	}
+
+	for _, k := range t.cold.GetLastModifiedKeys() {
+		if !hot[k] {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Close demotes the strings of the hot store so they survive a restart and
+// replace the outdated copies of the cold store, then closes the hot store
+// and the cold store if it implements io.Closer.
+func (t *TieredStore) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var err error
+	for _, kv := range t.hot.stringEntries() {
+		if serr := t.cold.Set(kv.key, kv.value); serr != nil && err == nil {
+			err = serr
+		}
+	}
+
+	t.hot.Close()
+	if c, ok := t.cold.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// keyValue is a key with its string value.
+type keyValue struct {
+	key   string
+	value []byte
+}
+
+// stringEntries returns the unexpired string entries ordered from the least to the
+// most recently modified.
+func (m *MemoryStore) stringEntries() []keyValue {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var r []keyValue
+	for e := m.modified.tail; e != nil; e = e.mod.prev {
+		if e.coll == nil && !e.expired(now) {
+			r = append(r, keyValue{key: e.key, value: e.bytes()})
+		}
+	}
+	return r
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTieredStore(t *testing.T) {
+	cold := NewMemoryStore(100)
+	s := NewTieredStore(2, cold)
+	defer s.Close()
+
+	s.Set("a", []byte("1"))
+	s.Set("b", []byte("2"))
+	s.Set("c", []byte("3"))
+
+	// a was evicted from the hot store and demoted instead of being lost.
+	if _, ok := s.hot.items["a"]; ok {
+		t.Errorf("expected a to be evicted from the hot store")
+	}
+	if v, ok := cold.Get("a"); !ok || string(v) != "1" {
+		t.Errorf("expected a to be demoted, got %q %v", v, ok)
+	}
+
+	// Reading a promotes it back and demotes b.
+	if v, ok := s.Get("a"); !ok || string(v) != "1" {
+		t.Errorf("got %q %v, wants: %q", v, ok, "1")
+	}
+	if _, ok := s.hot.items["a"]; !ok {
+		t.Errorf("expected a to be promoted")
+	}
+	if _, ok := cold.Get("b"); !ok {
+		t.Errorf("expected b to be demoted")
+	}
+
+	want := []string{"a", "c", "b"}
+	if got := s.GetLastModifiedKeys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wants: %v", got, want)
+	}
+
+	s.Delete("b")
+	if _, ok := s.Get("b"); ok {
+		t.Errorf("unexpected deleted key found")
+	}
+}
+
+func TestTieredStoreReopen(t *testing.T) {
+	cold := NewMemoryStore(100)
+	s := NewTieredStore(2, cold)
+
+	s.Set("a", []byte("1"))
+	s.Set("b", []byte("2"))
+	s.Set("c", []byte("3"))
+	// a is demoted and then overwritten while hot.
+	s.Get("a")
+	s.Set("a", []byte("4"))
+	s.Close()
+
+	s = NewTieredStore(2, cold)
+	defer s.Close()
+	for k, want := range map[string]string{"a": "4", "b": "2", "c": "3"} {
+		if v, ok := s.Get(k); !ok || string(v) != want {
+			t.Errorf("%s: got %q %v, wants: %q", k, v, ok, want)
+		}
+	}
+}
+
+func TestOnEvict(t *testing.T) {
+	var evicted []string
+	var s *MemoryStore
+	s = NewMemoryStore(2, WithOnEvict(func(key string, value []byte) {
+		// The store lock is released so the callback can use the store.
+		s.Cap()
+		evicted = append(evicted, key+"="+string(value))
+	}))
+
+	s.Set("a", []byte("1"))
+	s.Set("b", []byte("2"))
+	s.Set("b", []byte("3"))
+	s.Set("c", []byte("4"))
+
+	if want := []string{"a=1"}; !reflect.DeepEqual(evicted, want) {
+		t.Errorf("got %v, wants: %v", evicted, want)
+	}
+}
@@ -0,0 +1,210 @@
+package store
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrConflict is returned by Atomically when a watched key was modified.
+var ErrConflict = errors.New("watched key modified")
+
+// Transactional is implemented by stores that can apply several operations
+// atomically, keys are watched by saving their Revision and a transaction
+// is aborted if any of them was modified since.
+type Transactional interface {
+	// Revision returns the revision of the last modification of key or the
+	// current revision of the store if key does not exist.
+	Revision(key string) uint64
+	// Atomically calls fn with a store whose operations are applied while no
+	// other operation can run, fn is not called and ErrConflict is returned if
+	// the revision of a watched key changed. A missing key is also modified
+	// when a key of the store was removed since it was watched, so a key
+	// added and removed again is detected. The store passed to fn also
+	// implements Expirer and must not be used after fn returns.
+	Atomically(watched map[string]uint64, fn func(tx Store) error) error
+}
+
+// Revision returns the revision of the last modification of key or the
+// current revision of the store if key does not exist.
+func (m *MemoryStore) Revision(key string) uint64 {
+	m.mu.Lock()
+	defer m.unlock()
+	if e, ok := m.lookup(key); ok {
+		return e.rev
+	}
+	return atomic.LoadUint64(m.rev)
+}
+
+// Atomically runs fn holding the store lock, removed keys are reported
+// after the lock is released.
+func (m *MemoryStore) Atomically(watched map[string]uint64, fn func(tx Store) error) error {
+	m.mu.Lock()
+	for key, rev := range watched {
+		if m.modifiedSince(key, rev) {
+			m.unlock()
+			return ErrConflict
+		}
+	}
+
+	err := fn(&memoryTx{m: m})
+	m.unlock()
+	return err
+}
+
+// modifiedSince reports whether key was modified since Revision returned rev,
+// a missing key was modified if an entry was removed since, m.mu must be held.
+func (m *MemoryStore) modifiedSince(key string, rev uint64) bool {
+	if e, ok := m.lookup(key); ok {
+		return e.rev != rev
+	}
+	return m.removedRev > rev
+}
+
+// revision returns the revision of key or 0 if it does not exist, m.mu must be held.
+func (m *MemoryStore) revision(key string) uint64 {
+	e, ok := m.lookup(key)
+	if !ok {
+		return 0
+	}
+	return e.rev
+}
+
+// Revision returns the revision of the last modification of key.
+func (s *ShardedStore) Revision(key string) uint64 {
+	return s.shard(key).Revision(key)
+}
+
+// Atomically runs fn holding the lock of every shard, the locks are
+// always taken in the same order so transactions cannot deadlock.
+func (s *ShardedStore) Atomically(watched map[string]uint64, fn func(tx Store) error) error {
+	tx := &shardedTx{s: s, txs: make([]*memoryTx, len(s.shards))}
+	for i, m := range s.shards {
+		m.mu.Lock()
+		tx.txs[i] = &memoryTx{m: m}
+	}
+
+	var err error
+	for key, rev := range watched {
+		if s.shard(key).modifiedSince(key, rev) {
+			err = ErrConflict
+			break
+		}
+	}
+
+	if err == nil {
+		err = fn(tx)
+	}
+
+	for i := len(s.shards) - 1; i >= 0; i-- {
+		s.shards[i].unlock()
+	}
+	return err
+}
+
+// memoryTx implements Store and the optional interfaces of MemoryStore on a
+// locked MemoryStore, the methods call the internal functions that expect
+// m.mu to be held.
+type memoryTx struct {
+	m *MemoryStore
+}
+
+func (t *memoryTx) Set(key string, value []byte) error {
+	return t.m.set(key, t.m.encode(value))
+}
+
+func (t *memoryTx) Get(key string) ([]byte, bool) {
+	v, ok := t.m.get(key)
+	if !ok {
+		return nil, false
+	}
+	return v.bytes(), true
+}
+
+func (t *memoryTx) Delete(key string) error {
+	t.m.delete(key)
+	return nil
+}
+
+func (t *memoryTx) Cap() int {
+	return t.m.cap
+}
+
+func (t *memoryTx) GetLastModifiedKeys() []string {
+	revs := t.m.revisions()
+	r := make([]string, len(revs))
+	for i, kr := range revs {
+		r[i] = kr.key
+	}
+	return r
+}
+
+func (t *memoryTx) Expire(key string, ttl time.Duration) bool {
+	return t.m.expire(key, ttl)
+}
+
+func (t *memoryTx) TTL(key string) (time.Duration, bool) {
+	return t.m.ttl(key)
+}
+
+func (t *memoryTx) Persist(key string) bool {
+	return t.m.persist(key)
+}
+
+func (t *memoryTx) SetExpire(key string, value []byte, ttl time.Duration) error {
+	return t.m.setExpire(key, t.m.encode(value), ttl)
+}
+
+// shardedTx routes the operations of a transaction to the locked shards.
+type shardedTx struct {
+	s   *ShardedStore
+	txs []*memoryTx
+}
+
+func (t *shardedTx) tx(key string) *memoryTx {
+	return t.txs[t.s.index(key)]
+}
+
+func (t *shardedTx) Set(key string, value []byte) error {
+	return t.tx(key).Set(key, value)
+}
+
+func (t *shardedTx) Get(key string) ([]byte, bool) {
+	return t.tx(key).Get(key)
+}
+
+func (t *shardedTx) Delete(key string) error {
+	return t.tx(key).Delete(key)
+}
+
+func (t *shardedTx) Cap() int {
+	var c int
+	for _, tx := range t.txs {
+		c += tx.Cap()
+	}
+	return c
+}
+
+func (t *shardedTx) GetLastModifiedKeys() []string {
+	lists := make([][]keyRev, len(t.txs))
+	for i, tx := range t.txs {
+		lists[i] = tx.m.revisions()
+	}
+	return mergeRevisions(lists)
+}
+
+func (t *shardedTx) Expire(key string, ttl time.Duration) bool {
+	return t.tx(key).Expire(key, ttl)
+}
+
+func (t *shardedTx) TTL(key string) (time.Duration, bool) {
+	return t.tx(key).TTL(key)
+}
+
+func (t *shardedTx) Persist(key string) bool {
+	return t.tx(key).Persist(key)
+}
+
+func (t *shardedTx) SetExpire(key string, value []byte, ttl time.Duration) error {
+	return t.tx(key).SetExpire(key, value, ttl)
+}
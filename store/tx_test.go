@@ -0,0 +1,85 @@
+package store
+
+import "testing"
+
+func TestAtomically(t *testing.T) {
+	for name, s := range map[string]interface {
+		Store
+		Transactional
+	}{
+		"memory":  NewMemoryStore(100),
+		"sharded": NewShardedStore(4, 100, nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			s.Set("a", []byte("1"))
+			watched := map[string]uint64{"a": s.Revision("a"), "b": s.Revision("b")}
+
+			err := s.Atomically(watched, func(tx Store) error {
+				tx.Set("b", []byte("2"))
+				tx.Delete("a")
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if _, ok := s.Get("a"); ok {
+				t.Errorf("expected a to be deleted")
+			}
+			if v, _ := s.Get("b"); string(v) != "2" {
+				t.Errorf("got b %q, wants: %q", v, "2")
+			}
+
+			called := false
+			err = s.Atomically(watched, func(tx Store) error {
+				called = true
+				return nil
+			})
+			if err != ErrConflict || called {
+				t.Errorf("got %v called %v, wants: %v", err, called, ErrConflict)
+			}
+		})
+	}
+}
+
+func TestAtomicallyReaddedKey(t *testing.T) {
+	for name, s := range map[string]interface {
+		Store
+		Transactional
+	}{
+		"memory":  NewMemoryStore(100),
+		"sharded": NewShardedStore(4, 100, nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			// A missing key set and deleted again after being watched
+			// is modified.
+			watched := map[string]uint64{"a": s.Revision("a")}
+			s.Set("a", []byte("1"))
+			s.Delete("a")
+
+			err := s.Atomically(watched, func(tx Store) error {
+				return nil
+			})
+			if err != ErrConflict {
+				t.Errorf("got %v, wants: %v", err, ErrConflict)
+			}
+
+			watched = map[string]uint64{"a": s.Revision("a")}
+			err = s.Atomically(watched, func(tx Store) error {
+				if _, ok := tx.(StatsReporter); !ok {
+					t.Errorf("expected the transaction to report stats")
+				}
+				if _, ok := tx.(Compressor); !ok {
+					t.Errorf("expected the transaction to report compression")
+				}
+				if _, ok := tx.(MemoryReporter); !ok {
+					t.Errorf("expected the transaction to report memory")
+				}
+				return nil
+			})
+			if err != nil {
+				t.Errorf("unexpected err: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+// Type is the type of the value of a key.
+type Type int
+
+const (
+	// TypeNone is the type of keys that do not exist.
+	TypeNone Type = iota
+	TypeString
+	TypeList
+	TypeHash
+	TypeSet
+	TypeZSet
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeList:
+		return "list"
+	case TypeHash:
+		return "hash"
+	case TypeSet:
+		return "set"
+	case TypeZSet:
+		return "zset"
+	}
+	return "none"
+}
+
+// ErrWrongType is returned by operations on a key holding a value of another type.
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// ScoredMember is a member of a sorted set with its score.
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+// Collections is implemented by stores with typed values, lists, hashes,
+// sets and sorted sets are created by their first write and deleted when
+// they become empty. Get only returns string values and Set replaces a value
+// of any type.
+type Collections interface {
+	// Type returns the type of the value of key.
+	Type(key string) Type
+
+	// LPush inserts values at the head of the list and returns its length.
+	LPush(key string, values ...[]byte) (int, error)
+	// RPop removes and returns the last element of the list.
+	RPop(key string) ([]byte, bool, error)
+	// LRange returns the elements between start and stop inclusive,
+	// negative indexes count from the end of the list.
+	LRange(key string, start, stop int) ([][]byte, error)
+
+	// HSet sets a field of the hash and returns true if the field is new.
+	HSet(key, field string, value []byte) (bool, error)
+	// HGet returns the value of a field of the hash.
+	HGet(key, field string) ([]byte, bool, error)
+	// HGetAll returns the fields of the hash in lexicographic order.
+	HGetAll(key string) ([]KeyValue, error)
+
+	// SAdd adds members to the set and returns the number of new members.
+	SAdd(key string, members ...string) (int, error)
+	// SIsMember reports whether member is in the set.
+	SIsMember(key, member string) (bool, error)
+	// SMembers returns the members of the set in lexicographic order.
+	SMembers(key string) ([]string, error)
+
+	// ZAdd sets the score of a member of the sorted set and returns true if
+	// the member is new.
+	ZAdd(key string, score float64, member string) (bool, error)
+	// ZRange returns the members between the ranks start and stop inclusive
+	// ordered by score and member, negative ranks count from the end.
+	ZRange(key string, start, stop int) ([]ScoredMember, error)
+	// ZScore returns the score of a member of the sorted set.
+	ZScore(key, member string) (float64, bool, error)
+}
+
+// collection is a value made of elements, size is the number of bytes of
+// the elements counted against the capacity of the store.
+type collection interface {
+	typ() Type
+	len() int
+	size() int
+	// clone returns a copy sharing only the element values.
+	clone() collection
+}
+
+// listValue keeps the elements in reverse order so LPUSH appends
+// and RPOP removes the first element.
+type listValue struct {
+	rev   [][]byte
+	bytes int
+}
+
+func (l *listValue) typ() Type { return TypeList }
+func (l *listValue) len() int  { return len(l.rev) }
+func (l *listValue) size() int { return l.bytes }
+
+func (l *listValue) clone() collection {
+	return &listValue{rev: append([][]byte(nil), l.rev...), bytes: l.bytes}
+}
+
+// slice returns the elements between start and stop.
+func (l *listValue) slice(start, stop int) [][]byte {
+	i, j := span(start, stop, l.len())
+	r := make([][]byte, 0, j-i)
+	for k := i; k < j; k++ {
+		r = append(r, l.rev[l.len()-1-k])
+	}
+	return r
+}
+
+type hashValue struct {
+	fields map[string][]byte
+	bytes  int
+}
+
+func (h *hashValue) typ() Type { return TypeHash }
+func (h *hashValue) len() int  { return len(h.fields) }
+func (h *hashValue) size() int { return h.bytes }
+
+func (h *hashValue) clone() collection {
+	c := &hashValue{fields: make(map[string][]byte, len(h.fields)), bytes: h.bytes}
+	for f, v := range h.fields {
+		c.fields[f] = v
+	}
+	return c
+}
+
+// all returns the fields ordered by name.
+func (h *hashValue) all() []KeyValue {
+	r := make([]KeyValue, 0, h.len())
+	for _, f := range sortedKeys(h.fields) {
+		r = append(r, KeyValue{Key: f, Value: h.fields[f]})
+	}
+	return r
+}
+
+type setValue struct {
+	members map[string]struct{}
+	bytes   int
+}
+
+func (s *setValue) typ() Type { return TypeSet }
+func (s *setValue) len() int  { return len(s.members) }
+func (s *setValue) size() int { return s.bytes }
+
+func (s *setValue) clone() collection {
+	c := &setValue{members: make(map[string]struct{}, len(s.members)), bytes: s.bytes}
+	for m := range s.members {
+		c.members[m] = struct{}{}
+	}
+	return c
+}
+
+// sorted returns the members in lexicographic order.
+func (s *setValue) sorted() []string {
+	r := make([]string, 0, s.len())
+	for member := range s.members {
+		r = append(r, member)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// zsetValue keeps the members ordered by score and member in a skiplist of
+// zsetKey keys, each member counts its bytes and 8 bytes for the score.
+type zsetValue struct {
+	scores map[string]float64
+	index  *skiplist
+	bytes  int
+}
+
+func (z *zsetValue) typ() Type { return TypeZSet }
+func (z *zsetValue) len() int  { return len(z.scores) }
+func (z *zsetValue) size() int { return z.bytes }
+
+func (z *zsetValue) clone() collection {
+	c := &zsetValue{scores: make(map[string]float64, len(z.scores)), index: newSkiplist(), bytes: z.bytes}
+	for m, score := range z.scores {
+		c.scores[m] = score
+		c.index.insert(zsetKey(score, m))
+	}
+	return c
+}
+
+// slice returns the members between the ranks start and stop.
+func (z *zsetValue) slice(start, stop int) []ScoredMember {
+	i, j := span(start, stop, z.len())
+	r := make([]ScoredMember, 0, j-i)
+
+	n := z.index.seek("")
+	for k := 0; k < i; k++ {
+		n = n.Next()
+	}
+	for k := i; k < j; k, n = k+1, n.Next() {
+		member := n.key[zsetMemberSize:]
+		r = append(r, ScoredMember{Member: member, Score: z.scores[member]})
+	}
+	return r
+}
+
+// zsetKey encodes score and member into a string that sorts by score and
+// then by member, the sign bit of positive scores is set and negative
+// scores are inverted so the big-endian bytes sort like the floats.
+func zsetKey(score float64, member string) string {
+	bits := math.Float64bits(score)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], bits)
+	return string(b[:]) + member
+}
+
+// span converts the inclusive indexes start and stop, which may count from
+// the end, into a slice range of a sequence of length n.
+func span(start, stop, n int) (int, int) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return 0, 0
+	}
+	return start, stop + 1
+}
+
+func sortedKeys(m map[string][]byte) []string {
+	r := make([]string, 0, len(m))
+	for k := range m {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return r
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrNotInteger is returned by IncrBy when the value is not an integer.
+	ErrNotInteger = errors.New("value is not an integer or out of range")
+	// ErrNotFloat is returned by IncrByFloat when the value is not a float.
+	ErrNotFloat = errors.New("value is not a valid float")
+	// ErrOverflow is returned by IncrBy when the result does not fit in 64 bits.
+	ErrOverflow = errors.New("increment or decrement would overflow")
+	// ErrNaN is returned by IncrByFloat when the result is not a finite number.
+	ErrNaN = errors.New("increment would produce NaN or Infinity")
+)
+
+// Updater is implemented by stores that can atomically read and write a key.
+type Updater interface {
+	// Update calls fn with the value of key, or nil and false if key does not
+	// exist, and stores the value returned by fn unless key was modified in
+	// the meantime, fn is then called again with the new value so it may be
+	// called more than once. The error returned by fn is returned and nothing
+	// is stored, keys keep their expiry deadline.
+	Update(key string, fn func(value []byte, ok bool) ([]byte, error)) error
+}
+
+// IncrBy atomically adds delta to the integer value of key, a key that does
+// not exist is 0, and returns the new value.
+func IncrBy(u Updater, key string, delta int64) (int64, error) {
+	var n int64
+	err := u.Update(key, func(value []byte, ok bool) ([]byte, error) {
+		n = 0
+		if ok {
+			var isInt bool
+			if n, isInt = parseInt(value); !isInt {
+				return nil, ErrNotInteger
+			}
+		}
+
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return nil, ErrOverflow
+		}
+		n += delta
+		return strconv.AppendInt(nil, n, 10), nil
+	})
+	return n, err
+}
+
+// IncrByFloat atomically adds delta to the float value of key, a key that
+// does not exist is 0, and returns the new value.
+func IncrByFloat(u Updater, key string, delta float64) (float64, error) {
+	var f float64
+	err := u.Update(key, func(value []byte, ok bool) ([]byte, error) {
+		f = 0
+		if ok {
+			var err error
+			if f, err = strconv.ParseFloat(string(value), 64); err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				return nil, ErrNotFloat
+			}
+		}
+
+		f += delta
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, ErrNaN
+		}
+		return strconv.AppendFloat(nil, f, 'f', -1, 64), nil
+	})
+	return f, err
+}
+
+// parseInt parses canonical decimal integers, values with a sign, leading
+// zeros or spaces that would not be formatted back the same are rejected.
+func parseInt(value []byte) (int64, bool) {
+	if len(value) == 0 || len(value) > 20 {
+		return 0, false
+	}
+	if c := value[0]; c != '-' && (c < '0' || c > '9') {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil || intLen(n) != len(value) {
+		return 0, false
+	}
+	return n, true
+}
+
+// intLen returns the number of bytes of n formatted in decimal.
+func intLen(n int64) int {
+	l := 1
+	if n < 0 {
+		l++
+	}
+	for n >= 10 || n <= -10 {
+		n /= 10
+		l++
+	}
+	return l
+}
+
+// Update atomically replaces the value of key with the value returned by fn.
+// The value is read with its revision and the lock is released while it is
+// decompressed, passed to fn and the result compressed, the result is only
+// stored if the revision did not change and fn is called again otherwise.
+func (m *MemoryStore) Update(key string, fn func(value []byte, ok bool) ([]byte, error)) error {
+	for {
+		m.mu.Lock()
+		e, ok := m.lookup(key)
+		if ok && e.coll != nil {
+			m.unlock()
+			return ErrWrongType
+		}
+		var (
+			v   stringValue
+			rev = atomic.LoadUint64(m.rev)
+		)
+		if ok {
+			v, rev = e.stringValue, e.rev
+		}
+		m.unlock()
+
+		var old []byte
+		if ok {
+			old = v.bytes()
+		}
+		value, err := fn(old, ok)
+		if err != nil {
+			return err
+		}
+		v = m.encode(value)
+
+		m.mu.Lock()
+		if m.modifiedSince(key, rev) {
+			m.unlock()
+			continue
+		}
+		err = m.replace(key, v)
+		m.unlock()
+		return err
+	}
+}
+
+// update replaces the value of key with the value returned by fn holding
+// the lock for the whole call, m.mu must be held.
+func (m *MemoryStore) update(key string, fn func(value []byte, ok bool) ([]byte, error)) error {
+	e, ok := m.lookup(key)
+	if ok && e.coll != nil {
+		return ErrWrongType
+	}
+
+	var old []byte
+	if ok {
+		old = e.bytes()
+	}
+
+	value, err := fn(old, ok)
+	if err != nil {
+		return err
+	}
+	return m.replace(key, m.encode(value))
+}
+
+// replace stores the encoded value v keeping the deadline of key, m.mu must be held.
+func (m *MemoryStore) replace(key string, v stringValue) error {
+	var expires time.Time
+	if e, ok := m.lookup(key); ok {
+		expires = e.expires
+	}
+
+	if err := m.set(key, v); err != nil {
+		return err
+	}
+	if !expires.IsZero() {
+		m.setExpiry(m.items[key], expires)
+	}
+	return nil
+}
+
+// Update atomically replaces the value of key in its shard.
+func (s *ShardedStore) Update(key string, fn func(value []byte, ok bool) ([]byte, error)) error {
+	return s.shard(key).Update(key, fn)
+}
+
+func (t *memoryTx) Update(key string, fn func(value []byte, ok bool) ([]byte, error)) error {
+	return t.m.update(key, fn)
+}
+
+func (t *shardedTx) Update(key string, fn func(value []byte, ok bool) ([]byte, error)) error {
+	return t.tx(key).Update(key, fn)
+}
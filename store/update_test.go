@@ -0,0 +1,86 @@
+package store
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestIncrBy(t *testing.T) {
+	s := NewMemoryStore(100)
+	defer s.Close()
+
+	if n, err := IncrBy(s, "n", 5); err != nil || n != 5 {
+		t.Errorf("got %d %v, wants: %d", n, err, 5)
+	}
+	if n, _ := IncrBy(s, "n", -15); n != -10 {
+		t.Errorf("got %d, wants: %d", n, -10)
+	}
+
+	// Counters are kept as integers and read back as text.
+	if e := s.items["n"]; !e.isInt || e.value != nil {
+		t.Errorf("expected n to be integer encoded")
+	}
+	if v, _ := s.Get("n"); string(v) != "-10" || s.Cap() != 97 {
+		t.Errorf("got %q cap %d, wants: %q cap %d", v, s.Cap(), "-10", 97)
+	}
+
+	s.Set("max", []byte("9223372036854775807"))
+	if _, err := IncrBy(s, "max", 1); err != ErrOverflow {
+		t.Errorf("got %v, wants: %v", err, ErrOverflow)
+	}
+
+	s.Set("str", []byte("01"))
+	if _, err := IncrBy(s, "str", 1); err != ErrNotInteger {
+		t.Errorf("got %v, wants: %v", err, ErrNotInteger)
+	}
+
+	s.LPush("list", []byte("1"))
+	if _, err := IncrBy(s, "list", 1); err != ErrWrongType {
+		t.Errorf("got %v, wants: %v", err, ErrWrongType)
+	}
+
+	s.Expire("n", time.Hour)
+	IncrBy(s, "n", 1)
+	if ttl, _ := s.TTL("n"); ttl == NoExpiry {
+		t.Errorf("expected the deadline to be kept")
+	}
+}
+
+func TestIncrByFloat(t *testing.T) {
+	s := NewMemoryStore(100)
+	s.Set("f", []byte("10.5"))
+
+	if f, err := IncrByFloat(s, "f", 0.1); err != nil || f != 10.6 {
+		t.Errorf("got %v %v, wants: %v", f, err, 10.6)
+	}
+	if v, _ := s.Get("f"); string(v) != "10.6" {
+		t.Errorf("got %q, wants: %q", v, "10.6")
+	}
+
+	if _, err := IncrByFloat(s, "f", math.Inf(1)); err != ErrNaN {
+		t.Errorf("got %v, wants: %v", err, ErrNaN)
+	}
+
+	s.Set("str", []byte("abc"))
+	if _, err := IncrByFloat(s, "str", 1); err != ErrNotFloat {
+		t.Errorf("got %v, wants: %v", err, ErrNotFloat)
+	}
+}
+
+func TestUpdateRetry(t *testing.T) {
+	s := NewMemoryStore(100)
+	s.Set("k", []byte("a"))
+
+	// fn runs without the lock, a write in the meantime calls it again.
+	var calls int
+	err := s.Update("k", func(value []byte, ok bool) ([]byte, error) {
+		if calls++; calls == 1 {
+			s.Set("k", []byte("b"))
+		}
+		return append(value, 'c'), nil
+	})
+	if got, _ := s.Get("k"); err != nil || calls != 2 || string(got) != "bc" {
+		t.Errorf("got %q %v after %d calls, wants: %q after 2 calls", got, err, calls, "bc")
+	}
+}
@@ -0,0 +1,90 @@
+package store
+
+import "errors"
+
+// ErrVersionMismatch is returned by CompareAndSwap when the version of the
+// key is not the expected version.
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// Versioned is implemented by stores that keep a version for every key,
+// versions increase on every modification so clients can detect concurrent
+// writes between a read and a write.
+type Versioned interface {
+	// GetVersion returns the value and the version of key.
+	GetVersion(key string) ([]byte, uint64, bool)
+	// CompareAndSwap sets the value of key only if its version is version,
+	// the version of a key that does not exist is 0. It returns the new
+	// version or ErrVersionMismatch.
+	CompareAndSwap(key string, value []byte, version uint64) (uint64, error)
+}
+
+// GetVersion returns the value and the version of key.
+func (m *MemoryStore) GetVersion(key string) ([]byte, uint64, bool) {
+	m.mu.Lock()
+	v, version, ok := m.getVersion(key)
+	m.unlock()
+	if !ok {
+		return nil, 0, false
+	}
+	return v.bytes(), version, true
+}
+
+// CompareAndSwap sets the value of key if its version matches.
+func (m *MemoryStore) CompareAndSwap(key string, value []byte, version uint64) (uint64, error) {
+	v := m.encode(value)
+	m.mu.Lock()
+	defer m.unlock()
+	return m.compareAndSwap(key, v, version)
+}
+
+// getVersion returns the value and the version of key, m.mu must be held.
+func (m *MemoryStore) getVersion(key string) (stringValue, uint64, bool) {
+	v, ok := m.get(key)
+	if !ok {
+		return stringValue{}, 0, false
+	}
+	return v, m.items[key].rev, true
+}
+
+// compareAndSwap sets the encoded value v of key if its version matches and
+// returns the new version, m.mu must be held.
+func (m *MemoryStore) compareAndSwap(key string, v stringValue, version uint64) (uint64, error) {
+	if m.revision(key) != version {
+		return 0, ErrVersionMismatch
+	}
+
+	if err := m.set(key, v); err != nil {
+		return 0, err
+	}
+	return m.items[key].rev, nil
+}
+
+// GetVersion returns the value and the version of key from its shard.
+func (s *ShardedStore) GetVersion(key string) ([]byte, uint64, bool) {
+	return s.shard(key).GetVersion(key)
+}
+
+// CompareAndSwap sets the value of key in its shard if its version matches.
+func (s *ShardedStore) CompareAndSwap(key string, value []byte, version uint64) (uint64, error) {
+	return s.shard(key).CompareAndSwap(key, value, version)
+}
+
+func (t *memoryTx) GetVersion(key string) ([]byte, uint64, bool) {
+	v, version, ok := t.m.getVersion(key)
+	if !ok {
+		return nil, 0, false
+	}
+	return v.bytes(), version, true
+}
+
+func (t *memoryTx) CompareAndSwap(key string, value []byte, version uint64) (uint64, error) {
+	return t.m.compareAndSwap(key, t.m.encode(value), version)
+}
+
+func (t *shardedTx) GetVersion(key string) ([]byte, uint64, bool) {
+	return t.tx(key).GetVersion(key)
+}
+
+func (t *shardedTx) CompareAndSwap(key string, value []byte, version uint64) (uint64, error) {
+	return t.tx(key).CompareAndSwap(key, value, version)
+}
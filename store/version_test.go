@@ -0,0 +1,35 @@
+package store
+
+import "testing"
+
+func TestCompareAndSwap(t *testing.T) {
+	s := NewMemoryStore(100)
+
+	if _, err := s.CompareAndSwap("foo", []byte("a"), 1); err != ErrVersionMismatch {
+		t.Errorf("got %v, wants: %v", err, ErrVersionMismatch)
+	}
+
+	v1, err := s.CompareAndSwap("foo", []byte("a"), 0)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	s.Set("bar", []byte("b"))
+	if _, v, _ := s.GetVersion("bar"); v <= v1 {
+		t.Errorf("got version %d, wants greater than %d", v, v1)
+	}
+
+	v2, err := s.CompareAndSwap("foo", []byte("c"), v1)
+	if err != nil || v2 <= v1 {
+		t.Fatalf("got version %d err %v, wants greater than %d", v2, err, v1)
+	}
+
+	if _, err := s.CompareAndSwap("foo", []byte("d"), v1); err != ErrVersionMismatch {
+		t.Errorf("got %v, wants: %v", err, ErrVersionMismatch)
+	}
+
+	value, v, ok := s.GetVersion("foo")
+	if !ok || string(value) != "c" || v != v2 {
+		t.Errorf("got %q %d %v, wants: %q %d", value, v, ok, "c", v2)
+	}
+}
@@ -0,0 +1,349 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ErrReadOnly is returned by the writes to a View.
+var ErrReadOnly = errors.New("read-only view")
+
+// Viewer is implemented by stores that take point-in-time views.
+type Viewer interface {
+	// View returns a read-only copy of the store at the time of the call.
+	View() *View
+}
+
+// ViewOf returns a view of s if it implements Viewer and s otherwise.
+func ViewOf(s Store) Store {
+	if v, ok := s.(Viewer); ok {
+		if view := v.View(); view != nil {
+			return view
+		}
+	}
+	return s
+}
+
+// View is a read-only copy of a store at a point in time, writes to the
+// store after the view is taken are not visible and reads from the view do
+// not change the access tracking of the store eviction policy.
+//
+// Taking a view pins the current revision of the store without copying the
+// entries, the store saves an entry the first time it is written or removed
+// after the revision while the view is open and the view reads the saved
+// entries instead of the modified ones. Strings are never modified in place
+// and collections referenced by a view are copied by the store before their
+// next write. Close stops saving the entries for the view.
+type View struct {
+	shards []*MemoryStore
+	pins   []*pin
+	cap    int
+
+	// index returns the shard of a key, it is nil for a single store.
+	index func(key string) int
+}
+
+// pin is the state of a view kept by a store, the entries of revisions up
+// to rev are saved before they are modified or removed.
+type pin struct {
+	rev   uint64
+	saved map[string]*entry
+}
+
+// viewChunk is the number of keys listed by GetLastModifiedKeys between
+// two acquisitions of the store lock.
+const viewChunk = 1024
+
+// View returns a point-in-time view of the store.
+func (m *MemoryStore) View() *View {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return &View{shards: []*MemoryStore{m}, pins: []*pin{m.pin()}, cap: m.cap}
+}
+
+// View returns a point-in-time view of all the shards, the shards are
+// locked together only to pin the revision.
+func (s *ShardedStore) View() *View {
+	v := &View{shards: s.shards, pins: make([]*pin, len(s.shards)), index: s.index}
+	for _, m := range s.shards {
+		m.mu.Lock()
+	}
+	for i, m := range s.shards {
+		v.pins[i] = m.pin()
+		v.cap += m.cap
+	}
+	for i := len(s.shards) - 1; i >= 0; i-- {
+		s.shards[i].mu.Unlock()
+	}
+	return v
+}
+
+// pin starts saving the entries of the current revision, m.mu must be held.
+func (m *MemoryStore) pin() *pin {
+	p := &pin{rev: atomic.LoadUint64(m.rev), saved: make(map[string]*entry)}
+	m.pins = append(m.pins, p)
+	return p
+}
+
+// preserve saves e for the views that see it before it is modified or
+// removed and marks its collection as shared, m.mu must be held.
+func (m *MemoryStore) preserve(e *entry) {
+	for _, p := range m.pins {
+		if e.rev > p.rev {
+			continue
+		}
+		if _, ok := p.saved[e.key]; ok {
+			continue
+		}
+		if e.coll != nil {
+			e.shared = true
+		}
+		p.saved[e.key] = &entry{
+			key:         e.key,
+			stringValue: e.stringValue,
+			coll:        e.coll,
+			rev:         e.rev,
+			expires:     e.expires,
+			expiryIndex: -1,
+		}
+	}
+}
+
+// own copies the collection of e if a view shares it so it can be modified,
+// m.mu must be held.
+func (m *MemoryStore) own(e *entry) {
+	m.preserve(e)
+	if e.shared {
+		e.coll = e.coll.clone()
+		e.shared = false
+	}
+}
+
+// Close stops saving the entries written to the store for the view, the
+// view must not be used after.
+func (v *View) Close() error {
+	for i, m := range v.shards {
+		m.mu.Lock()
+		for j, p := range m.pins {
+			if p == v.pins[i] {
+				m.pins = append(m.pins[:j], m.pins[j+1:]...)
+				break
+			}
+		}
+		m.mu.Unlock()
+	}
+	return nil
+}
+
+// CloseView closes s if it is a View.
+func CloseView(s Store) {
+	if v, ok := s.(*View); ok {
+		v.Close()
+	}
+}
+
+// read calls fn with the store of key locked and the entry of key when the
+// view was taken, or nil if key did not exist or is expired.
+func (v *View) read(key string, fn func(e *entry)) {
+	i := 0
+	if v.index != nil {
+		i = v.index(key)
+	}
+	m, p := v.shards[i], v.pins[i]
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.items[key]
+	if !ok || e.rev > p.rev {
+		e = p.saved[key]
+	}
+	if e != nil && e.expired(time.Now()) {
+		e = nil
+	}
+	fn(e)
+}
+
+// revisions returns the keys of the shard i when the view was taken ordered
+// from the most to the least recently modified. The keys are listed in the
+// order of the scan index holding the lock for viewChunk keys at a time.
+func (v *View) revisions(i int) []keyRev {
+	m, p := v.shards[i], v.pins[i]
+	now := time.Now()
+
+	var (
+		r    []keyRev
+		seen = make(map[string]bool)
+		last string
+	)
+	for done := false; !done; {
+		m.mu.Lock()
+		n := m.hashes.seek(last)
+		if n != nil && n.key == last {
+			n = n.Next()
+		}
+		for k := 0; n != nil && k < viewChunk; k, n = k+1, n.Next() {
+			e := m.items[n.key[8:]]
+			if e.rev <= p.rev && !e.expired(now) {
+				r = append(r, keyRev{key: e.key, rev: e.rev})
+				seen[e.key] = true
+			}
+			last = n.key
+		}
+
+		// Once every key is listed the entries modified or removed in the
+		// meantime are taken from the saved ones, keys listed before they
+		// changed are kept once.
+		if done = n == nil; done {
+			for key, e := range p.saved {
+				if !seen[key] && !e.expired(now) {
+					r = append(r, keyRev{key: key, rev: e.rev})
+				}
+			}
+		}
+		m.mu.Unlock()
+	}
+
+	sort.Slice(r, func(i, j int) bool { return r[i].rev > r[j].rev })
+	return r
+}
+
+// Set returns ErrReadOnly.
+func (v *View) Set(string, []byte) error { return ErrReadOnly }
+
+// Delete returns ErrReadOnly.
+func (v *View) Delete(string) error { return ErrReadOnly }
+
+// Get returns the value of key when the view was taken.
+func (v *View) Get(key string) ([]byte, bool) {
+	var (
+		sv stringValue
+		ok bool
+	)
+	v.read(key, func(e *entry) {
+		if e != nil && e.coll == nil {
+			sv, ok = e.stringValue, true
+		}
+	})
+	if !ok {
+		return nil, false
+	}
+	return sv.bytes(), true
+}
+
+// Cap returns the capacity available when the view was taken.
+func (v *View) Cap() int { return v.cap }
+
+// GetLastModifiedKeys returns the keys ordered from the most to the least
+// recently modified when the view was taken.
+func (v *View) GetLastModifiedKeys() []string {
+	lists := make([][]keyRev, len(v.shards))
+	for i := range v.shards {
+		lists[i] = v.revisions(i)
+	}
+	return mergeRevisions(lists)
+}
+
+// Expire returns false, views are not modified.
+func (v *View) Expire(string, time.Duration) bool { return false }
+
+// TTL returns the time to live of key.
+func (v *View) TTL(key string) (ttl time.Duration, ok bool) {
+	v.read(key, func(e *entry) {
+		switch {
+		case e == nil:
+		case e.expires.IsZero():
+			ttl, ok = NoExpiry, true
+		default:
+			ttl, ok = time.Until(e.expires), true
+		}
+	})
+	return ttl, ok
+}
+
+// Persist returns false, views are not modified.
+func (v *View) Persist(string) bool { return false }
+
+// SetExpire returns ErrReadOnly.
+func (v *View) SetExpire(string, []byte, time.Duration) error { return ErrReadOnly }
+
+// Type returns the type of the value of key.
+func (v *View) Type(key string) Type {
+	t := TypeNone
+	v.read(key, func(e *entry) {
+		if e != nil {
+			t = e.typ()
+		}
+	})
+	return t
+}
+
+// collection calls fn with the collection of key of type t when the view
+// was taken, fn is not called if key did not exist.
+func (v *View) collection(key string, t Type, fn func(c collection)) (err error) {
+	v.read(key, func(e *entry) {
+		var c collection
+		if c, err = typed(e, t); c != nil {
+			fn(c)
+		}
+	})
+	return err
+}
+
+// LPush returns ErrReadOnly.
+func (v *View) LPush(string, ...[]byte) (int, error) { return 0, ErrReadOnly }
+
+// RPop returns ErrReadOnly.
+func (v *View) RPop(string) ([]byte, bool, error) { return nil, false, ErrReadOnly }
+
+// LRange returns the elements of the list between start and stop.
+func (v *View) LRange(key string, start, stop int) (r [][]byte, err error) {
+	err = v.collection(key, TypeList, func(c collection) { r = c.(*listValue).slice(start, stop) })
+	return r, err
+}
+
+// HSet returns ErrReadOnly.
+func (v *View) HSet(string, string, []byte) (bool, error) { return false, ErrReadOnly }
+
+// HGet returns the value of a field of the hash.
+func (v *View) HGet(key, field string) (value []byte, ok bool, err error) {
+	err = v.collection(key, TypeHash, func(c collection) { value, ok = c.(*hashValue).fields[field] })
+	return value, ok, err
+}
+
+// HGetAll returns the fields of the hash.
+func (v *View) HGetAll(key string) (r []KeyValue, err error) {
+	err = v.collection(key, TypeHash, func(c collection) { r = c.(*hashValue).all() })
+	return r, err
+}
+
+// SAdd returns ErrReadOnly.
+func (v *View) SAdd(string, ...string) (int, error) { return 0, ErrReadOnly }
+
+// SIsMember reports whether member is in the set.
+func (v *View) SIsMember(key, member string) (ok bool, err error) {
+	err = v.collection(key, TypeSet, func(c collection) { _, ok = c.(*setValue).members[member] })
+	return ok, err
+}
+
+// SMembers returns the members of the set.
+func (v *View) SMembers(key string) (r []string, err error) {
+	err = v.collection(key, TypeSet, func(c collection) { r = c.(*setValue).sorted() })
+	return r, err
+}
+
+// ZAdd returns ErrReadOnly.
+func (v *View) ZAdd(string, float64, string) (bool, error) { return false, ErrReadOnly }
+
+// ZRange returns members of the sorted set between start and stop.
+func (v *View) ZRange(key string, start, stop int) (r []ScoredMember, err error) {
+	err = v.collection(key, TypeZSet, func(c collection) { r = c.(*zsetValue).slice(start, stop) })
+	return r, err
+}
+
+// ZScore returns the score of a member of the sorted set.
+func (v *View) ZScore(key, member string) (score float64, ok bool, err error) {
+	err = v.collection(key, TypeZSet, func(c collection) { score, ok = c.(*zsetValue).scores[member] })
+	return score, ok, err
+}
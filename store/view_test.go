@@ -0,0 +1,142 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestView(t *testing.T) {
+	s := NewMemoryStore(100)
+	s.Set("a", []byte("1"))
+	s.Set("b", []byte("2"))
+	s.LPush("list", []byte("x"))
+	s.HSet("hash", "f", []byte("y"))
+
+	v := s.View()
+
+	s.Set("a", []byte("3"))
+	s.Delete("b")
+	s.Set("c", []byte("4"))
+	s.LPush("list", []byte("z"))
+	s.RPop("list")
+	s.HSet("hash", "g", []byte("w"))
+
+	if got, wants := v.GetLastModifiedKeys(), []string{"hash", "list", "b", "a"}; !reflect.DeepEqual(got, wants) {
+		t.Errorf("got keys %v, wants: %v", got, wants)
+	}
+
+	for key, value := range map[string]string{"a": "1", "b": "2"} {
+		if got, ok := v.Get(key); !ok || string(got) != value {
+			t.Errorf("got %q %v for %v, wants: %q", got, ok, key, value)
+		}
+	}
+	if _, ok := v.Get("c"); ok {
+		t.Error("expected the key set after the view to be missing")
+	}
+
+	if got, _ := v.LRange("list", 0, -1); !reflect.DeepEqual(got, [][]byte{[]byte("x")}) {
+		t.Errorf("got list %q, wants: [x]", got)
+	}
+	if got, _ := s.LRange("list", 0, -1); !reflect.DeepEqual(got, [][]byte{[]byte("z")}) {
+		t.Errorf("got store list %q, wants: [z]", got)
+	}
+	if got, _ := v.HGetAll("hash"); len(got) != 1 {
+		t.Errorf("got hash %v, wants one field", got)
+	}
+
+	if err := v.Set("a", nil); err != ErrReadOnly {
+		t.Errorf("got %v, wants: %v", err, ErrReadOnly)
+	}
+}
+
+func TestViewAccessTracking(t *testing.T) {
+	s := NewMemoryStore(2)
+	s.Set("a", []byte("1"))
+	s.Set("b", []byte("2"))
+
+	// Reading the view does not make a recently used.
+	s.View().Get("a")
+	s.Set("c", []byte("3"))
+
+	if _, ok := s.Get("a"); ok {
+		t.Error("expected a to be evicted")
+	}
+	if _, ok := s.Get("b"); !ok {
+		t.Error("expected b to be kept")
+	}
+}
+
+func TestViewSharded(t *testing.T) {
+	s := NewShardedStore(4, 100, nil)
+	defer s.Close()
+
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	for _, k := range keys {
+		s.Set(k, []byte(k))
+	}
+
+	v := s.View()
+	s.Set("a", []byte("changed"))
+
+	if got, wants := v.GetLastModifiedKeys(), []string{"f", "e", "d", "c", "b", "a"}; !reflect.DeepEqual(got, wants) {
+		t.Errorf("got keys %v, wants: %v", got, wants)
+	}
+	if got, _ := v.Get("a"); string(got) != "a" {
+		t.Errorf("got %q, wants: %q", got, "a")
+	}
+	if got, wants := v.Cap(), 100-len(keys); got != wants {
+		t.Errorf("got capacity %d, wants: %d", got, wants)
+	}
+}
+
+func TestViewCopyOnWrite(t *testing.T) {
+	s := NewShardedStore(4, 100, nil)
+	defer s.Close()
+	s.Set("a", []byte("1"))
+	s.Set("b", []byte("2"))
+	s.Set("c", []byte("3"))
+
+	v := s.View()
+	saved := func() int {
+		var n int
+		for _, p := range v.pins {
+			n += len(p.saved)
+		}
+		return n
+	}
+
+	// Taking the view copies nothing, entries are saved once when first
+	// written after it and new keys are not saved.
+	if n := saved(); n != 0 {
+		t.Errorf("got %d saved entries, wants: 0", n)
+	}
+	rev := s.Revision("b")
+	s.Set("a", []byte("4"))
+	s.Set("a", []byte("5"))
+	s.Expire("b", time.Hour)
+	s.Set("d", []byte("6"))
+	if n := saved(); n != 2 {
+		t.Errorf("got %d saved entries, wants: 2", n)
+	}
+
+	if got, _ := v.Get("a"); string(got) != "1" {
+		t.Errorf("got %q, wants: %q", got, "1")
+	}
+	if ttl, _ := v.TTL("b"); ttl != NoExpiry {
+		t.Errorf("got ttl %v, wants: %v", ttl, NoExpiry)
+	}
+	if s.Revision("b") == rev {
+		t.Error("expected the deadline to change the revision")
+	}
+	if got, wants := v.GetLastModifiedKeys(), []string{"c", "b", "a"}; !reflect.DeepEqual(got, wants) {
+		t.Errorf("got keys %v, wants: %v", got, wants)
+	}
+
+	// A closed view is no longer saved for.
+	v.Close()
+	s.Set("c", []byte("7"))
+	if n := saved(); n != 2 {
+		t.Errorf("got %d saved entries, wants: 2", n)
+	}
+}